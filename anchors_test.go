@@ -0,0 +1,117 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type LogLine struct {
+	_       struct{} `(?m)^`
+	Level   string   `[A-Z]+`
+	_       struct{} `: `
+	Message string   `.*`
+	_       struct{} `(?m)$`
+}
+
+func TestAnchors_CRLF(t *testing.T) {
+	input := "INFO: started\r\nWARN: disk full\r\n"
+
+	var lines []LogLine
+	MustCompile(LogLine{}, Options{}).FindAll(&lines, input, -1)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "started\r", lines[0].Message)
+
+	lines = nil
+	MustCompile(LogLine{}, Options{CRLF: true}).FindAll(&lines, input, -1)
+	assert.Equal(t, []LogLine{
+		{Level: "INFO", Message: "started"},
+		{Level: "WARN", Message: "disk full"},
+	}, lines)
+}
+
+func TestAnchors_UnicodeWordBoundaries(t *testing.T) {
+	type Mention struct {
+		Name string `\b(?:Zoë|Zoe)\b`
+	}
+
+	var mentions []Mention
+	MustCompile(Mention{}, Options{}).FindAll(&mentions, "Zoë Zoey Zoë's", -1)
+	assert.Empty(t, mentions)
+
+	MustCompile(Mention{}, Options{UnicodeWordBoundaries: true}).FindAll(&mentions, "Zoë Zoey Zoë's", -1)
+	assert.Equal(t, []Mention{{"Zoë"}, {"Zoë"}}, mentions)
+}
+
+func TestAnchors_CRLFInSet(t *testing.T) {
+	set, err := CompileSet([]interface{}{LogLine{}}, Options{CRLF: true})
+	require.NoError(t, err)
+	line, ok := set.Find("DEBUG: x\r\n").(*LogLine)
+	require.True(t, ok)
+	assert.Equal(t, "x", line.Message)
+	assert.Equal(t, []interface{}{line}, set.FindMatching("DEBUG: x\r\n"))
+}
+
+type Quantity struct {
+	Amount string   `\d+`
+	_      struct{} ` `
+	Unit   string   `k|kg`
+}
+
+func TestAnchors_Option(t *testing.T) {
+	var q Quantity
+	assert.True(t, MustCompile(Quantity{}, Options{}).Find(&q, "x 3 kg"))
+
+	start := MustCompile(Quantity{}, Options{Anchor: AnchorStart})
+	assert.False(t, start.Find(&q, "x 3 kg"))
+	assert.True(t, start.Find(&q, "3 kg x"))
+	var qs []Quantity
+	start.FindAll(&qs, "3 kg 4 kg", -1)
+	assert.Equal(t, []Quantity{{Amount: "3", Unit: "k"}}, qs)
+
+	both := MustCompile(Quantity{}, Options{Anchor: AnchorBoth})
+	assert.False(t, both.Find(&q, "3 kg x"))
+	require.True(t, both.Find(&q, "3 kg"))
+	assert.Equal(t, Quantity{Amount: "3", Unit: "kg"}, q)
+	assert.Empty(t, both.Lint())
+}
+
+func TestAnchors_MatchFull(t *testing.T) {
+	for _, opts := range []Options{{}, {Anchor: AnchorBoth}, {Engine: StdlibEngine}} {
+		pattern := MustCompile(Quantity{}, opts)
+		var q Quantity
+		assert.False(t, pattern.MatchFull(&q, "3 kg!"))
+		assert.False(t, pattern.MatchFull(&q, " 3 kg"))
+
+		// The whole input matches with Unit "kg", although Find prefers "k"
+		require.True(t, pattern.MatchFull(&q, "3 kg"))
+		assert.Equal(t, Quantity{Amount: "3", Unit: "kg"}, q)
+	}
+}
+
+func TestAnchors_Lint(t *testing.T) {
+	assert.Equal(t, []string{
+		"DotExpr begins with ^, which Options.Anchor can add instead",
+		"DotExpr ends with $, which Options.Anchor can add instead",
+	}, MustCompile(DotExpr{}, Options{}).Lint())
+	assert.Equal(t, []string{
+		"DotExpr begins with ^, which is redundant since Options.Anchor is set",
+		"DotExpr ends with $, which is redundant since Options.Anchor is AnchorBoth",
+	}, MustCompile(DotExpr{}, Options{Anchor: AnchorBoth}).Lint())
+	assert.Equal(t, []string{
+		"DotExpr begins with ^, which is redundant since Options.Anchor is set",
+		"DotExpr ends with $, which Options.Anchor can add instead",
+	}, MustCompile(DotExpr{}, Options{Anchor: AnchorStart}).Lint())
+
+	// Line anchors do not anchor the struct to the input
+	assert.Empty(t, MustCompile(LogLine{}, Options{}).Lint())
+	assert.Empty(t, MustCompile(Quantity{}, Options{}).Lint())
+}
+
+func TestAnchors_Set(t *testing.T) {
+	set, err := CompileSet([]interface{}{Quantity{}}, Options{Anchor: AnchorBoth})
+	require.NoError(t, err)
+	assert.Nil(t, set.Find("x 3 kg"))
+	assert.Equal(t, &Quantity{Amount: "3", Unit: "kg"}, set.Find("3 kg"))
+}
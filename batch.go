@@ -0,0 +1,150 @@
+package restructure
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// batchBlock is the number of inputs that each goroutine takes at a time in
+// FindBatch
+const batchBlock = 64
+
+// BatchResult reports the outcome of matching one of the inputs to
+// FindBatch.
+type BatchResult struct {
+	Matched bool  // whether the input matched
+	Err     error // why the input could not be searched or its match stored, or nil
+}
+
+// FindBatch matches each of the inputs separately, as Find would, spreading
+// the work across runtime.GOMAXPROCS(0) goroutines, which is useful for
+// parsing many short records. Each goroutine reuses its own buffers, and the
+// searches reuse the machines pooled by the regular expression. The dest
+// parameter must be a pointer to a slice of T or *T, where T is the struct
+// type for this regular expression. The slice is resized to hold one element
+// per input, in the same order, reusing its capacity and, for slices of
+// pointers, the structs already pointed to, as AppendAll does. The element
+// for an input that did not match is left zero, except that in a slice of
+// pointers a struct that was already pointed to is kept and zeroed, so the
+// pointer is only nil if there was no struct to reuse. Use the results
+// rather than the elements to tell which inputs matched.
+//
+// The result for each input reports whether it matched, and any error that
+// occurred, such as an int field whose text could not be parsed, which would
+// make Find panic, or ErrBudgetExceeded if the search took more than
+// Options.MaxSteps steps.
+func (r *Regexp) FindBatch(inputs []string, dest interface{}) []BatchResult {
+	// Check the type
+	slice, itemType := r.checkSliceDest(dest, "FindBatch")
+
+	// Resize the slice, keeping any existing elements so that the structs
+	// they point to can be reused
+	n := len(inputs)
+	if n <= slice.Cap() {
+		slice.SetLen(n)
+	} else {
+		grown := reflect.MakeSlice(slice.Type(), n, n)
+		reflect.Copy(grown, slice)
+		slice.Set(grown)
+	}
+
+	// Each goroutine takes the next block of inputs until there are none
+	// left
+	results := make([]BatchResult, n)
+	var next int64
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.GOMAXPROCS(0) && w*batchBlock < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var match match
+			for {
+				lo := int(atomic.AddInt64(&next, batchBlock)) - batchBlock
+				if lo >= n {
+					return
+				}
+				hi := lo + batchBlock
+				if hi > n {
+					hi = n
+				}
+				for i := lo; i < hi; i++ {
+					destItem := r.clearItem(slice, itemType, i)
+					results[i] = r.findItem(destItem, inputs[i], &match)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// findItem matches s and inflates the match into destItem, reusing match
+func (r *Regexp) findItem(destItem reflect.Value, s string, match *match) BatchResult {
+	input := []byte(s)
+
+	// Execute the regular expression
+	var indices []int
+	if r.re != nil {
+		var err error
+		indices, err = r.re.FindSubmatchIndexContext(context.Background(), input)
+		if err != nil {
+			return BatchResult{Err: err}
+		}
+	} else {
+		indices = r.m.FindSubmatchIndex(input)
+	}
+	if indices == nil {
+		return BatchResult{}
+	}
+
+	// Inflate the match into the dest item
+	r.resetMatch(match, indices, input)
+	if err := inflateStruct(destItem, match, r.st); err != nil {
+		return BatchResult{Matched: true, Err: err}
+	}
+	return BatchResult{Matched: true}
+}
+
+// FindBatchReader is like FindBatch but matches each line read from rd,
+// without its "\n" or "\r\n" line ending. Rather than reading all of rd at
+// once, it reads up to runtime.GOMAXPROCS(0) blocks of 64 lines at a time,
+// matches them with FindBatch, and then calls fn with their results before
+// reading any more. The slice pointed to by dest holds the matches for the
+// lines passed to the latest call to fn, in the same order as the results,
+// and is reused for the next lines, so fn must copy anything it wants to
+// keep. It stops early if fn returns false. If reading fails then it passes
+// the lines read until then to fn and returns the error.
+func (r *Regexp) FindBatchReader(rd io.Reader, dest interface{}, fn func(results []BatchResult) bool) error {
+	// Check the type
+	r.checkSliceDest(dest, "FindBatchReader")
+
+	size := runtime.GOMAXPROCS(0) * batchBlock
+	lines := make([]string, 0, size)
+	br := bufio.NewReader(rd)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			line = strings.TrimSuffix(line, "\n")
+			line = strings.TrimSuffix(line, "\r")
+			lines = append(lines, line)
+		}
+		if len(lines) == size || (err != nil && len(lines) > 0) {
+			if !fn(r.FindBatch(lines, dest)) {
+				return nil
+			}
+			lines = lines[:0]
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
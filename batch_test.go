@@ -0,0 +1,143 @@
+package restructure
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindBatch(t *testing.T) {
+	var inputs []string
+	for i := 0; i < 1000; i++ {
+		if i%3 == 0 {
+			inputs = append(inputs, fmt.Sprintf("foo%d", i))
+		} else if i%3 == 1 {
+			inputs = append(inputs, fmt.Sprintf("foo%d.bar", i))
+		} else {
+			inputs = append(inputs, "foo.")
+		}
+	}
+
+	pattern := MustCompile(DotExpr{}, Options{})
+	var exprs []DotExpr
+	results := pattern.FindBatch(inputs, &exprs)
+	require.Len(t, results, len(inputs))
+	require.Len(t, exprs, len(inputs))
+	for i, input := range inputs {
+		var expected DotExpr
+		found := pattern.Find(&expected, input)
+		assert.Equal(t, BatchResult{Matched: found}, results[i])
+		assert.Equal(t, expected, exprs[i])
+	}
+}
+
+func TestFindBatch_ReusesStructs(t *testing.T) {
+	pattern := MustCompile(Word{}, Options{})
+	first, second := &Word{S: "old"}, &Word{S: "old"}
+	words := []*Word{first, second}
+	results := pattern.FindBatch([]string{"ham", "!!", "spam"}, &words)
+	assert.Equal(t, []BatchResult{{Matched: true}, {}, {Matched: true}}, results)
+	require.Len(t, words, 3)
+	assert.True(t, words[0] == first)
+	assert.True(t, words[1] == second)
+	assert.Equal(t, &Word{S: "ham"}, words[0])
+	assert.Equal(t, &Word{}, words[1])
+	assert.Equal(t, &Word{S: "spam"}, words[2])
+
+	// shrinking the batch keeps the capacity
+	results = pattern.FindBatch([]string{"eggs"}, &words)
+	assert.Equal(t, []BatchResult{{Matched: true}}, results)
+	assert.Equal(t, []*Word{{S: "eggs"}}, words)
+	assert.True(t, words[0] == first)
+}
+
+func TestFindBatch_Errors(t *testing.T) {
+	pattern := MustCompile(ExprWithInt{}, Options{})
+	var exprs []ExprWithInt
+	results := pattern.FindBatch([]string{"123 cats", "99999999999999999999999 dogs", "cats"}, &exprs)
+	require.Len(t, results, 3)
+	assert.Equal(t, BatchResult{Matched: true}, results[0])
+	assert.Equal(t, ExprWithInt{Number: 123, Animal: "cats"}, exprs[0])
+	assert.True(t, results[1].Matched)
+	assert.Error(t, results[1].Err)
+	assert.Equal(t, BatchResult{}, results[2])
+
+	pattern = MustCompile(Word{}, Options{MaxSteps: 100})
+	var words []Word
+	results = pattern.FindBatch([]string{"ham", strings.Repeat(" ", 200) + "ham"}, &words)
+	assert.Equal(t, []BatchResult{{Matched: true}, {Err: ErrBudgetExceeded}}, results)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+// collectBatches runs FindBatchReader on rd, copying the results and
+// matches passed to each call of fn
+func collectBatches(pattern *Regexp, rd io.Reader, stopAfter int) ([][]BatchResult, [][]DotExpr, error) {
+	var results [][]BatchResult
+	var matches [][]DotExpr
+	var exprs []DotExpr
+	err := pattern.FindBatchReader(rd, &exprs, func(block []BatchResult) bool {
+		results = append(results, block)
+		matches = append(matches, append([]DotExpr(nil), exprs...))
+		return len(results) != stopAfter
+	})
+	return results, matches, err
+}
+
+func TestFindBatchReader(t *testing.T) {
+	pattern := MustCompile(DotExpr{}, Options{})
+	results, matches, err := collectBatches(pattern, strings.NewReader("foo.bar\r\nbaz\n\nqux.\nlast.one"), -1)
+	require.NoError(t, err)
+	assert.Equal(t, [][]BatchResult{{{Matched: true}, {Matched: true}, {}, {}, {Matched: true}}}, results)
+	assert.Equal(t, [][]DotExpr{{
+		{Head: "foo", Tail: &DotName{Dot: ".", Name: "bar"}},
+		{Head: "baz"},
+		{},
+		{},
+		{Head: "last", Tail: &DotName{Dot: ".", Name: "one"}},
+	}}, matches)
+
+	rd := io.MultiReader(strings.NewReader("foo\nbar\n"), failingReader{})
+	results, matches, err = collectBatches(pattern, rd, -1)
+	assert.EqualError(t, err, "connection reset")
+	assert.Equal(t, [][]BatchResult{{{Matched: true}, {Matched: true}}}, results)
+	assert.Equal(t, [][]DotExpr{{{Head: "foo"}, {Head: "bar"}}}, matches)
+
+	results, _, err = collectBatches(pattern, strings.NewReader(""), -1)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestFindBatchReader_Blocks(t *testing.T) {
+	size := runtime.GOMAXPROCS(0) * batchBlock
+	var input strings.Builder
+	for i := 0; i < 2*size+10; i++ {
+		fmt.Fprintf(&input, "foo%d.bar\n", i)
+	}
+
+	pattern := MustCompile(DotExpr{}, Options{})
+	results, matches, err := collectBatches(pattern, strings.NewReader(input.String()), -1)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Len(t, results[0], size)
+	assert.Len(t, results[1], size)
+	assert.Len(t, results[2], 10)
+	assert.Equal(t, "foo0", matches[0][0].Head)
+	assert.Equal(t, fmt.Sprintf("foo%d", size), matches[1][0].Head)
+	assert.Equal(t, fmt.Sprintf("foo%d", 2*size+9), matches[2][9].Head)
+
+	// stopping early reads no further blocks
+	results, _, err = collectBatches(pattern, strings.NewReader(input.String()), 1)
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+}
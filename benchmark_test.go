@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -136,3 +137,262 @@ func BenchmarkFindAllImportsStdlib(b *testing.B) {
 		pattern.FindAllSubmatchIndex(buf, -1)
 	}
 }
+
+func BenchmarkFindAllFloats(b *testing.B) {
+	pattern := MustCompile(Float{}, Options{})
+	var floats []Float
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindAll(&floats, src, -1)
+	}
+}
+
+func BenchmarkAppendAllFloats(b *testing.B) {
+	pattern := MustCompile(Float{}, Options{})
+	var floats []Float
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		floats = floats[:0]
+		pattern.AppendAll(&floats, src, -1)
+	}
+}
+
+func BenchmarkFindEachFloat(b *testing.B) {
+	pattern := MustCompile(Float{}, Options{})
+	var f Float
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindEach(&f, src, func(interface{}) bool { return true })
+	}
+}
+
+// LogError matches error lines in a log
+type LogError struct {
+	_     struct{} `(?m)^`
+	Level string   `ERROR|FATAL`
+	_     struct{} `:\s+`
+	Msg   string   `[^\n]*`
+}
+
+// sparseLog is a large log in which only a single line matches LogError
+var sparseLog = strings.Repeat("INFO: request 12345 completed without incident\n", 20000) +
+	"ERROR: out of disk space\n" +
+	strings.Repeat("INFO: request 12345 completed without incident\n", 20000)
+
+func BenchmarkFindAllSparseLog(b *testing.B) {
+	pattern := MustCompile(LogError{}, Options{})
+	var errs []LogError
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindAll(&errs, sparseLog, -1)
+	}
+}
+
+func BenchmarkFindAllSparseLogStdlib(b *testing.B) {
+	pattern := regexp.MustCompile(`((?m)^(?P<Level>ERROR|FATAL):\s+(?P<Msg>[^\n]*))`)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindAllStringSubmatchIndex(sparseLog, -1)
+	}
+}
+
+// Mention matches an email address anywhere in a string
+type Mention struct {
+	User string   `[a-zA-Z0-9._%+-]+`
+	_    struct{} `@`
+	Host string   `\w+\.\w+`
+}
+
+// proseWithEmails is a long string containing a handful of email addresses
+var proseWithEmails = strings.Repeat(src, 100) + " contact joe@example.com " + strings.Repeat(src, 100)
+
+func BenchmarkFindAllEmails(b *testing.B) {
+	pattern := MustCompile(Mention{}, Options{})
+	var mentions []Mention
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindAll(&mentions, proseWithEmails, -1)
+	}
+}
+
+func BenchmarkSetFindEvent(b *testing.B) {
+	set := MustCompileSet(eventTypes, Options{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set.Find("transfer 12 to carol")
+	}
+}
+
+func BenchmarkFindEventSeparately(b *testing.B) {
+	var login LoginEvent
+	var logout LogoutEvent
+	var transfer TransferEvent
+	patterns := []*Regexp{
+		MustCompile(login, Options{}),
+		MustCompile(logout, Options{}),
+		MustCompile(transfer, Options{}),
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = patterns[0].Find(&login, "transfer 12 to carol") ||
+			patterns[1].Find(&logout, "transfer 12 to carol") ||
+			patterns[2].Find(&transfer, "transfer 12 to carol")
+	}
+}
+
+func BenchmarkFindFloatParallel(b *testing.B) {
+	pattern := MustCompile(Float{}, Options{})
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var f Float
+		for pb.Next() {
+			pattern.Find(&f, src)
+		}
+	})
+}
+
+func BenchmarkParseEmailParallel(b *testing.B) {
+	pattern := MustCompile(EmailAddress{}, Options{})
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var addr EmailAddress
+		for pb.Next() {
+			pattern.Find(&addr, "joe@example.com")
+		}
+	})
+}
+
+func BenchmarkFindAllFloatsParallel(b *testing.B) {
+	pattern := MustCompile(Float{}, Options{})
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var floats []Float
+		for pb.Next() {
+			pattern.FindAll(&floats, src, -1)
+		}
+	})
+}
+
+func BenchmarkSetFindEventParallel(b *testing.B) {
+	set := MustCompileSet(eventTypes, Options{})
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			set.Find("transfer 12 to carol")
+		}
+	})
+}
+
+// manyFloats is a long string containing many floating point numbers
+var manyFloats = strings.Repeat(src, 2000)
+
+func BenchmarkFindAllManyFloats(b *testing.B) {
+	pattern := MustCompile(Float{}, Options{})
+	var floats []Float
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindAll(&floats, manyFloats, -1)
+	}
+}
+
+func BenchmarkFindAllParallelManyFloats(b *testing.B) {
+	pattern := MustCompile(Float{}, Options{ChunkSeparator: '\n'})
+	var floats []Float
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindAllParallel(&floats, manyFloats, 0)
+	}
+}
+
+func BenchmarkFindAllParallelSparseLog(b *testing.B) {
+	pattern := MustCompile(LogError{}, Options{ChunkSeparator: '\n'})
+	var errs []LogError
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindAllParallel(&errs, sparseLog, 0)
+	}
+}
+
+// ProductCode matches a code such as ABC1
+type ProductCode struct {
+	Letters string `[A-Z]{3}`
+	Digit   string `\d`
+}
+
+// noCodes is a large input that contains no ProductCode
+var noCodes = strings.Repeat("info: request 12345 completed without incident\n", 40000)
+
+func BenchmarkFindAllNoMatch(b *testing.B) {
+	pattern := MustCompile(ProductCode{}, Options{})
+	var codes []ProductCode
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindAll(&codes, noCodes, -1)
+	}
+}
+
+func BenchmarkFindAllParallelNoMatch(b *testing.B) {
+	pattern := MustCompile(ProductCode{}, Options{})
+	var codes []ProductCode
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindAllParallel(&codes, noCodes, 0)
+	}
+}
+
+// Syllable matches as little of a word as it can
+type Syllable struct {
+	Letters string `\w+?`
+}
+
+// longWord is a large input consisting of a single word
+var longWord = strings.Repeat("ab", 50000)
+
+func BenchmarkFindLastLongWord(b *testing.B) {
+	pattern := MustCompile(Syllable{}, Options{})
+	var syl Syllable
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindLast(&syl, longWord)
+	}
+}
+
+// emailRecords is a batch of short records, each holding one email address
+var emailRecords = strings.Split(strings.Repeat("joe@example.com\nnot an email\nalice@example.org\n", 1000), "\n")
+
+func BenchmarkFindEachRecord(b *testing.B) {
+	pattern := MustCompile(EmailAddress{}, Options{})
+	addrs := make([]EmailAddress, len(emailRecords))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, record := range emailRecords {
+			pattern.Find(&addrs[j], record)
+		}
+	}
+}
+
+func BenchmarkFindBatch(b *testing.B) {
+	pattern := MustCompile(EmailAddress{}, Options{})
+	var addrs []EmailAddress
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pattern.FindBatch(emailRecords, &addrs)
+	}
+}
+
+func BenchmarkCompileQuaternion(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		MustCompile(QuotedQuaternion{}, Options{})
+	}
+}
+
+func BenchmarkLoadQuaternion(b *testing.B) {
+	data, err := MustCompile(QuotedQuaternion{}, Options{}).MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		MustLoad(QuotedQuaternion{}, data)
+	}
+}
@@ -1,11 +1,15 @@
 package restructure
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"reflect"
 	"regexp/syntax"
+	"strconv"
 	"strings"
+
+	"github.com/alexflint/go-restructure/regex"
 )
 
 // A Role determines how a struct field is inflated
@@ -19,6 +23,12 @@ const (
 	IntScalarRole
 	ByteSliceScalarRole
 	SubmatchScalarRole
+	Uint16Role
+	Uint32Role
+	SpanRole
+	LinePosRole
+	MatchRole
+	EndPosRole
 )
 
 // A Struct describes how to inflate a match into a struct
@@ -33,6 +43,8 @@ type Field struct {
 	index   []int   // index of this field within its parent struct
 	child   *Struct // descendant struct; nil for terminals
 	role    Role
+	order   binary.ByteOrder // byte order for fixed-width integers
+	lines   bool             // whether a Submatch or Span keeps the line index of the input
 }
 
 func isExported(f reflect.StructField) bool {
@@ -43,11 +55,16 @@ func isExported(f reflect.StructField) bool {
 type builder struct {
 	numCaptures int
 	opts        Options
+	prefix      string         // dotted path of the struct being built, such as "Host."
+	paths       map[string]int // capture index for the path of each field built so far
+	edits       map[int]int    // edits allowed within each field with a fuzzy tag, by capture index
 }
 
 func newBuilder(opts Options) *builder {
 	return &builder{
-		opts: opts,
+		opts:  opts,
+		paths: make(map[string]int),
+		edits: make(map[int]int),
 	}
 }
 
@@ -57,6 +74,43 @@ func (b *builder) nextCaptureIndex() int {
 	return k
 }
 
+// parse parses the pattern for a field, accepting extended syntax if it is
+// enabled
+func (b *builder) parse(pattern string) (*syntax.Regexp, error) {
+	if !b.opts.ExtendedSyntax {
+		return syntax.Parse(pattern, b.opts.SyntaxFlags)
+	}
+	expr, err := regex.ParseExtended(pattern, b.opts.SyntaxFlags)
+	if err != nil {
+		return nil, err
+	}
+	return expr, b.resolveBackrefs(expr)
+}
+
+// resolveBackrefs points each backreference in expr at the capture for the
+// field it names, which must come before it. Names are looked up relative
+// to the current struct and then from the root struct.
+func (b *builder) resolveBackrefs(expr *syntax.Regexp) error {
+	if expr.Op == regex.OpBackref {
+		if expr.Name == "" {
+			return fmt.Errorf(`\k<%d>: backreferences must name a field`, expr.Cap)
+		}
+		for _, path := range []string{b.prefix + expr.Name, expr.Name} {
+			if k, ok := b.paths[path]; ok {
+				expr.Cap, expr.Name = k, path
+				return nil
+			}
+		}
+		return fmt.Errorf(`\k<%s> does not refer to an earlier field`, expr.Name)
+	}
+	for _, sub := range expr.Sub {
+		if err := b.resolveBackrefs(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (b *builder) extractTag(tag reflect.StructTag) (string, error) {
 	// Allow tags that look like either `regexp:"\\w+"` or just `\w+`
 	if s := tag.Get("regexp"); s != "" {
@@ -75,8 +129,66 @@ func removeCaptures(expr *syntax.Regexp) ([]*syntax.Regexp, error) {
 	return []*syntax.Regexp{expr}, nil
 }
 
+// setGreedy makes every repetition in expr greedy, or every one lazy
+func setGreedy(expr *syntax.Regexp, greedy bool) {
+	switch expr.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		if greedy {
+			expr.Flags &^= syntax.NonGreedy
+		} else {
+			expr.Flags |= syntax.NonGreedy
+		}
+	}
+	for _, sub := range expr.Sub {
+		setGreedy(sub, greedy)
+	}
+}
+
+// fixedWidthTag gets the pattern and byte order for a uint16 or uint32
+// field, which match exactly 2 or 4 bytes unless a pattern is given. Fields
+// with neither an endian nor a regexp tag are ignored, as they were before
+// such fields could be decoded.
+func (b *builder) fixedWidthTag(f reflect.StructField, size int) (string, binary.ByteOrder, error) {
+	endian, hasEndian := f.Tag.Lookup("endian")
+	pattern := f.Tag.Get("regexp")
+	if !hasEndian && pattern == "" {
+		return "", nil, nil
+	}
+	if !b.opts.Bytes {
+		return "", nil, fmt.Errorf("fixed-width integer fields require Options.Bytes")
+	}
+	var order binary.ByteOrder
+	switch endian {
+	case "", "little":
+		order = binary.LittleEndian
+	case "big":
+		order = binary.BigEndian
+	default:
+		return "", nil, fmt.Errorf(`invalid endian tag "%s"`, endian)
+	}
+	if pattern == "" {
+		pattern = fmt.Sprintf(`[\x00-\xff]{%d}`, size)
+	}
+	return pattern, order, nil
+}
+
 func (b *builder) terminal(f reflect.StructField, fullName string) (*Field, *syntax.Regexp, error) {
-	pattern, err := b.extractTag(f.Tag)
+	t := f.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var pattern string
+	var order binary.ByteOrder
+	var err error
+	switch t {
+	case uint16Type:
+		pattern, order, err = b.fixedWidthTag(f, 2)
+	case uint32Type:
+		pattern, order, err = b.fixedWidthTag(f, 4)
+	default:
+		pattern, err = b.extractTag(f.Tag)
+	}
 	if err != nil {
 		return nil, nil, fmt.Errorf("%s: %v", fullName, err)
 	}
@@ -85,7 +197,7 @@ func (b *builder) terminal(f reflect.StructField, fullName string) (*Field, *syn
 	}
 
 	// Parse the pattern
-	expr, err := syntax.Parse(pattern, b.opts.SyntaxFlags)
+	expr, err := b.parse(pattern)
 	if err != nil {
 		return nil, nil, fmt.Errorf(`%s: %v (pattern was "%s")`, fullName, err, f.Tag)
 	}
@@ -96,11 +208,18 @@ func (b *builder) terminal(f reflect.StructField, fullName string) (*Field, *syn
 		return nil, nil, fmt.Errorf(`failed to remove captures from "%s": %v`, pattern, err)
 	}
 
-	// Determine the kind
-	t := f.Type
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
+	// Make the repetitions within the field lazy or greedy if requested
+	switch s := f.Tag.Get("repeat"); s {
+	case "":
+	case "lazy":
+		setGreedy(expr, false)
+	case "greedy":
+		setGreedy(expr, true)
+	default:
+		return nil, nil, fmt.Errorf(`%s: invalid repeat tag "%s"`, fullName, s)
 	}
+
+	// Determine the kind
 	var role Role
 	switch t {
 	case emptyType:
@@ -113,11 +232,28 @@ func (b *builder) terminal(f reflect.StructField, fullName string) (*Field, *syn
 		role = ByteSliceScalarRole
 	case submatchType:
 		role = SubmatchScalarRole
+	case uint16Type:
+		role = Uint16Role
+	case uint32Type:
+		role = Uint32Role
+	}
+
+	// Determine how many edits are allowed within the field, if any
+	maxEdits := 0
+	if s := f.Tag.Get("fuzzy"); s != "" {
+		maxEdits, err = strconv.Atoi(s)
+		if err != nil || maxEdits < 0 {
+			return nil, nil, fmt.Errorf(`%s: invalid fuzzy tag "%s"`, fullName, s)
+		}
 	}
 
 	captureIndex := -1
 	if isExported(f) {
 		captureIndex = b.nextCaptureIndex()
+		b.paths[b.prefix+f.Name] = captureIndex
+		if maxEdits > 0 {
+			b.edits[captureIndex] = maxEdits
+		}
 		expr = &syntax.Regexp{
 			Op:   syntax.OpCapture,
 			Sub:  []*syntax.Regexp{expr},
@@ -129,6 +265,8 @@ func (b *builder) terminal(f reflect.StructField, fullName string) (*Field, *syn
 		index:   f.Index,
 		capture: captureIndex,
 		role:    role,
+		order:   order,
+		lines:   role == SubmatchScalarRole && b.opts.LinePositions,
 	}
 
 	return field, expr, nil
@@ -148,21 +286,43 @@ func (b *builder) pos(f reflect.StructField, fullName string) (*Field, *syntax.R
 		Name: f.Name,
 		Cap:  captureIndex,
 	}
+	role := PosRole
+	if f.Type == linePosType {
+		role = LinePosRole
+	}
 	field := &Field{
 		index:   f.Index,
 		capture: captureIndex,
-		role:    PosRole,
+		role:    role,
 	}
 
 	return field, expr, nil
 }
 
+// whole builds a field of type Match or EndPos, which record the whole
+// match and so add nothing to the expression
+func (b *builder) whole(f reflect.StructField, role Role) (*Field, *syntax.Regexp, error) {
+	if !isExported(f) {
+		return nil, nil, nil
+	}
+	field := &Field{
+		index:   f.Index,
+		capture: 0,
+		role:    role,
+		lines:   role == MatchRole && b.opts.LinePositions,
+	}
+	return field, nil, nil
+}
+
 func (b *builder) nonterminal(f reflect.StructField, fullName string) (*Field, *syntax.Regexp, error) {
 	opstr, err := b.extractTag(f.Tag)
 	if err != nil {
 		return nil, nil, err
 	}
+	prefix := b.prefix
+	b.prefix += f.Name + "."
 	child, expr, err := b.structure(f.Type)
+	b.prefix = prefix
 	if err != nil {
 		return nil, nil, err
 	}
@@ -183,6 +343,7 @@ func (b *builder) nonterminal(f reflect.StructField, fullName string) (*Field, *
 	}
 
 	captureIndex := b.nextCaptureIndex()
+	b.paths[b.prefix+f.Name] = captureIndex
 	expr = &syntax.Regexp{
 		Op:   syntax.OpCapture,
 		Sub:  []*syntax.Regexp{expr},
@@ -202,10 +363,14 @@ func (b *builder) nonterminal(f reflect.StructField, fullName string) (*Field, *
 func (b *builder) field(f reflect.StructField, fullName string) (*Field, *syntax.Regexp, error) {
 	if isScalar(f.Type) {
 		return b.terminal(f, fullName)
+	} else if f.Type == posType || f.Type == linePosType {
+		return b.pos(f, fullName)
+	} else if f.Type == matchType {
+		return b.whole(f, MatchRole)
+	} else if f.Type == endPosType {
+		return b.whole(f, EndPosRole)
 	} else if isStruct(f.Type) {
 		return b.nonterminal(f, fullName)
-	} else if f.Type == posType {
-		return b.pos(f, fullName)
 	}
 	return nil, nil, nil
 }
@@ -222,14 +387,29 @@ func (b *builder) structure(t reflect.Type) (*Struct, *syntax.Regexp, error) {
 	var fields []*Field
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
+		if f.Type == spanType {
+			// A span records the match of the struct itself, so it has no
+			// expression of its own
+			if isExported(f) {
+				fields = append(fields, &Field{
+					index:   f.Index,
+					capture: captureIndex,
+					role:    SpanRole,
+					lines:   b.opts.LinePositions,
+				})
+			}
+			continue
+		}
 		field, expr, err := b.field(f, t.Name()+"."+f.Name)
 		if err != nil {
 			return nil, nil, err
 		}
 		if field != nil {
-			exprs = append(exprs, expr)
 			fields = append(fields, field)
 		}
+		if expr != nil {
+			exprs = append(exprs, expr)
+		}
 	}
 
 	// Wrap in a concat
@@ -252,3 +432,62 @@ func (b *builder) structure(t reflect.Type) (*Struct, *syntax.Regexp, error) {
 
 	return st, expr, nil
 }
+
+// anchor wraps the expression for the root struct in the anchors selected
+// by a
+func anchor(expr *syntax.Regexp, a Anchor) *syntax.Regexp {
+	if a == AnchorNone {
+		return expr
+	}
+	exprs := []*syntax.Regexp{{Op: syntax.OpBeginText}, expr}
+	if a == AnchorBoth {
+		exprs = append(exprs, &syntax.Regexp{Op: syntax.OpEndText})
+	}
+	return &syntax.Regexp{
+		Sub: exprs,
+		Op:  syntax.OpConcat,
+	}
+}
+
+// lint returns warnings about the expression built for the struct type t,
+// before it was anchored by a
+func lint(t reflect.Type, expr *syntax.Regexp, a Anchor) []string {
+	var warnings []string
+	begins := edge(expr, true) == syntax.OpBeginText
+	ends := edge(expr, false) == syntax.OpEndText
+	switch {
+	case begins && a != AnchorNone:
+		warnings = append(warnings, fmt.Sprintf("%s begins with ^, which is redundant since Options.Anchor is set", t.Name()))
+	case begins:
+		warnings = append(warnings, fmt.Sprintf("%s begins with ^, which Options.Anchor can add instead", t.Name()))
+	}
+	switch {
+	case ends && a == AnchorBoth:
+		warnings = append(warnings, fmt.Sprintf("%s ends with $, which is redundant since Options.Anchor is AnchorBoth", t.Name()))
+	case ends:
+		warnings = append(warnings, fmt.Sprintf("%s ends with $, which Options.Anchor can add instead", t.Name()))
+	}
+	return warnings
+}
+
+// edge returns the op of the first or last expression within expr that
+// must match text or an assertion, looking through captures and concats and
+// skipping empty matches such as those of Pos fields
+func edge(expr *syntax.Regexp, first bool) syntax.Op {
+	switch expr.Op {
+	case syntax.OpCapture:
+		return edge(expr.Sub[0], first)
+	case syntax.OpConcat:
+		for i := range expr.Sub {
+			sub := expr.Sub[i]
+			if !first {
+				sub = expr.Sub[len(expr.Sub)-1-i]
+			}
+			if op := edge(sub, first); op != syntax.OpEmptyMatch {
+				return op
+			}
+		}
+		return syntax.OpEmptyMatch
+	}
+	return expr.Op
+}
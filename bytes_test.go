@@ -0,0 +1,92 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type PacketHeader struct {
+	_       struct{} `^\x7fPK`
+	Version uint16   `endian:"big"`
+	Length  uint32   `endian:"little"`
+	Kind    string   `regexp:"[\\x80-\\xff]"`
+	Payload []byte   `(?s:.*)`
+}
+
+func TestBytes_BinaryHeader(t *testing.T) {
+	pattern := MustCompile(PacketHeader{}, Options{Bytes: true})
+
+	var h PacketHeader
+	require.True(t, pattern.Find(&h, "\x7fPK\x00\x02\x10\x01\x00\x00\xc3\n\xff\x00"))
+	assert.Equal(t, uint16(2), h.Version)
+	assert.Equal(t, uint32(0x110), h.Length)
+	assert.Equal(t, "\xc3", h.Kind)
+	assert.Equal(t, []byte("\n\xff\x00"), h.Payload)
+
+	// too short for the header
+	assert.False(t, pattern.Find(&h, "\x7fPK\x00\x02\x10"))
+}
+
+func TestBytes_EachByteIsOneCharacter(t *testing.T) {
+	type Pair struct {
+		First  string `^.`
+		Second string `.$`
+	}
+	var p Pair
+	assert.False(t, MustCompile(Pair{}, Options{}).Find(&p, "é"))
+
+	require.True(t, MustCompile(Pair{}, Options{Bytes: true}).Find(&p, "é"))
+	assert.Equal(t, Pair{First: "\xc3", Second: "\xa9"}, p)
+}
+
+func TestBytes_Latin1Literal(t *testing.T) {
+	type Word struct {
+		Word string `caf\xe9|é+`
+	}
+	pattern := MustCompile(Word{}, Options{Bytes: true})
+	var words []Word
+	pattern.FindAll(&words, "un caf\xe9, \xe9\xe9t\xe9 café", -1)
+	assert.Equal(t, []Word{{"caf\xe9"}, {"\xe9\xe9"}, {"\xe9"}}, words)
+}
+
+func TestBytes_PointerField(t *testing.T) {
+	type Header struct {
+		Size *uint32 `endian:"big"`
+	}
+	pattern := MustCompile(Header{}, Options{Bytes: true})
+	var h Header
+	require.True(t, pattern.Find(&h, "\x00\x00\x01\x00"))
+	require.NotNil(t, h.Size)
+	assert.Equal(t, uint32(256), *h.Size)
+}
+
+func TestBytes_UntaggedIntegersIgnored(t *testing.T) {
+	type Record struct {
+		Name  string `\w+`
+		Count uint16
+		Size  uint32
+	}
+	pattern, err := Compile(Record{}, Options{})
+	require.NoError(t, err)
+	var r Record
+	require.True(t, pattern.Find(&r, "abc"))
+	assert.Equal(t, Record{Name: "abc"}, r)
+
+	pattern, err = Compile(Record{}, Options{Bytes: true})
+	require.NoError(t, err)
+	require.True(t, pattern.Find(&r, "abc\x00\x01"))
+	assert.Equal(t, Record{Name: "abc"}, r)
+}
+
+func TestBytes_Errors(t *testing.T) {
+	_, err := Compile(PacketHeader{}, Options{})
+	assert.Error(t, err)
+
+	type BadEndian struct {
+		Size uint16 `endian:"middle"`
+	}
+	_, err = Compile(BadEndian{}, Options{Bytes: true})
+	assert.Error(t, err)
+}
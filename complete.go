@@ -0,0 +1,64 @@
+package restructure
+
+import (
+	"reflect"
+	"regexp/syntax"
+)
+
+// A Completion describes text that could come next after a partial input
+type Completion struct {
+	// Field is the path of the innermost field that the text would belong
+	// to, such as "Host.TLD", or "" if it would not belong to any named field
+	Field string
+	// Literal is the text that must come next, if it can only be one thing
+	// until the end of the field
+	Literal string
+	// Next describes the characters that could come next, as a character
+	// class such as "[0-9]"
+	Next string
+}
+
+// Complete determines what could come next after s in a match that begins at
+// the start of s, which is useful for suggesting completions as input is
+// typed. It returns one Completion for each distinct way in which the match
+// could continue, in priority order, or nil if no match could continue past
+// the end of s.
+func (r *Regexp) Complete(s string) []Completion {
+	paths := make(map[int]string)
+	fieldPaths(r.st, r.t, "", paths)
+
+	var out []Completion
+	seen := make(map[Completion]bool)
+	for _, c := range r.fork("Complete").Continuations(s) {
+		next := &syntax.Regexp{Op: syntax.OpCharClass, Rune: c.Runes}
+		completion := Completion{
+			Field:   paths[c.Group],
+			Literal: c.Literal,
+			Next:    next.String(),
+		}
+		if !seen[completion] {
+			seen[completion] = true
+			out = append(out, completion)
+		}
+	}
+	return out
+}
+
+// fieldPaths records the dotted path of each field in st under the index of
+// its capture
+func fieldPaths(st *Struct, t reflect.Type, prefix string, paths map[int]string) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, field := range st.fields {
+		f := t.FieldByIndex(field.index)
+		path := prefix + f.Name
+		if field.capture >= 0 {
+			paths[field.capture] = path
+		}
+		if field.child != nil {
+			paths[field.child.capture] = path
+			fieldPaths(field.child, f.Type, path+".", paths)
+		}
+	}
+}
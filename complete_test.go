@@ -0,0 +1,58 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type LoginCommand struct {
+	_    struct{}  `^`
+	User string    `[a-z]+`
+	_    struct{}  `@`
+	Host *HostName `?`
+	_    struct{}  `$`
+}
+
+type HostName struct {
+	Domain string   `\w+`
+	_      struct{} `\.`
+	TLD    string   `com|org`
+}
+
+func TestComplete_Literal(t *testing.T) {
+	pattern := MustCompile(LoginCommand{}, Options{})
+	assert.Equal(t, []Completion{
+		{Field: "User", Next: "[a-z]"},
+		{Literal: "@", Next: "[@]"},
+	}, pattern.Complete("joe"))
+}
+
+func TestComplete_NestedField(t *testing.T) {
+	pattern := MustCompile(LoginCommand{}, Options{})
+	assert.Equal(t, []Completion{
+		{Field: "Host.Domain", Next: `[0-9A-Z_a-z]`},
+	}, pattern.Complete("joe@"))
+}
+
+func TestComplete_Alternatives(t *testing.T) {
+	pattern := MustCompile(LoginCommand{}, Options{})
+	assert.Equal(t, []Completion{
+		{Field: "Host.TLD", Literal: "com", Next: "[c]"},
+		{Field: "Host.TLD", Literal: "org", Next: "[o]"},
+	}, pattern.Complete("joe@example."))
+}
+
+func TestComplete_StructLiteral(t *testing.T) {
+	pattern := MustCompile(LoginCommand{}, Options{})
+	assert.Equal(t, []Completion{
+		{Field: "Host.Domain", Next: `[0-9A-Z_a-z]`},
+		{Field: "Host", Literal: ".", Next: `[\.]`},
+	}, pattern.Complete("joe@example"))
+}
+
+func TestComplete_Invalid(t *testing.T) {
+	pattern := MustCompile(LoginCommand{}, Options{})
+	assert.Nil(t, pattern.Complete("joe!"))
+	assert.Nil(t, pattern.Complete("joe@example.com"))
+}
@@ -0,0 +1,77 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Setting struct {
+	Name  string   `\b\w+`
+	_     struct{} `=`
+	Value string   `[^;]*`
+	_     struct{} `;\s*`
+}
+
+func TestConsume(t *testing.T) {
+	pattern := MustCompile(Setting{}, Options{})
+	var names, values []string
+	rest := "a=1; bb=two;c=;"
+	for rest != "" {
+		var s Setting
+		var ok bool
+		rest, ok = pattern.Consume(&s, rest)
+		require.True(t, ok, rest)
+		names = append(names, s.Name)
+		values = append(values, s.Value)
+	}
+	assert.Equal(t, []string{"a", "bb", "c"}, names)
+	assert.Equal(t, []string{"1", "two", ""}, values)
+}
+
+func TestConsume_NoMatchAtStart(t *testing.T) {
+	pattern := MustCompile(Setting{}, Options{})
+	s := Setting{Name: "unchanged"}
+	rest, ok := pattern.Consume(&s, " a=1;")
+	assert.False(t, ok)
+	assert.Equal(t, " a=1;", rest)
+	assert.Equal(t, "unchanged", s.Name)
+}
+
+func TestConsume_StdlibEngine(t *testing.T) {
+	pattern := MustCompile(Setting{}, Options{Engine: StdlibEngine})
+	var s Setting
+	rest, ok := pattern.Consume(&s, "a=1;b=2;")
+	require.True(t, ok)
+	assert.Equal(t, "b=2;", rest)
+	assert.Equal(t, "a", s.Name)
+
+	_, ok = pattern.Consume(&s, "!a=1;")
+	assert.False(t, ok)
+}
+
+type SettingPos struct {
+	Begin Pos
+	Setting
+}
+
+func TestFindAt(t *testing.T) {
+	pattern := MustCompile(SettingPos{}, Options{})
+	var s SettingPos
+
+	// The match is not allowed to begin in the middle of "xa"
+	require.True(t, pattern.FindAt(&s, "xa=1; b=2;", 1))
+	assert.Equal(t, "b", s.Name)
+	assert.Equal(t, Pos(6), s.Begin)
+
+	require.True(t, pattern.FindAt(&s, "a=1; b=2;", 0))
+	assert.Equal(t, "a", s.Name)
+	assert.False(t, pattern.FindAt(&s, "a=1; b=2;", 7))
+}
+
+func TestFindAt_StdlibEngine(t *testing.T) {
+	pattern := MustCompile(Setting{}, Options{Engine: StdlibEngine})
+	var s Setting
+	assert.Panics(t, func() { pattern.FindAt(&s, "a=1;", 0) })
+}
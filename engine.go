@@ -0,0 +1,167 @@
+package restructure
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"regexp/syntax"
+
+	"github.com/alexflint/go-restructure/regex"
+)
+
+// An Engine compiles the regular expressions built from struct types into
+// Matchers. Options.Engine selects the engine to use, which is ForkEngine
+// unless set.
+type Engine interface {
+	// Compile compiles the syntax tree built from a struct type. The tree
+	// contains a capture for the struct itself and for each of its fields,
+	// whose Cap indices are not necessarily in the order in which they
+	// appear. If longest is true then the Matcher must use leftmost-longest
+	// semantics, and otherwise leftmost-first semantics.
+	Compile(expr *syntax.Regexp, longest bool) (Matcher, error)
+}
+
+// A Matcher is a regular expression compiled by an Engine. Its methods are
+// like those of regexp.Regexp, except that the indices they return are
+// ordered by the Cap indices in the syntax tree it was compiled from.
+type Matcher interface {
+	FindSubmatchIndex(b []byte) []int
+	FindAllSubmatchIndex(b []byte, n int) [][]int
+	FindReaderSubmatchIndex(r io.RuneReader) []int
+	String() string
+}
+
+var (
+	// ForkEngine compiles regular expressions with the regex package in
+	// this module, which is forked from the standard library's regexp
+	// package. It supports every option, and is the default.
+	ForkEngine Engine = forkEngine{}
+
+	// StdlibEngine compiles regular expressions with the standard library's
+	// regexp package. It cannot be used with the options that only the
+	// fork supports, such as MaxSteps, ExtendedSyntax, MaxEdits, Bytes,
+	// UnicodeWordBoundaries, CRLF or Strategies, nor with CompileSet,
+	// FindLast, FindPartial or Complete.
+	StdlibEngine Engine = stdlibEngine{}
+)
+
+type forkEngine struct{}
+
+func (forkEngine) Compile(expr *syntax.Regexp, longest bool) (Matcher, error) {
+	re, err := regex.CompileSyntax(expr)
+	if err != nil {
+		return nil, err
+	}
+	if longest {
+		re.Longest()
+	}
+	return re, nil
+}
+
+type stdlibEngine struct{}
+
+func (stdlibEngine) Compile(expr *syntax.Regexp, longest bool) (Matcher, error) {
+	// The standard library can only compile the syntax tree from its string
+	// form, after which the captures are numbered in order of appearance
+	var caps []int
+	numCap := captureOrder(expr, &caps)
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	if re.NumSubexp() != len(caps) {
+		return nil, fmt.Errorf("expected %d captures in %s but found %d", len(caps), re, re.NumSubexp())
+	}
+	if longest {
+		re.Longest()
+	}
+	return &stdlibMatcher{re: re, caps: caps, numCap: numCap}, nil
+}
+
+// captureOrder appends the Cap index of each capture in expr to caps, in
+// the order in which they appear, and returns the number of captures needed
+// to hold all of them, including the whole match
+func captureOrder(expr *syntax.Regexp, caps *[]int) int {
+	n := 1
+	if expr.Op == syntax.OpCapture {
+		*caps = append(*caps, expr.Cap)
+		n = expr.Cap + 1
+	}
+	for _, sub := range expr.Sub {
+		if m := captureOrder(sub, caps); m > n {
+			n = m
+		}
+	}
+	return n
+}
+
+// stdlibMatcher is a Matcher compiled by StdlibEngine
+type stdlibMatcher struct {
+	re     *regexp.Regexp
+	caps   []int // Cap index of each subexpression of re
+	numCap int
+}
+
+// reorder converts the indices of a match of re into the Cap order
+func (m *stdlibMatcher) reorder(indices []int) []int {
+	if indices == nil {
+		return nil
+	}
+	out := make([]int, 2*m.numCap)
+	for i := range out {
+		out[i] = -1
+	}
+	out[0], out[1] = indices[0], indices[1]
+	for k, c := range m.caps {
+		out[2*c], out[2*c+1] = indices[2*k+2], indices[2*k+3]
+	}
+	return out
+}
+
+func (m *stdlibMatcher) FindSubmatchIndex(b []byte) []int {
+	return m.reorder(m.re.FindSubmatchIndex(b))
+}
+
+func (m *stdlibMatcher) FindAllSubmatchIndex(b []byte, n int) [][]int {
+	matches := m.re.FindAllSubmatchIndex(b, n)
+	for i, indices := range matches {
+		matches[i] = m.reorder(indices)
+	}
+	return matches
+}
+
+func (m *stdlibMatcher) FindReaderSubmatchIndex(r io.RuneReader) []int {
+	return m.reorder(m.re.FindReaderSubmatchIndex(r))
+}
+
+func (m *stdlibMatcher) String() string {
+	return m.re.String()
+}
+
+// checkEngine returns an error if opts select features that are only
+// supported by ForkEngine while selecting another engine
+func checkEngine(opts Options, fuzzy bool) error {
+	if _, ok := opts.Engine.(forkEngine); ok || opts.Engine == nil {
+		return nil
+	}
+	var feature string
+	switch {
+	case opts.MaxSteps != 0:
+		feature = "MaxSteps"
+	case opts.ExtendedSyntax:
+		feature = "ExtendedSyntax"
+	case fuzzy:
+		feature = "approximate matching"
+	case opts.Bytes:
+		feature = "Bytes"
+	case opts.UnicodeWordBoundaries:
+		feature = "UnicodeWordBoundaries"
+	case opts.CRLF:
+		feature = "CRLF"
+	case opts.Strategies != 0 || opts.ForbidStrategies != 0 || opts.MaxBacktrackVector != 0:
+		feature = "selecting strategies"
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s is only supported by ForkEngine", feature)
+}
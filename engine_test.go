@@ -0,0 +1,190 @@
+package restructure
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The structs from the samples directory that are not already used by
+// other tests
+
+type FloatPos struct {
+	Begin    Pos
+	Sign     *Sign     `?`
+	Whole    string    `[0-9]*`
+	Period   struct{}  `\.?`
+	Frac     string    `[0-9]+`
+	Exponent *Exponent `?`
+	End      Pos
+}
+
+type NestedEmail struct {
+	_    struct{} `^`
+	User string   `[a-zA-Z0-9._%+-]+`
+	_    struct{} `@`
+	Host *HostName
+	_    struct{} `$`
+}
+
+type SignedInt struct {
+	Sign string `regexp:"[+-]"`
+	Real string `regexp:"[0-9]+"`
+}
+
+type RealPart struct {
+	Sign string `regexp:"[+-]?"`
+	Real string `regexp:"[0-9]+"`
+}
+
+type IPart struct {
+	Magnitude SignedInt
+	_         struct{} `regexp:"i"`
+}
+
+type JPart struct {
+	Magnitude SignedInt
+	_         struct{} `regexp:"j"`
+}
+
+type KPart struct {
+	Magnitude SignedInt
+	_         struct{} `regexp:"k"`
+}
+
+type Quaternion struct {
+	Real *RealPart
+	I    *IPart `regexp:"?"`
+	J    *JPart `regexp:"?"`
+	K    *KPart `regexp:"?"`
+}
+
+type QuotedQuaternion struct {
+	_          struct{} `regexp:"^"`
+	_          struct{} `regexp:"\""`
+	Quaternion *Quaternion
+	_          struct{} `regexp:"\""`
+	_          struct{} `regexp:"$"`
+}
+
+var engineTestCases = []struct {
+	proto  interface{}
+	inputs []string
+}{
+	{Float{}, []string{"1.23", "1.23e+45", ".123", "12e3", "-12.3E+5", "x", "", "1.2.3 and 4e-5"}},
+	{FloatPos{}, []string{"crisis of 2007–08, was 9.8% (16% in 2009)", "$2 per day", "3.5 times"}},
+	{EmailAddress{}, []string{"joe@example.com", "joe@", "a.b+c@d@e", "@x"}},
+	{NestedEmail{}, []string{"joe@example.com", "joe@example.net", "joe@example"}},
+	{Import{}, []string{"import foo", "import foo as bar", "import  foo  as  bar ", "from foo"}},
+	{DotExpr{}, []string{"foo", "foo.bar", "foo.", ".bar", ""}},
+	{DotExprPos{}, []string{"foo", "foo.bar", "foo.bar.baz"}},
+	{QuotedQuaternion{}, []string{`"1+2i+3j+4k"`, `"-1+2k"`, `"-1"`, `"3-4k"`, `"12+34i"`, `"i"`, `1+2i`}},
+	{Assignment{}, []string{"x=y=z", "=", "key=", "no equals"}},
+	{Alternative{}, []string{"abc", "ab", "a", "b"}},
+	{URL{}, []string{"http://example.com/x", "://x", "ftp://"}},
+	{PhoneNumber{}, []string{"555-1234", "555-12345", "55-1234"}},
+}
+
+// findWithEngine runs each of the find methods of a pattern compiled with
+// the given options and returns the results
+func findWithEngine(t *testing.T, proto interface{}, opts Options, input string) []interface{} {
+	pattern, err := Compile(proto, opts)
+	require.NoError(t, err)
+	typ := reflect.TypeOf(proto)
+
+	first := reflect.New(typ)
+	found := pattern.Find(first.Interface(), input)
+
+	all := reflect.New(reflect.SliceOf(typ))
+	pattern.FindAll(all.Interface(), input, -1)
+
+	appended := reflect.New(reflect.SliceOf(reflect.PtrTo(typ)))
+	pattern.AppendAll(appended.Interface(), input, 2)
+
+	fromReader := reflect.New(typ)
+	foundInReader := pattern.FindReader(fromReader.Interface(), strings.NewReader(input))
+
+	return []interface{}{
+		found, first.Interface(),
+		all.Interface(),
+		appended.Interface(),
+		foundInReader, fromReader.Interface(),
+	}
+}
+
+func TestEngine_StdlibMatchesFork(t *testing.T) {
+	for _, longest := range []bool{false, true} {
+		for _, test := range engineTestCases {
+			for _, input := range test.inputs {
+				fork := findWithEngine(t, test.proto, Options{Longest: longest}, input)
+				stdlib := findWithEngine(t, test.proto, Options{Longest: longest, Engine: StdlibEngine}, input)
+				assert.Equal(t, fork, stdlib, "%T on %q with Longest=%v", test.proto, input, longest)
+			}
+		}
+	}
+}
+
+func TestEngine_Stdlib(t *testing.T) {
+	pattern := MustCompile(NestedEmail{}, Options{Engine: StdlibEngine})
+	var email NestedEmail
+	require.True(t, pattern.Find(&email, "joe@example.com"))
+	assert.Equal(t, "joe", email.User)
+	assert.Equal(t, &HostName{Domain: "example", TLD: "com"}, email.Host)
+	assert.Contains(t, pattern.Describe(), "engine: restructure.stdlibEngine\n")
+
+	assert.Panics(t, func() { pattern.FindLast(&email, "joe@example.com") })
+	assert.Panics(t, func() { pattern.Complete("joe@") })
+}
+
+func TestEngine_StdlibUnsupportedOptions(t *testing.T) {
+	for _, opts := range []Options{
+		{MaxSteps: 100},
+		{ExtendedSyntax: true},
+		{MaxEdits: 1},
+		{Bytes: true},
+		{UnicodeWordBoundaries: true},
+		{CRLF: true},
+		{MaxBacktrackVector: 100},
+	} {
+		opts.Engine = StdlibEngine
+		_, err := Compile(Float{}, opts)
+		assert.Error(t, err, "%+v", opts)
+	}
+
+	_, err := Compile(Invoice{}, Options{Engine: StdlibEngine})
+	assert.EqualError(t, err, "approximate matching is only supported by ForkEngine")
+
+	_, err = CompileSet([]interface{}{Float{}}, Options{Engine: StdlibEngine})
+	assert.Error(t, err)
+}
+
+// Quoted matches text between double quotes
+type Quoted struct {
+	_    struct{} `"`
+	Text string   `[^"]*`
+	_    struct{} `"`
+}
+
+func TestEngine_FindReaderInvalidUTF8(t *testing.T) {
+	pattern := MustCompile(Quoted{}, Options{})
+	var q Quoted
+	require.True(t, pattern.FindReader(&q, strings.NewReader("say \"caf\xe9 \xe2\x82\"")))
+	assert.Equal(t, "caf\xe9 \xe2\x82", q.Text)
+
+	require.True(t, pattern.FindReader(&q, bufio.NewReader(strings.NewReader("\"\xc0\xaf\"x"))))
+	assert.Equal(t, "\xc0\xaf", q.Text)
+}
+
+func TestEngine_FindReader(t *testing.T) {
+	pattern := MustCompile(Float{}, Options{})
+	var f Float
+	require.True(t, pattern.FindReader(&f, strings.NewReader("pi is 3.14159, e is 2.71828")))
+	assert.Equal(t, "3", f.Whole)
+	assert.Equal(t, "14159", f.Frac)
+
+	assert.False(t, pattern.FindReader(&f, strings.NewReader("no numbers")))
+}
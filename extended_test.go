@@ -0,0 +1,117 @@
+package restructure
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type QuotedString struct {
+	Open  string `["']`
+	Text  string `[^"']*`
+	Close string `\k<Open>`
+}
+
+func TestExtended_Backref(t *testing.T) {
+	pattern := MustCompile(QuotedString{}, Options{ExtendedSyntax: true})
+
+	var q QuotedString
+	require.True(t, pattern.Find(&q, `say "it's" or 'no'`))
+	assert.Equal(t, QuotedString{Open: `'`, Text: "no", Close: `'`}, q)
+
+	var all []QuotedString
+	pattern.FindAll(&all, `"a" 'b' "c'`, -1)
+	assert.Equal(t, []QuotedString{
+		{Open: `"`, Text: "a", Close: `"`},
+		{Open: `'`, Text: "b", Close: `'`},
+	}, all)
+}
+
+func TestExtended_MatchingTags(t *testing.T) {
+	type Element struct {
+		_    struct{} `<`
+		Tag  string   `\w+`
+		_    struct{} `>`
+		Body string   `[^<]*`
+		_    struct{} `</\k<Tag>>`
+	}
+	pattern := MustCompile(Element{}, Options{ExtendedSyntax: true})
+	var e Element
+	require.True(t, pattern.Find(&e, "<b>bold</i> <i>italic</i>"))
+	assert.Equal(t, Element{Tag: "i", Body: "italic"}, e)
+}
+
+type Repeated struct {
+	First  string   `\w+`
+	_      struct{} `\s+`
+	Second *Echo
+}
+
+type Echo struct {
+	Word string `\k<First>`
+}
+
+func TestExtended_BackrefFromChild(t *testing.T) {
+	pattern := MustCompile(Repeated{}, Options{ExtendedSyntax: true})
+	var r Repeated
+	require.True(t, pattern.Find(&r, "this is is a test"))
+	assert.Equal(t, "is", r.First)
+	assert.Equal(t, "is", r.Second.Word)
+}
+
+type Price struct {
+	Amount string `(?<=\$)\d+(?!\d*%)`
+}
+
+func TestExtended_Lookaround(t *testing.T) {
+	pattern := MustCompile(Price{}, Options{ExtendedSyntax: true})
+	var prices []Price
+	pattern.FindAll(&prices, "100 $20 $35% $7", -1)
+	assert.Equal(t, []Price{{"20"}, {"7"}}, prices)
+}
+
+func TestExtended_Atomic(t *testing.T) {
+	type Word struct {
+		Letters string `(?>\w+)`
+		End     string `s`
+	}
+	pattern := MustCompile(Word{}, Options{ExtendedSyntax: true})
+	var w Word
+	assert.False(t, pattern.Find(&w, "cats"))
+}
+
+func TestExtended_Budget(t *testing.T) {
+	type Pathological struct {
+		A string `(a|aa)*`
+		B string `\k<A>b`
+	}
+	pattern := MustCompile(Pathological{}, Options{ExtendedSyntax: true, MaxSteps: 10000})
+	var p Pathological
+	_, err := pattern.FindContext(context.Background(), &p, strings.Repeat("a", 40))
+	assert.Equal(t, ErrBudgetExceeded, err)
+}
+
+func TestExtended_RequiresOption(t *testing.T) {
+	_, err := Compile(QuotedString{}, Options{})
+	assert.Error(t, err)
+}
+
+func TestExtended_UnknownField(t *testing.T) {
+	type Bad struct {
+		A string `\k<B>`
+		B string `\w`
+	}
+	_, err := Compile(Bad{}, Options{ExtendedSyntax: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `\k<B> does not refer to an earlier field`)
+}
+
+func TestExtended_PlainPatternsUnchanged(t *testing.T) {
+	pattern := MustCompile(DotName{}, Options{ExtendedSyntax: true})
+	var v DotName
+	require.True(t, pattern.Find(&v, "abc.def"))
+	assert.Equal(t, DotName{Dot: ".", Name: "def"}, v)
+}
@@ -0,0 +1,150 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Invoice struct {
+	_      struct{} `^`
+	Label  Submatch `regexp:"INVOICE" fuzzy:"2"`
+	_      struct{} `\s+`
+	Number Submatch `regexp:"\\d+"`
+	_      struct{} `$`
+}
+
+func TestFuzzy_FieldTag(t *testing.T) {
+	pattern := MustCompile(Invoice{}, Options{})
+
+	var inv Invoice
+	require.True(t, pattern.Find(&inv, "INVOICE 1234"))
+	assert.Equal(t, "INVOICE", inv.Label.String())
+	assert.Equal(t, 0, inv.Label.Edits)
+
+	require.True(t, pattern.Find(&inv, "1NV0ICE 1234"))
+	assert.Equal(t, "1NV0ICE", inv.Label.String())
+	assert.Equal(t, 2, inv.Label.Edits)
+	assert.Equal(t, "1234", inv.Number.String())
+	assert.Equal(t, 0, inv.Number.Edits)
+
+	require.True(t, pattern.Find(&inv, "INVOCE 1234"))
+	assert.Equal(t, 1, inv.Label.Edits)
+
+	// too many edits
+	assert.False(t, pattern.Find(&inv, "1NV0IC3 1234"))
+
+	// no edits allowed outside the tagged field
+	assert.False(t, pattern.Find(&inv, "INVOICE 12a4"))
+}
+
+type Identifier struct {
+	Prefix Submatch `regexp:"user_"`
+	ID     Submatch `regexp:"[0-9]{4}"`
+}
+
+func TestFuzzy_MaxEdits(t *testing.T) {
+	pattern := MustCompile(Identifier{}, Options{MaxEdits: 1})
+
+	var id Identifier
+	require.True(t, pattern.Find(&id, "see usr_1234"))
+	assert.Equal(t, "usr_", id.Prefix.String())
+	assert.Equal(t, 1, id.Prefix.Edits)
+	assert.Equal(t, "1234", id.ID.String())
+	assert.Equal(t, 0, id.ID.Edits)
+
+	// the leftmost match wins even if an exact one is further right
+	require.True(t, pattern.Find(&id, "usr_1234 user_5678"))
+	assert.Equal(t, "usr_", id.Prefix.String())
+	assert.Equal(t, "1234", id.ID.String())
+	assert.Equal(t, 1, id.Prefix.Edits)
+
+	var ids []Identifier
+	pattern.FindAll(&ids, "user_1234 uxer_5678 ab_9", -1)
+	require.Len(t, ids, 2)
+	assert.Equal(t, "uxer_", ids[1].Prefix.String())
+	assert.Equal(t, 1, ids[1].Prefix.Edits)
+
+	assert.False(t, pattern.Find(&id, "usr_12a4"))
+}
+
+type Greeting struct {
+	Word Submatch `regexp:"hello"`
+}
+
+func TestFuzzy_FindAllLeftmost(t *testing.T) {
+	pattern := MustCompile(Greeting{}, Options{MaxEdits: 1})
+	var greetings []Greeting
+	pattern.FindAll(&greetings, "helo world hello", -1)
+	require.Len(t, greetings, 2)
+	assert.Equal(t, "helo", greetings[0].Word.String())
+	assert.Equal(t, 0, int(greetings[0].Word.Begin))
+	assert.Equal(t, 1, greetings[0].Word.Edits)
+	assert.Equal(t, "hello", greetings[1].Word.String())
+	assert.Equal(t, 11, int(greetings[1].Word.Begin))
+	assert.Equal(t, 0, greetings[1].Word.Edits)
+
+	// among matches that begin in the same place the fewest edits win
+	var g Greeting
+	require.True(t, pattern.Find(&g, "hello!"))
+	assert.Equal(t, "hello", g.Word.String())
+	assert.Equal(t, 0, g.Word.Edits)
+}
+
+func TestFuzzy_EditsFromEveryMethod(t *testing.T) {
+	pattern := MustCompile(Greeting{}, Options{MaxEdits: 1})
+	input := "helo world hello hallo"
+
+	var edits []int
+	pattern.FindEach(&Greeting{}, input, func(dest interface{}) bool {
+		edits = append(edits, dest.(*Greeting).Word.Edits)
+		return true
+	})
+	assert.Equal(t, []int{1, 0, 1}, edits)
+
+	var greetings []*Greeting
+	pattern.AppendAll(&greetings, input, -1)
+	require.Len(t, greetings, 3)
+	assert.Equal(t, 1, greetings[2].Word.Edits)
+
+	var g Greeting
+	require.True(t, pattern.FindAt(&g, input, 1))
+	assert.Equal(t, "hello", g.Word.String())
+	assert.Equal(t, 0, g.Word.Edits)
+
+	require.True(t, pattern.FindLast(&g, input))
+	assert.Equal(t, "hallo", g.Word.String())
+	assert.Equal(t, 1, g.Word.Edits)
+
+	rest, ok := pattern.Consume(&g, input)
+	require.True(t, ok)
+	assert.Equal(t, " world hello hallo", rest)
+	assert.Equal(t, 1, g.Word.Edits)
+
+	results := pattern.FindBatch([]string{"hello", "hullo", "xyz"}, &greetings)
+	assert.Equal(t, []BatchResult{{Matched: true}, {Matched: true}, {}}, results)
+	assert.Equal(t, 0, greetings[0].Word.Edits)
+	assert.Equal(t, 1, greetings[1].Word.Edits)
+}
+
+func TestFuzzy_Disabled(t *testing.T) {
+	pattern := MustCompile(Identifier{}, Options{})
+	var id Identifier
+	assert.False(t, pattern.Find(&id, "usr_1234"))
+	require.True(t, pattern.Find(&id, "user_1234"))
+	assert.Equal(t, 0, id.Prefix.Edits)
+}
+
+func TestFuzzy_InvalidTag(t *testing.T) {
+	type Bad struct {
+		Word string `regexp:"\\w+" fuzzy:"x"`
+	}
+	_, err := Compile(Bad{}, Options{})
+	assert.Error(t, err)
+}
+
+func TestFuzzy_NotInSet(t *testing.T) {
+	_, err := CompileSet([]interface{}{Identifier{}}, Options{MaxEdits: 1})
+	assert.Error(t, err)
+}
@@ -7,19 +7,27 @@ import (
 )
 
 var (
-	posType = reflect.TypeOf(Pos(0))
+	posType     = reflect.TypeOf(Pos(0))
+	linePosType = reflect.TypeOf(LinePos{})
+	spanType    = reflect.TypeOf(Span{})
+	matchType   = reflect.TypeOf(Match{})
+	endPosType  = reflect.TypeOf(EndPos(0))
 
 	emptyType     = reflect.TypeOf(struct{}{})
 	stringType    = reflect.TypeOf("")
 	intType       = reflect.TypeOf(1)
 	byteSliceType = reflect.TypeOf([]byte{})
 	submatchType  = reflect.TypeOf(Submatch{})
+	uint16Type    = reflect.TypeOf(uint16(0))
+	uint32Type    = reflect.TypeOf(uint32(0))
 	scalarTypes   = []reflect.Type{
 		emptyType,
 		stringType,
 		intType,
 		byteSliceType,
 		submatchType,
+		uint16Type,
+		uint32Type,
 	}
 )
 
@@ -56,7 +64,8 @@ func ensureAlloc(dest reflect.Value) reflect.Value {
 }
 
 // inflate the results of a match into a string
-func inflateScalar(dest reflect.Value, match *match, captureIndex int, role Role) error {
+func inflateScalar(dest reflect.Value, match *match, field *Field) error {
+	captureIndex := field.capture
 	if captureIndex == -1 {
 		// This means the field generated a regex but we did not want the results
 		return nil
@@ -76,12 +85,16 @@ func inflateScalar(dest reflect.Value, match *match, captureIndex int, role Role
 	dest = ensureAlloc(dest)
 
 	// Deal with each recognized type
-	switch role {
+	switch field.role {
 	case StringScalarRole:
 		dest.SetString(string(buf))
 		return nil
 	case IntScalarRole:
 		if intVal, err := strconv.Atoi(string(buf)); err != nil {
+			if match.partial {
+				// The number has not been fully typed yet
+				return nil
+			}
 			return fmt.Errorf("unable to capture into %s", dest.Type().String())
 		} else {
 			dest.SetInt(int64(intVal))
@@ -95,13 +108,20 @@ func inflateScalar(dest reflect.Value, match *match, captureIndex int, role Role
 		submatch.Begin = Pos(subcapture.begin)
 		submatch.End = Pos(subcapture.end)
 		submatch.Bytes = buf
+		if match.edits != nil {
+			submatch.Edits = match.edits[captureIndex]
+		}
+		if field.lines {
+			submatch.lines = match.lineIndex()
+		}
 		return nil
 	}
 	return fmt.Errorf("unable to capture into %s", dest.Type().String())
 }
 
-// inflate the position of a match into a Pos
-func inflatePos(dest reflect.Value, match *match, captureIndex int) error {
+// inflate the position of a match into a Pos or LinePos
+func inflatePos(dest reflect.Value, match *match, field *Field) error {
+	captureIndex := field.capture
 	if captureIndex == -1 {
 		// This means the field generated a regex but we did not want the results
 		return nil
@@ -114,11 +134,36 @@ func inflatePos(dest reflect.Value, match *match, captureIndex int) error {
 		return nil
 	}
 
-	// If dest is a nil pointer then allocate a new instance and assign the pointer to dest
+	if field.role == LinePosRole {
+		dest.Set(reflect.ValueOf(match.lineIndex().LinePos(Pos(subcapture.begin))))
+		return nil
+	}
 	dest.SetInt(int64(subcapture.begin))
 	return nil
 }
 
+// inflate a fixed-width binary integer into a uint16 or uint32
+func inflateFixedWidth(dest reflect.Value, match *match, field *Field) error {
+	if field.capture == -1 {
+		return nil
+	}
+	subcapture := match.captures[field.capture]
+	if !subcapture.wasMatched() {
+		return nil
+	}
+	buf := match.input[subcapture.begin:subcapture.end]
+	dest = ensureAlloc(dest)
+	switch {
+	case field.role == Uint16Role && len(buf) == 2:
+		dest.SetUint(uint64(field.order.Uint16(buf)))
+		return nil
+	case field.role == Uint32Role && len(buf) == 4:
+		dest.SetUint(uint64(field.order.Uint32(buf)))
+		return nil
+	}
+	return fmt.Errorf("unable to capture %d bytes into %s", len(buf), dest.Type().String())
+}
+
 // inflate the results of a match into a struct
 func inflateStruct(dest reflect.Value, match *match, structure *Struct) error {
 	// Get the subcapture for this field
@@ -133,16 +178,42 @@ func inflateStruct(dest reflect.Value, match *match, structure *Struct) error {
 	// Inflate values into the struct fields
 	for _, field := range structure.fields {
 		switch field.role {
-		case PosRole:
+		case PosRole, LinePosRole:
 			val := dest.FieldByIndex(field.index)
-			if err := inflatePos(val, match, field.capture); err != nil {
+			if err := inflatePos(val, match, field); err != nil {
 				return err
 			}
 		case StringScalarRole, ByteSliceScalarRole, SubmatchScalarRole, IntScalarRole:
 			val := dest.FieldByIndex(field.index)
-			if err := inflateScalar(val, match, field.capture, field.role); err != nil {
+			if err := inflateScalar(val, match, field); err != nil {
 				return err
 			}
+		case Uint16Role, Uint32Role:
+			val := dest.FieldByIndex(field.index)
+			if err := inflateFixedWidth(val, match, field); err != nil {
+				return err
+			}
+		case SpanRole:
+			span := dest.FieldByIndex(field.index).Addr().Interface().(*Span)
+			span.Begin = Pos(subcapture.begin)
+			span.End = Pos(subcapture.end)
+			span.Bytes = match.input[subcapture.begin:subcapture.end]
+			if field.lines {
+				span.lines = match.lineIndex()
+			}
+		case MatchRole:
+			whole := match.captures[field.capture]
+			m := dest.FieldByIndex(field.index).Addr().Interface().(*Match)
+			m.Begin = Pos(whole.begin)
+			m.End = Pos(whole.end)
+			m.Bytes = match.input[whole.begin:whole.end]
+			m.Before = match.input[:whole.begin]
+			m.After = match.input[whole.end:]
+			if field.lines {
+				m.lines = match.lineIndex()
+			}
+		case EndPosRole:
+			dest.FieldByIndex(field.index).SetInt(int64(match.captures[field.capture].end))
 		case SubstructRole:
 			val := dest.FieldByIndex(field.index)
 			if err := inflateStruct(val, match, field.child); err != nil {
@@ -0,0 +1,119 @@
+package restructure
+
+import (
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Lexer splits an input into a sequence of tokens, each of which is a match
+// of one of an ordered list of struct types. Each token begins exactly where
+// the previous one ended. A Lexer is safe for concurrent use by multiple
+// goroutines.
+type Lexer struct {
+	set   *Set
+	skip  int // number of struct types at the start of the set whose tokens are skipped
+	lines bool
+}
+
+// Token is a token found by Lexer.Tokenize. The Span records where it was
+// found in the input.
+type Token struct {
+	Span
+	Kind  int         // index of the struct type in the list of tokens passed to CompileLexer
+	Value interface{} // pointer to a new struct of that type, populated from the match
+}
+
+// LexError reports a position at which none of the token types match
+type LexError struct {
+	Pos     Pos     // byte offset of the character that could not be matched
+	LinePos LinePos // line and column of the character
+	Char    rune    // the character, or utf8.RuneError if it is not valid UTF-8
+}
+
+func (e *LexError) Error() string {
+	return fmt.Sprintf("%d:%d: no token matches %q", e.LinePos.Line, e.LinePos.Col, e.Char)
+}
+
+// CompileLexer constructs a lexer that splits input into the struct types
+// in tokens, discarding any matches of the struct types in skip, such as
+// whitespace and comments. At each position the types are tried together,
+// and the type listed first wins, with the types in skip coming before
+// those in tokens, unless Options.Longest is set, in which case the longest
+// match wins and among matches of the same length the type listed first
+// wins. Options.Anchor is ignored, since each token is anchored where the
+// previous one ended.
+func CompileLexer(tokens []interface{}, skip []interface{}, opts Options) (*Lexer, error) {
+	opts.Anchor = AnchorNone
+	protos := append(append([]interface{}{}, skip...), tokens...)
+	set, err := CompileSet(protos, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Lexer{
+		set:   set,
+		skip:  len(skip),
+		lines: opts.LinePositions,
+	}, nil
+}
+
+// MustCompileLexer is like CompileLexer but panics if there is a compilation
+// error
+func MustCompileLexer(tokens []interface{}, skip []interface{}, opts Options) *Lexer {
+	lexer, err := CompileLexer(tokens, skip, opts)
+	if err != nil {
+		panic(err)
+	}
+	return lexer
+}
+
+// Tokenize splits s into tokens. If it reaches a character at which no token
+// matches, or at which the winning match is empty, then it returns the
+// tokens found before that character together with a *LexError.
+func (l *Lexer) Tokenize(s string) ([]Token, error) {
+	input := []byte(s)
+	var tokens []Token
+	var match match
+	for pos := 0; pos < len(input); {
+		k, indices := l.set.set.FindPrefixSubmatchIndexAt(input, pos)
+		if indices == nil || indices[1] == pos {
+			return tokens, l.lexError(input, pos, &match)
+		}
+		end := indices[1]
+		if k >= l.skip {
+			r := l.set.regexps[k]
+			v := reflect.New(r.t)
+			match.reset(indices, input)
+			if err := inflateStruct(v, &match, r.st); err != nil {
+				panic(err)
+			}
+			token := Token{
+				Span: Span{
+					Begin: Pos(pos),
+					End:   Pos(end),
+					Bytes: input[pos:end],
+				},
+				Kind:  k - l.skip,
+				Value: v.Interface(),
+			}
+			if l.lines {
+				token.lines = match.lineIndex()
+			}
+			tokens = append(tokens, token)
+		}
+		pos = end
+	}
+	return tokens, nil
+}
+
+// lexError reports that no token matches at pos, using the line index of
+// match if it has one for input
+func (l *Lexer) lexError(input []byte, pos int, match *match) *LexError {
+	match.reset(nil, input)
+	ch, _ := utf8.DecodeRune(input[pos:])
+	return &LexError{
+		Pos:     Pos(pos),
+		LinePos: match.lineIndex().LinePos(Pos(pos)),
+		Char:    ch,
+	}
+}
@@ -0,0 +1,118 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type NumberToken struct {
+	Value int `\d+`
+}
+
+type IdentToken struct {
+	Name string `[A-Za-z_]\w*`
+}
+
+type StringToken struct {
+	_    struct{} `"`
+	Text string   `[^"]*`
+	_    struct{} `"`
+}
+
+type OpToken struct {
+	Op string `==|=|\+|/`
+}
+
+type SpaceToken struct {
+	_ struct{} `\s+`
+}
+
+type CommentToken struct {
+	_ struct{} `//.*`
+}
+
+var lexerTokens = []interface{}{NumberToken{}, IdentToken{}, StringToken{}, OpToken{}}
+
+func TestLexer_Tokenize(t *testing.T) {
+	lexer := MustCompileLexer(lexerTokens, []interface{}{SpaceToken{}, CommentToken{}}, Options{})
+	tokens, err := lexer.Tokenize(`x = 12 + "a b" // comment`)
+	require.NoError(t, err)
+	require.Len(t, tokens, 5)
+
+	assert.Equal(t, 1, tokens[0].Kind)
+	assert.Equal(t, &IdentToken{Name: "x"}, tokens[0].Value)
+	assert.Equal(t, &OpToken{Op: "="}, tokens[1].Value)
+	assert.Equal(t, &NumberToken{Value: 12}, tokens[2].Value)
+	assert.Equal(t, 0, tokens[2].Kind)
+	assert.Equal(t, Pos(4), tokens[2].Begin)
+	assert.Equal(t, Pos(6), tokens[2].End)
+	assert.Equal(t, "12", tokens[2].String())
+	assert.Equal(t, &OpToken{Op: "+"}, tokens[3].Value)
+	assert.Equal(t, &StringToken{Text: "a b"}, tokens[4].Value)
+	assert.Equal(t, `"a b"`, tokens[4].String())
+}
+
+func TestLexer_Priority(t *testing.T) {
+	// The first listed alternative of OpToken that matches wins, so "==" is
+	// two tokens unless the longest match is preferred
+	first := MustCompileLexer([]interface{}{OpToken{}, IdentToken{}}, nil, Options{})
+	tokens, err := first.Tokenize("==")
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+
+	type Eq struct {
+		Op string `=`
+	}
+	first = MustCompileLexer([]interface{}{Eq{}, OpToken{}}, nil, Options{})
+	tokens, err = first.Tokenize("==")
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, &Eq{Op: "="}, tokens[0].Value)
+
+	longest := MustCompileLexer([]interface{}{Eq{}, OpToken{}}, nil, Options{Longest: true})
+	tokens, err = longest.Tokenize("==")
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, &OpToken{Op: "=="}, tokens[0].Value)
+
+	// Skipped types are tried first, so "//" begins a comment
+	lexer := MustCompileLexer(lexerTokens, []interface{}{CommentToken{}}, Options{})
+	tokens, err = lexer.Tokenize("1/2//3")
+	require.NoError(t, err)
+	require.Len(t, tokens, 3)
+	assert.Equal(t, &NumberToken{Value: 2}, tokens[2].Value)
+}
+
+func TestLexer_Error(t *testing.T) {
+	lexer := MustCompileLexer(lexerTokens, []interface{}{SpaceToken{}}, Options{})
+	tokens, err := lexer.Tokenize("x = 1\ny = é")
+	require.Len(t, tokens, 5)
+	var lexErr *LexError
+	require.IsType(t, lexErr, err)
+	lexErr = err.(*LexError)
+	assert.Equal(t, Pos(10), lexErr.Pos)
+	assert.Equal(t, LinePos{Line: 2, Col: 5, Offset: 10}, lexErr.LinePos)
+	assert.Equal(t, 'é', lexErr.Char)
+	assert.EqualError(t, err, `2:5: no token matches 'é'`)
+}
+
+func TestLexer_EmptyMatch(t *testing.T) {
+	type Maybe struct {
+		Digits string `\d*`
+	}
+	lexer := MustCompileLexer([]interface{}{Maybe{}}, nil, Options{})
+	tokens, err := lexer.Tokenize("12a")
+	require.Len(t, tokens, 1)
+	require.Error(t, err)
+	assert.Equal(t, Pos(2), err.(*LexError).Pos)
+}
+
+func TestLexer_LinePositions(t *testing.T) {
+	lexer := MustCompileLexer(lexerTokens, []interface{}{SpaceToken{}}, Options{LinePositions: true})
+	tokens, err := lexer.Tokenize("a\n  b")
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.Equal(t, LinePos{Line: 2, Col: 3, Offset: 4}, tokens[1].BeginLinePos())
+}
@@ -0,0 +1,70 @@
+package restructure
+
+import (
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// LinePos is a position within the input given as a line and column, which
+// suits diagnostics, and as a character offset, which suits highlighting
+// text in a user interface. A field of type LinePos records the position at
+// its location in the struct, as a Pos field does.
+type LinePos struct {
+	Line   int // line number, starting from 1
+	Col    int // column within the line, in characters, starting from 1
+	Offset int // number of characters before the position
+}
+
+// LineIndex converts byte offsets within an input to line and column
+// numbers. It finds the beginning of each line on first use, after which
+// each conversion takes time logarithmic in the number of lines and linear
+// in the length of the line. Lines end with "\n", and characters are
+// decoded as UTF-8, with each invalid byte counting as one character. A
+// LineIndex is safe for concurrent use by multiple goroutines.
+type LineIndex struct {
+	input []byte
+	once  sync.Once
+	lines []int // byte offset of the beginning of each line
+	runes []int // character offset of the beginning of each line
+}
+
+// NewLineIndex returns a LineIndex for input, which must not be modified
+// while the LineIndex is in use.
+func NewLineIndex(input []byte) *LineIndex {
+	return &LineIndex{input: input}
+}
+
+func (ix *LineIndex) build() {
+	ix.lines = append(ix.lines, 0)
+	ix.runes = append(ix.runes, 0)
+	begin, runes := 0, 0
+	for i, b := range ix.input {
+		if b == '\n' {
+			runes += utf8.RuneCount(ix.input[begin : i+1])
+			begin = i + 1
+			ix.lines = append(ix.lines, begin)
+			ix.runes = append(ix.runes, runes)
+		}
+	}
+}
+
+// LinePos converts a byte offset within the input to a LinePos. Offsets
+// beyond the end of the input are treated as the end of the input.
+func (ix *LineIndex) LinePos(pos Pos) LinePos {
+	ix.once.Do(ix.build)
+	p := int(pos)
+	if p > len(ix.input) {
+		p = len(ix.input)
+	}
+	if p < 0 {
+		p = 0
+	}
+	line := sort.SearchInts(ix.lines, p+1) - 1
+	col := utf8.RuneCount(ix.input[ix.lines[line]:p])
+	return LinePos{
+		Line:   line + 1,
+		Col:    col + 1,
+		Offset: ix.runes[line] + col,
+	}
+}
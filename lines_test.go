@@ -0,0 +1,77 @@
+package restructure
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ConfigEntry struct {
+	Start LinePos
+	Key   string   `(?m)^[^\s=]+`
+	_     struct{} `[ \t]*=[ \t]*`
+	Value Submatch `[^\n]*`
+}
+
+func TestLineIndex(t *testing.T) {
+	ix := NewLineIndex([]byte("ab\ncé\n\nx"))
+	assert.Equal(t, LinePos{Line: 1, Col: 1, Offset: 0}, ix.LinePos(0))
+	assert.Equal(t, LinePos{Line: 1, Col: 3, Offset: 2}, ix.LinePos(2))
+	assert.Equal(t, LinePos{Line: 2, Col: 1, Offset: 3}, ix.LinePos(3))
+	assert.Equal(t, LinePos{Line: 2, Col: 2, Offset: 4}, ix.LinePos(4))
+	assert.Equal(t, LinePos{Line: 2, Col: 3, Offset: 5}, ix.LinePos(6))
+	assert.Equal(t, LinePos{Line: 3, Col: 1, Offset: 6}, ix.LinePos(7))
+	assert.Equal(t, LinePos{Line: 4, Col: 1, Offset: 7}, ix.LinePos(8))
+	assert.Equal(t, LinePos{Line: 4, Col: 2, Offset: 8}, ix.LinePos(9))
+	assert.Equal(t, LinePos{Line: 4, Col: 2, Offset: 8}, ix.LinePos(100))
+
+	assert.Equal(t, LinePos{Line: 1, Col: 1, Offset: 0}, NewLineIndex(nil).LinePos(0))
+}
+
+func TestLinePos_FindAll(t *testing.T) {
+	pattern := MustCompile(ConfigEntry{}, Options{LinePositions: true})
+	var entries []ConfigEntry
+	pattern.FindAll(&entries, "a = 1\nbé = ça\n\nc=3", -1)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, LinePos{Line: 1, Col: 1, Offset: 0}, entries[0].Start)
+	assert.Equal(t, LinePos{Line: 2, Col: 1, Offset: 6}, entries[1].Start)
+	assert.Equal(t, LinePos{Line: 4, Col: 1, Offset: 15}, entries[2].Start)
+
+	assert.Equal(t, "ça", entries[1].Value.String())
+	assert.Equal(t, LinePos{Line: 2, Col: 6, Offset: 11}, entries[1].Value.BeginLinePos())
+	assert.Equal(t, LinePos{Line: 2, Col: 8, Offset: 13}, entries[1].Value.EndLinePos())
+	assert.Equal(t, LinePos{Line: 4, Col: 4, Offset: 18}, entries[2].Value.EndLinePos())
+
+	// The matches in one input share one index
+	assert.True(t, entries[0].Value.lines == entries[2].Value.lines)
+}
+
+func TestLinePos_WithoutOption(t *testing.T) {
+	pattern := MustCompile(ConfigEntry{}, Options{})
+	var entry ConfigEntry
+	require.True(t, pattern.Find(&entry, "\n\nkey=value"))
+	assert.Equal(t, LinePos{Line: 3, Col: 1, Offset: 2}, entry.Start)
+	assert.Equal(t, LinePos{}, entry.Value.BeginLinePos())
+	assert.Equal(t, Submatch{Begin: 6, End: 11, Bytes: []byte("value")}, entry.Value)
+}
+
+func TestLinePos_FindReader(t *testing.T) {
+	pattern := MustCompile(ConfigEntry{}, Options{LinePositions: true})
+	var entry ConfigEntry
+	require.True(t, pattern.FindReader(&entry, strings.NewReader("# comment\n  \nkey = value\nmore = stuff")))
+	assert.Equal(t, "key", entry.Key)
+	assert.Equal(t, LinePos{Line: 3, Col: 1, Offset: 13}, entry.Start)
+	assert.Equal(t, LinePos{Line: 3, Col: 12, Offset: 24}, entry.Value.EndLinePos())
+}
+
+func TestLinePos_Span(t *testing.T) {
+	pattern := MustCompile(SpannedEmail{}, Options{LinePositions: true})
+	var email SpannedEmail
+	require.True(t, pattern.Find(&email, "to:\n  joe@example.com"))
+	assert.Equal(t, LinePos{Line: 2, Col: 3, Offset: 6}, email.BeginLinePos())
+	assert.Equal(t, LinePos{Line: 2, Col: 18, Offset: 21}, email.EndLinePos())
+	assert.Equal(t, LinePos{Line: 2, Col: 7, Offset: 10}, email.Host.BeginLinePos())
+}
@@ -0,0 +1,68 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Alternative struct {
+	Word string `a|ab`
+}
+
+func TestLongest(t *testing.T) {
+	var alt Alternative
+	require.True(t, MustCompile(Alternative{}, Options{}).Find(&alt, "abc"))
+	assert.Equal(t, "a", alt.Word)
+
+	require.True(t, MustCompile(Alternative{}, Options{Longest: true}).Find(&alt, "abc"))
+	assert.Equal(t, "ab", alt.Word)
+
+	require.True(t, MustCompile(Alternative{}, Options{Style: POSIX}).Find(&alt, "abc"))
+	assert.Equal(t, "ab", alt.Word)
+}
+
+type Assignment struct {
+	Key   string   `regexp:".*" repeat:"lazy"`
+	_     struct{} `=`
+	Value string   `.*`
+}
+
+func TestRepeat_Lazy(t *testing.T) {
+	var a Assignment
+	require.True(t, MustCompile(Assignment{}, Options{}).Find(&a, "x=y=z"))
+	assert.Equal(t, Assignment{Key: "x", Value: "y=z"}, a)
+
+	// the whole match is the same length either way, so the lazy field
+	// still splits at the first "="
+	require.True(t, MustCompile(Assignment{}, Options{Longest: true}).Find(&a, "x=y=z"))
+	assert.Equal(t, Assignment{Key: "x", Value: "y=z"}, a)
+
+	type Greedy struct {
+		Key   string   `.*`
+		_     struct{} `=`
+		Value string   `.*`
+	}
+	var g Greedy
+	require.True(t, MustCompile(Greedy{}, Options{}).Find(&g, "x=y=z"))
+	assert.Equal(t, Greedy{Key: "x=y", Value: "z"}, g)
+}
+
+func TestRepeat_Greedy(t *testing.T) {
+	type Digits struct {
+		Lead string `regexp:"(?U)\\d+" repeat:"greedy"`
+		Rest string `(?U)\d+`
+	}
+	var d Digits
+	require.True(t, MustCompile(Digits{}, Options{}).Find(&d, "12345"))
+	assert.Equal(t, Digits{Lead: "1234", Rest: "5"}, d)
+}
+
+func TestRepeat_InvalidTag(t *testing.T) {
+	type Bad struct {
+		Word string `regexp:"\\w+" repeat:"sometimes"`
+	}
+	_, err := Compile(Bad{}, Options{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package restructure
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type KeyValue struct {
+	Whole Match
+	Key   string   `\w+`
+	_     struct{} `=`
+	Value *struct {
+		Text string `\w+`
+		End  EndPos
+	}
+	End EndPos
+}
+
+func TestMatch_Find(t *testing.T) {
+	pattern := MustCompile(KeyValue{}, Options{})
+	var kv KeyValue
+	require.True(t, pattern.Find(&kv, "let x=1;"))
+	assert.Equal(t, Pos(4), kv.Whole.Begin)
+	assert.Equal(t, Pos(7), kv.Whole.End)
+	assert.Equal(t, "x=1", kv.Whole.String())
+	assert.Equal(t, []byte("let "), kv.Whole.Before)
+	assert.Equal(t, []byte(";"), kv.Whole.After)
+	assert.Equal(t, EndPos(7), kv.End)
+	assert.Equal(t, EndPos(7), kv.Value.End)
+	assert.Equal(t, "1", kv.Value.Text)
+
+	// The special fields add nothing to the pattern
+	assert.NotContains(t, pattern.String(), "Whole")
+	assert.NotContains(t, pattern.String(), "End")
+}
+
+func TestMatch_FindAll(t *testing.T) {
+	pattern := MustCompile(KeyValue{}, Options{})
+	var kvs []KeyValue
+	pattern.FindAll(&kvs, "a=1 b=2", -1)
+	require.Len(t, kvs, 2)
+	assert.Equal(t, []byte(""), kvs[0].Whole.Before)
+	assert.Equal(t, []byte(" b=2"), kvs[0].Whole.After)
+	assert.Equal(t, []byte("a=1 "), kvs[1].Whole.Before)
+	assert.Equal(t, []byte(""), kvs[1].Whole.After)
+	assert.Equal(t, EndPos(3), kvs[0].End)
+	assert.Equal(t, EndPos(7), kvs[1].End)
+}
+
+func TestMatch_OnlySpecialFields(t *testing.T) {
+	type Nothing struct {
+		Whole Match
+		End   EndPos
+	}
+	var n Nothing
+	require.True(t, MustCompile(Nothing{}, Options{}).Find(&n, "abc"))
+	assert.Equal(t, Match{Span: Span{Bytes: []byte{}}, Before: []byte{}, After: []byte("abc")}, n.Whole)
+	assert.Equal(t, EndPos(0), n.End)
+}
+
+func TestMatch_FindReader(t *testing.T) {
+	pattern := MustCompile(KeyValue{}, Options{LinePositions: true})
+	var kv KeyValue
+	require.True(t, pattern.FindReader(&kv, strings.NewReader("#\nkey=value more")))
+	assert.Equal(t, "key=value", kv.Whole.String())
+	assert.Equal(t, []byte("#\n"), kv.Whole.Before)
+	assert.Equal(t, LinePos{Line: 2, Col: 1, Offset: 2}, kv.Whole.BeginLinePos())
+	assert.Equal(t, LinePos{Line: 2, Col: 10, Offset: 11}, kv.Whole.EndLinePos())
+}
@@ -0,0 +1,50 @@
+package restructure
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAllParallel(t *testing.T) {
+	input := strings.Repeat(src, 20)
+	for _, opts := range []Options{
+		{ChunkSize: 100},
+		{ChunkSize: 1},
+		{ChunkSize: 100, ChunkSeparator: '\n'},
+		{ChunkSize: 100, Engine: StdlibEngine},
+		{},
+	} {
+		pattern := MustCompile(FloatPos{}, opts)
+		var expected, actual []FloatPos
+		pattern.FindAll(&expected, input, -1)
+		pattern.FindAllParallel(&actual, input, 4)
+		require.Len(t, actual, 20*32)
+		assert.Equal(t, expected, actual, "%+v", opts)
+	}
+}
+
+func TestFindAllParallel_Lines(t *testing.T) {
+	log := strings.Repeat("INFO: ok\n", 1000) + "ERROR: disk full\n" +
+		strings.Repeat("INFO: ok\nFATAL: out of memory\n", 100) + "ERROR: no newline"
+	pattern := MustCompile(LogError{}, Options{ChunkSize: 64, ChunkSeparator: '\n'})
+	var errs []*LogError
+	pattern.FindAllParallel(&errs, log, 0)
+	require.Len(t, errs, 102)
+	assert.Equal(t, &LogError{Level: "ERROR", Msg: "disk full"}, errs[0])
+	assert.Equal(t, &LogError{Level: "FATAL", Msg: "out of memory"}, errs[100])
+	assert.Equal(t, &LogError{Level: "ERROR", Msg: "no newline"}, errs[101])
+}
+
+func TestFindAllParallel_Straddling(t *testing.T) {
+	// every match is longer than the chunks, so each straddles a boundary
+	pattern := MustCompile(DotName{}, Options{ChunkSize: 2})
+	var expected, actual []DotName
+	input := strings.Repeat(".abcdefg .x ", 50)
+	pattern.FindAll(&expected, input, -1)
+	pattern.FindAllParallel(&actual, input, 3)
+	require.Len(t, actual, 100)
+	assert.Equal(t, expected, actual)
+}
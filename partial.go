@@ -0,0 +1,63 @@
+package restructure
+
+// PartialResult describes whether an input matches a pattern, or could
+// match it if more input were appended
+type PartialResult int
+
+const (
+	// Invalid means the input does not match and cannot be extended to match
+	Invalid PartialResult = iota
+	// Incomplete means the input does not match yet but could if more input
+	// were appended
+	Incomplete
+	// Complete means the input matches
+	Complete
+)
+
+// String returns the name of the result
+func (r PartialResult) String() string {
+	switch r {
+	case Invalid:
+		return "Invalid"
+	case Incomplete:
+		return "Incomplete"
+	case Complete:
+		return "Complete"
+	}
+	return "PartialResult(?)"
+}
+
+// FindPartial is like Find but also determines whether an input that does
+// not match could still match if more input were appended, which is useful
+// for validating text as it is typed. If the result is Complete then dest
+// is populated just as for Find. If the result is Incomplete then dest is
+// populated with the fields matched so far, where any field that was still
+// being matched at the end of the input holds the text typed so far. An int
+// field that cannot be parsed yet is left unchanged.
+//
+// Since an unanchored pattern could always match text appended later, the
+// struct should begin with a ^ anchor for the result to be meaningful.
+func (r *Regexp) FindPartial(dest interface{}, s string) PartialResult {
+	v := r.checkDest(dest)
+	input := []byte(s)
+
+	// Execute the regular expression
+	indices, matched, _ := r.fork("FindPartial").FindSubmatchIndexPartial(input)
+	if indices == nil {
+		return Invalid
+	}
+
+	// Inflate matches into original struct
+	result := Complete
+	match := matchFromIndices(indices, input)
+	if !matched {
+		result = Incomplete
+		match.partial = true
+	}
+
+	err := inflateStruct(v, match, r.st)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type PhoneNumber struct {
+	_     struct{} `^`
+	Area  int      `\d{3}`
+	_     struct{} `-`
+	Local string   `\d{4}`
+	_     struct{} `$`
+}
+
+func TestFindPartial_Complete(t *testing.T) {
+	pattern := MustCompile(PhoneNumber{}, Options{})
+	var p PhoneNumber
+	assert.Equal(t, Complete, pattern.FindPartial(&p, "555-1234"))
+	assert.Equal(t, PhoneNumber{Area: 555, Local: "1234"}, p)
+}
+
+func TestFindPartial_Incomplete(t *testing.T) {
+	pattern := MustCompile(PhoneNumber{}, Options{})
+
+	var p PhoneNumber
+	assert.Equal(t, Incomplete, pattern.FindPartial(&p, "555-12"))
+	assert.Equal(t, PhoneNumber{Area: 555, Local: "12"}, p)
+
+	p = PhoneNumber{}
+	assert.Equal(t, Incomplete, pattern.FindPartial(&p, "55"))
+	assert.Equal(t, PhoneNumber{Area: 55}, p)
+
+	p = PhoneNumber{}
+	assert.Equal(t, Incomplete, pattern.FindPartial(&p, ""))
+	assert.Equal(t, PhoneNumber{}, p)
+}
+
+func TestFindPartial_Invalid(t *testing.T) {
+	pattern := MustCompile(PhoneNumber{}, Options{})
+	var p PhoneNumber
+	assert.Equal(t, Invalid, pattern.FindPartial(&p, "555-12345"))
+	assert.Equal(t, Invalid, pattern.FindPartial(&p, "5a"))
+	assert.Equal(t, PhoneNumber{}, p)
+}
+
+type SignedNumber struct {
+	_   struct{} `^`
+	Num int      `-?\d+`
+	_   struct{} `$`
+}
+
+func TestFindPartial_UnparseableInt(t *testing.T) {
+	pattern := MustCompile(SignedNumber{}, Options{})
+	var n SignedNumber
+	assert.Equal(t, Incomplete, pattern.FindPartial(&n, "-"))
+	assert.Equal(t, 0, n.Num)
+	assert.Equal(t, Complete, pattern.FindPartial(&n, "-12"))
+	assert.Equal(t, -12, n.Num)
+}
+
+func TestPartialResultString(t *testing.T) {
+	assert.Equal(t, "Incomplete", Incomplete.String())
+}
@@ -44,12 +44,12 @@ type bitState struct {
 var notBacktrack *bitState = nil
 
 // maxBitStateLen returns the maximum length of a string to search with
-// the backtracker using prog.
-func maxBitStateLen(prog *syntax.Prog) int {
-	if !shouldBacktrack(prog) {
+// the backtracker using re.
+func (re *Regexp) maxBitStateLen() int {
+	if !shouldBacktrack(re.prog) {
 		return 0
 	}
-	return maxBacktrackVector / len(prog.Inst)
+	return re.maxBacktrack / len(re.prog.Inst)
 }
 
 // newBitState returns a new bitState for the given prog,
@@ -84,7 +84,11 @@ func (b *bitState) reset(end int, ncap int) {
 
 	visitedSize := (len(b.prog.Inst)*(end+1) + visitedBits - 1) / visitedBits
 	if cap(b.visited) < visitedSize {
-		b.visited = make([]uint32, visitedSize, maxBacktrackVector/visitedBits)
+		n := maxBacktrackVector / visitedBits
+		if visitedSize > n {
+			n = visitedSize
+		}
+		b.visited = make([]uint32, visitedSize, n)
 	} else {
 		b.visited = b.visited[:visitedSize]
 		for i := range b.visited {
@@ -156,6 +160,9 @@ func (m *machine) tryBacktrack(b *bitState, i input, pc uint32, pos int) bool {
 			continue
 		}
 	Skip:
+		if !m.budget.spend(1) {
+			return false
+		}
 
 		inst := b.prog.Inst[pc]
 
@@ -343,11 +350,11 @@ func (m *machine) backtrack(i input, pos int, end int, ncap int) bool {
 	// but we are not clearing visited between calls to TrySearch,
 	// so no work is duplicated and it ends up still being linear.
 	width := -1
-	for ; pos <= end && width != 0; pos += width {
+	for ; pos <= end && pos < m.limit && width != 0; pos += width {
 		if len(m.re.prefix) > 0 {
 			// Match requires literal prefix; fast search for it.
 			advance := i.index(m.re, pos)
-			if advance < 0 {
+			if advance < 0 || pos+advance >= m.limit {
 				return false
 			}
 			pos += advance
@@ -360,6 +367,9 @@ func (m *machine) backtrack(i input, pos int, end int, ncap int) bool {
 			// Match must be leftmost; done.
 			return true
 		}
+		if m.budget.exhausted() {
+			return false
+		}
 		_, width = i.step(pos)
 	}
 	return false
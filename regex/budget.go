@@ -0,0 +1,122 @@
+package regex
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrBudgetExceeded is returned when a search takes more steps than the
+// limit set with SetMaxSteps.
+var ErrBudgetExceeded = errors.New("regexp: step budget exceeded")
+
+// budgetCheckInterval is the number of steps between checks of the context.
+const budgetCheckInterval = 1 << 12
+
+// A budget limits the work done by a single call into the package. The
+// engines spend steps from it as they run and stop as soon as it runs out
+// or its context is done, after which err records the reason. A nil budget
+// is unlimited.
+type budget struct {
+	ctx  context.Context // context to check, or nil
+	max  int             // maximum number of steps, or 0 for no limit
+	used int             // number of steps spent so far
+	next int             // number of steps at which to check again
+	err  error           // reason the budget ran out, or nil
+}
+
+// newBudget returns a budget for a single call using ctx, which may be nil,
+// and the step limit for re. It returns nil if there is nothing to check.
+func (re *Regexp) newBudget(ctx context.Context) *budget {
+	max := re.maxSteps
+	if max == 0 && re.ext != nil {
+		max = DefaultExtendedMaxSteps
+	}
+	if ctx == nil && max == 0 {
+		return nil
+	}
+	b := &budget{ctx: ctx, max: max}
+	b.check()
+	return b
+}
+
+// spend records n steps of work and reports whether the search may
+// continue.
+func (b *budget) spend(n int) bool {
+	if b == nil {
+		return true
+	}
+	b.used += n
+	if b.used < b.next {
+		return true
+	}
+	return b.check()
+}
+
+// exhausted reports whether the budget has run out.
+func (b *budget) exhausted() bool {
+	return b != nil && b.err != nil
+}
+
+// check tests the step limit and the context, and schedules the next check.
+func (b *budget) check() bool {
+	if b.err != nil {
+		return false
+	}
+	if b.max > 0 && b.used > b.max {
+		b.err = ErrBudgetExceeded
+		return false
+	}
+	if b.ctx != nil {
+		if err := b.ctx.Err(); err != nil {
+			b.err = err
+			return false
+		}
+	}
+	b.next = b.used + budgetCheckInterval
+	if b.max > 0 && b.next > b.max+1 {
+		b.next = b.max + 1
+	}
+	return true
+}
+
+// FindSubmatchIndexContext is like FindSubmatchIndex but stops early if ctx
+// is done or the search runs out of steps, in which case it returns the
+// error from ctx or ErrBudgetExceeded.
+func (re *Regexp) FindSubmatchIndexContext(ctx context.Context, b []byte) ([]int, error) {
+	if b == nil {
+		b = []byte{}
+	}
+	bg := re.newBudget(ctx)
+	a := re.execute(bg, nil, b, "", 0, re.prog.NumCap, nil)
+	if bg.exhausted() {
+		return nil, bg.err
+	}
+	return re.pad(a), nil
+}
+
+// FindStringSubmatchIndexContext is like FindSubmatchIndexContext but for
+// strings.
+func (re *Regexp) FindStringSubmatchIndexContext(ctx context.Context, s string) ([]int, error) {
+	bg := re.newBudget(ctx)
+	a := re.execute(bg, nil, nil, s, 0, re.prog.NumCap, nil)
+	if bg.exhausted() {
+		return nil, bg.err
+	}
+	return re.pad(a), nil
+}
+
+// EachSubmatchIndexContext is like EachSubmatchIndex but stops early if ctx
+// is done or the search runs out of steps, in which case it returns the
+// error from ctx or ErrBudgetExceeded. Matches found before then have
+// already been passed to deliver.
+func (re *Regexp) EachSubmatchIndexContext(ctx context.Context, b []byte, n int, deliver func([]int) bool) error {
+	if n < 0 {
+		n = len(b) + 1
+	}
+	bg := re.newBudget(ctx)
+	re.eachMatch(bg, "", b, n, true, deliver)
+	if bg.exhausted() {
+		return bg.err
+	}
+	return nil
+}
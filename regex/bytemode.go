@@ -0,0 +1,130 @@
+package regex
+
+import "unicode/utf8"
+
+// ByteMode makes future searches treat each byte of the input as a single
+// rune with the same value, from U+0000 to U+00FF, rather than decoding the
+// input as UTF-8. This suits binary data and Latin-1 text: . matches any one
+// byte, \xNN and [\x80-\xff] match raw bytes, a character such as é in the
+// expression matches its Latin-1 byte, and runes above U+00FF never match.
+// Positions in results are still byte offsets. It does not affect searches
+// of a RuneReader, whose runes are taken as they come. It should be called
+// before the Regexp is used.
+func (re *Regexp) ByteMode() {
+	re.latin1 = true
+
+	// The literals used to skip ahead were encoded as UTF-8, so re-encode
+	// them as Latin-1, or drop them if that is not possible. A literal that
+	// cannot be encoded can never be found, so dropping it only gives up
+	// the chance to skip ahead.
+	prefix, ok := latin1String(re.prefix)
+	if !ok {
+		prefix, re.prefixComplete = "", false
+	}
+	re.prefix, re.prefixBytes, re.prefixRune = prefix, nil, 0
+	if prefix != "" {
+		re.prefixBytes = []byte(prefix)
+		re.prefixRune = rune(prefix[0])
+	}
+
+	required, ok := latin1Strings(re.required)
+	if !ok {
+		required = nil
+	}
+	re.required, re.requiredBytes, re.requiredSet, re.requiredMax = required, nil, nil, 0
+	if len(required) == 1 {
+		re.requiredBytes = []byte(required[0])
+	} else if len(required) > 1 {
+		re.requiredSet = newLiteralSet(required)
+	}
+	for _, lit := range required {
+		if len(lit) > re.requiredMax {
+			re.requiredMax = len(lit)
+		}
+	}
+
+	suffix, ok := latin1Strings(re.suffix)
+	if !ok {
+		suffix = nil
+	}
+	re.suffix, re.suffixBytes = suffix, nil
+	for _, lit := range suffix {
+		re.suffixBytes = append(re.suffixBytes, []byte(lit))
+	}
+}
+
+// latin1String re-encodes s, which is UTF-8, as Latin-1. It reports false
+// if s contains a rune above U+00FF.
+func latin1String(s string) (string, bool) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return "", false
+		}
+		out = append(out, byte(r))
+	}
+	return string(out), true
+}
+
+// latin1Strings is like latin1String for each of lits.
+func latin1Strings(lits []string) ([]string, bool) {
+	if lits == nil {
+		return nil, true
+	}
+	out := make([]string, len(lits))
+	for i, lit := range lits {
+		var ok bool
+		if out[i], ok = latin1String(lit); !ok {
+			return nil, false
+		}
+	}
+	return out, true
+}
+
+// runeWidth returns the width of the rune at pos in b, or in s if b is nil,
+// or 0 at the end of the input.
+func (re *Regexp) runeWidth(b []byte, s string, pos int) int {
+	if b != nil {
+		if pos >= len(b) {
+			return 0
+		}
+		if re.latin1 {
+			return 1
+		}
+		_, width := utf8.DecodeRune(b[pos:])
+		return width
+	}
+	if pos >= len(s) {
+		return 0
+	}
+	if re.latin1 {
+		return 1
+	}
+	_, width := utf8.DecodeRuneInString(s[pos:])
+	return width
+}
+
+// runeStart returns the position of the first byte of the rune in b, or in
+// s if b is nil, that contains the byte at pos.
+func (re *Regexp) runeStart(b []byte, s string, pos int) int {
+	if re.latin1 {
+		return pos
+	}
+	// Only a byte that is not a continuation byte can begin a rune that
+	// covers pos, and the nearest one is the only candidate.
+	for q := pos; q > 0 && q > pos-utf8.UTFMax; q-- {
+		var c byte
+		if b != nil {
+			c = b[q-1]
+		} else {
+			c = s[q-1]
+		}
+		if utf8.RuneStart(c) {
+			if re.runeWidth(b, s, q-1) > pos-(q-1) {
+				return q - 1
+			}
+			return pos
+		}
+	}
+	return pos
+}
@@ -0,0 +1,33 @@
+package regex
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByteMode(t *testing.T) {
+	re := MustCompile(`é+x|[\x80-\xff]{2}`)
+	re.ByteMode()
+
+	assert.Equal(t, []int{1, 4}, re.FindStringIndex("a\xe9\xe9x"))
+	assert.Equal(t, [][]int{{0, 2}, {3, 5}}, re.FindAllIndex([]byte("\xc3\xa9 \xff\xfe"), -1))
+	assert.Nil(t, re.FindStringIndex("ééx"[:1]))
+
+	// long enough inputs that the literal scan and the DFA are used
+	long := strings.Repeat("ab", 1000) + "\xe9x" + strings.Repeat("ab", 1000)
+	assert.Equal(t, []int{2000, 2002}, re.FindStringIndex(long))
+	assert.True(t, re.MatchString(long))
+
+	dot := MustCompile(`^.$`)
+	assert.True(t, dot.MatchString("\xc3\xa9"))
+	dot.ByteMode()
+	assert.True(t, dot.MatchString("\xff"))
+	assert.False(t, dot.MatchString("\xc3\xa9"))
+
+	// runes above U+00FF cannot match
+	wide := MustCompile(`€`)
+	wide.ByteMode()
+	assert.False(t, wide.MatchString("€"))
+}
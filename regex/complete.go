@@ -0,0 +1,178 @@
+package regex
+
+import (
+	"regexp/syntax"
+	"unicode"
+)
+
+// A Continuation describes text that could follow a partial match.
+type Continuation struct {
+	// Runes holds the ranges of runes that could come next, as pairs of
+	// inclusive bounds.
+	Runes []rune
+
+	// Literal holds the text that must come next, if the next rune and
+	// any that follow it within the same subexpression can only be one
+	// thing. Otherwise it is empty.
+	Literal string
+
+	// Group is the index of the innermost subexpression that the next
+	// rune would belong to, or 0 if it belongs to no subexpression.
+	Group int
+}
+
+// Continuations determines what could come next after s in a match of the
+// regular expression that begins at the start of s. It runs s through the
+// NFA and returns one Continuation for each thread still waiting for input
+// at the end of s, in priority order. It returns nil if no match could
+// continue past the end of s. If the expression is not anchored at the
+// beginning, only threads for the leftmost match in progress are included.
+// It panics if the expression uses extended syntax.
+func (re *Regexp) Continuations(s string) []Continuation {
+	re.needAutomaton("completion")
+	m := re.get()
+	defer re.put(m)
+	m.matchPartial(m.newInputString(s))
+
+	leftmost := -1
+	for _, w := range m.waiting {
+		if leftmost == -1 || w.start < leftmost {
+			leftmost = w.start
+		}
+	}
+
+	groups := re.innermostGroups()
+	var out []Continuation
+	seen := make(map[uint32]bool)
+	for _, w := range m.waiting {
+		if w.start != leftmost || seen[w.pc] {
+			continue
+		}
+		seen[w.pc] = true
+		inst := &re.prog.Inst[w.pc]
+		out = append(out, Continuation{
+			Runes:   instRunes(inst),
+			Literal: re.literalFrom(w.pc, groups),
+			Group:   groups[w.pc],
+		})
+	}
+	return out
+}
+
+// innermostGroups returns, for each instruction in the program, the index
+// of the innermost subexpression containing it, computing this on first
+// use. A subexpression nested inside another covers a subset of its
+// instructions, so the innermost of those containing an instruction is the
+// one covering the fewest instructions.
+func (re *Regexp) innermostGroups() []int {
+	re.groupsOnce.Do(func() {
+		regions := groupRegions(re.prog)
+		groups := make([]int, len(re.prog.Inst))
+		for k, region := range regions {
+			for _, pc := range region {
+				if g := groups[pc]; g == 0 || len(region) < len(regions[g]) {
+					groups[pc] = k
+				}
+			}
+		}
+		re.groups = groups
+	})
+	return re.groups
+}
+
+// groupRegions returns the instructions inside each subexpression of prog,
+// other than the whole match. An instruction is inside a subexpression if
+// it can be reached from the start of the subexpression without passing its
+// end.
+func groupRegions(prog *syntax.Prog) map[int][]uint32 {
+	regions := make(map[int][]uint32)
+	visited := make([]bool, len(prog.Inst))
+	var stack []uint32
+	for pc := range prog.Inst {
+		inst := &prog.Inst[pc]
+		if inst.Op != syntax.InstCapture || inst.Arg%2 != 0 || inst.Arg == 0 {
+			continue
+		}
+		k := int(inst.Arg / 2)
+		for i := range visited {
+			visited[i] = false
+		}
+		stack = append(stack[:0], inst.Out)
+		for len(stack) > 0 {
+			pc := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if visited[pc] {
+				continue
+			}
+			visited[pc] = true
+			regions[k] = append(regions[k], pc)
+			inst := &prog.Inst[pc]
+			switch inst.Op {
+			case syntax.InstAlt, syntax.InstAltMatch:
+				stack = append(stack, inst.Out, inst.Arg)
+			case syntax.InstCapture:
+				if inst.Arg != uint32(2*k+1) {
+					stack = append(stack, inst.Out)
+				}
+			case syntax.InstMatch, syntax.InstFail:
+				// nothing follows
+			default:
+				stack = append(stack, inst.Out)
+			}
+		}
+	}
+	return regions
+}
+
+// literalFrom returns the literal text that must be matched starting at pc,
+// stopping at the first choice, empty-width assertion, or change of
+// subexpression.
+func (re *Regexp) literalFrom(pc uint32, groups []int) string {
+	group := groups[pc]
+	var lit []rune
+	for {
+		inst := &re.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstNop, syntax.InstCapture:
+			pc = inst.Out
+			continue
+		case syntax.InstRune1:
+		case syntax.InstRune:
+			if len(inst.Rune) != 1 || syntax.Flags(inst.Arg)&syntax.FoldCase != 0 {
+				return string(lit)
+			}
+		default:
+			return string(lit)
+		}
+		if groups[pc] != group {
+			return string(lit)
+		}
+		lit = append(lit, inst.Rune[0])
+		pc = inst.Out
+	}
+}
+
+// instRunes returns the ranges of runes matched by a rune instruction.
+func instRunes(inst *syntax.Inst) []rune {
+	switch inst.Op {
+	case syntax.InstRune1:
+		return []rune{inst.Rune[0], inst.Rune[0]}
+	case syntax.InstRuneAny:
+		return []rune{0, unicode.MaxRune}
+	case syntax.InstRuneAnyNotNL:
+		return []rune{0, '\n' - 1, '\n' + 1, unicode.MaxRune}
+	case syntax.InstRune:
+		if len(inst.Rune) != 1 {
+			return append([]rune(nil), inst.Rune...)
+		}
+		r0 := inst.Rune[0]
+		out := []rune{r0, r0}
+		if syntax.Flags(inst.Arg)&syntax.FoldCase != 0 {
+			for r := unicode.SimpleFold(r0); r != r0; r = unicode.SimpleFold(r) {
+				out = append(out, r, r)
+			}
+		}
+		return out
+	}
+	return nil
+}
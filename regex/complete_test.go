@@ -0,0 +1,18 @@
+package regex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContinuations(t *testing.T) {
+	re := MustCompile(`^(a+)(bcd|x)`)
+	assert.Equal(t, []Continuation{
+		{Runes: []rune{'a', 'a'}, Literal: "a", Group: 1},
+		{Runes: []rune{'b', 'b'}, Literal: "bcd", Group: 2},
+		{Runes: []rune{'x', 'x'}, Literal: "x", Group: 2},
+	}, re.Continuations("aa"))
+	assert.Nil(t, re.Continuations("b"))
+	assert.Nil(t, re.Continuations("abcd"))
+}
@@ -0,0 +1,91 @@
+package regex
+
+import (
+	"regexp/syntax"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An emptyMode selects how the empty-width assertions \b, \B, ^ and $ are
+// evaluated. The zero value gives the same results as the standard library.
+type emptyMode uint8
+
+const (
+	// emptyUnicodeWord makes \b and \B treat any Unicode letter, digit,
+	// mark, or connector punctuation as a word character, rather than
+	// only [0-9A-Za-z_].
+	emptyUnicodeWord emptyMode = 1 << iota
+
+	// emptyCRLF makes (?m:^) and (?m:$) treat \r\n as a single line
+	// ending, and a lone \r as a line ending too, so that neither matches
+	// between \r and \n.
+	emptyCRLF
+)
+
+// UnicodeWordBoundaries makes \b and \B in future searches treat any Unicode
+// letter, digit, mark, or connector punctuation as a word character, so
+// that \bcafé\b matches in "un café noir". The character classes \w and \W
+// are not affected. It should be called before the Regexp is used.
+func (re *Regexp) UnicodeWordBoundaries() {
+	re.empty |= emptyUnicodeWord
+}
+
+// CRLFLineEndings makes ^ and $ in multi-line mode treat \r\n as a single
+// line ending in future searches, so that (?m:^.*$) does not include the
+// \r of a line ending in \r\n. A lone \r also ends a line. The assertions
+// \A and \z, and ^ and $ outside multi-line mode, are not affected. It
+// should be called before the Regexp is used.
+func (re *Regexp) CRLFLineEndings() {
+	re.empty |= emptyCRLF
+}
+
+// context returns the empty-width conditions satisfied between r1 and r2,
+// either of which may be endOfText. It is like syntax.EmptyOpContext but
+// honours mode.
+func (mode emptyMode) context(r1, r2 rune) syntax.EmptyOp {
+	if mode == 0 {
+		return syntax.EmptyOpContext(r1, r2)
+	}
+	var op syntax.EmptyOp = syntax.EmptyNoWordBoundary
+	var boundary byte
+	switch r1 {
+	case endOfText:
+		op |= syntax.EmptyBeginText | syntax.EmptyBeginLine
+	case '\n':
+		op |= syntax.EmptyBeginLine
+	case '\r':
+		if mode&emptyCRLF != 0 && r2 != '\n' {
+			op |= syntax.EmptyBeginLine
+		}
+	}
+	if mode.isWordChar(r1) {
+		boundary = 1
+	}
+	switch r2 {
+	case endOfText:
+		op |= syntax.EmptyEndText | syntax.EmptyEndLine
+	case '\n':
+		if mode&emptyCRLF == 0 || r1 != '\r' {
+			op |= syntax.EmptyEndLine
+		}
+	case '\r':
+		if mode&emptyCRLF != 0 {
+			op |= syntax.EmptyEndLine
+		}
+	}
+	if mode.isWordChar(r2) {
+		boundary ^= 1
+	}
+	if boundary == 1 { // IsWordChar(r1) != IsWordChar(r2)
+		op ^= (syntax.EmptyWordBoundary | syntax.EmptyNoWordBoundary)
+	}
+	return op
+}
+
+// isWordChar reports whether r is a word character for \b and \B.
+func (mode emptyMode) isWordChar(r rune) bool {
+	if r < utf8.RuneSelf || mode&emptyUnicodeWord == 0 {
+		return syntax.IsWordChar(r)
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || unicode.Is(unicode.Pc, r)
+}
@@ -0,0 +1,93 @@
+package regex
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// findEachWay finds the leftmost match of re in s with the backtracker, with
+// the DFA locating the match in a long input, and with the NFA reading from a
+// RuneReader, and checks that all three agree.
+func findEachWay(t *testing.T, re *Regexp, s string) []int {
+	loc := re.FindStringIndex(s)
+
+	long := re.FindStringIndex(s + "\n" + strings.Repeat("-", 100000))
+	assert.Equal(t, loc, long, "DFA: %q in %q", re, s)
+	assert.Equal(t, loc, re.FindReaderIndex(strings.NewReader(s)), "NFA: %q in %q", re, s)
+	return loc
+}
+
+func TestUnicodeWordBoundaries(t *testing.T) {
+	ascii := MustCompile(`\bcafé\b`)
+	re := MustCompile(`\bcafé\b`)
+	re.UnicodeWordBoundaries()
+
+	assert.Nil(t, findEachWay(t, ascii, "un café noir"))
+	assert.Equal(t, []int{3, 8}, findEachWay(t, re, "un café noir"))
+
+	assert.Equal(t, []int{0, 5}, findEachWay(t, ascii, "cafés"))
+	assert.Nil(t, findEachWay(t, re, "cafés"))
+
+	// marks and digits in other scripts are word characters too
+	assert.Nil(t, findEachWay(t, MustCompile(`x\B[\pM\pN]`), "x\u0301"))
+	inner := MustCompile(`x\B[\pM\pN]`)
+	inner.UnicodeWordBoundaries()
+	assert.Equal(t, []int{0, 3}, findEachWay(t, inner, "x\u0301"))
+	assert.Equal(t, []int{0, 3}, findEachWay(t, inner, "x٣"))
+
+	// runes that the pattern does not mention are still told apart
+	greek := MustCompile(`\b\p{Greek}`)
+	greek.UnicodeWordBoundaries()
+	assert.Equal(t, []int{6, 8}, findEachWay(t, greek, " é ¿Ω"))
+
+	// \w is still ASCII
+	word := MustCompile(`\b\w+\b`)
+	word.UnicodeWordBoundaries()
+	assert.Equal(t, []int{7, 9}, findEachWay(t, word, "naïve ok"))
+
+	// the reverse DFA finds the same last match
+	assert.Equal(t, []int{7, 12}, re.FindLastStringIndex("café, café"))
+	assert.Nil(t, re.FindLastStringIndex("cafés"))
+}
+
+func TestCRLFLineEndings(t *testing.T) {
+	lf := MustCompile(`(?m)^.*$`)
+	re := MustCompile(`(?m)^.*$`)
+	re.CRLFLineEndings()
+
+	assert.Equal(t, []int{0, 3}, findEachWay(t, lf, "ab\r\ncd"))
+	assert.Equal(t, []int{0, 2}, findEachWay(t, re, "ab\r\ncd"))
+	assert.Equal(t, [][]int{{0, 2}, {4, 6}, {8, 8}}, re.FindAllStringIndex("ab\r\ncd\r\n", -1))
+	assert.Equal(t, []int{4, 6}, re.FindLastStringIndex("ab\r\ncd\r\n!"[:6]))
+
+	// no line begins or ends between \r and \n
+	assert.Equal(t, []int{0, 2}, findEachWay(t, MustCompile(`(?m)a\r$`), "a\r\n"))
+	cr := MustCompile(`(?m)a\r$`)
+	cr.CRLFLineEndings()
+	assert.Nil(t, findEachWay(t, cr, "a\r\n"))
+	nl := MustCompile(`(?m)^\nb`)
+	nl.CRLFLineEndings()
+	assert.Nil(t, findEachWay(t, nl, "a\r\nb"))
+
+	blank := MustCompile(`(?m)^[\r\n]*x`)
+	blank.CRLFLineEndings()
+	assert.Equal(t, []int{3, 6}, findEachWay(t, blank, "a\r\n\r\nx"))
+	assert.Equal(t, []int{3, 6}, blank.FindLastStringIndex("a\r\n\r\nx"))
+	crlfx := MustCompile(`(?m)^\r\nx`)
+	crlfx.CRLFLineEndings()
+	assert.Equal(t, []int{3, 6}, crlfx.FindLastStringIndex("a\r\n\r\nx"))
+
+	// a lone \r or \n still ends a line
+	begin := MustCompile(`(?m)^b$`)
+	begin.CRLFLineEndings()
+	assert.Equal(t, []int{2, 3}, findEachWay(t, begin, "a\rb\rc"))
+	assert.Equal(t, []int{2, 3}, findEachWay(t, begin, "a\nb\nc"))
+	assert.Equal(t, []int{3, 4}, findEachWay(t, begin, "a\r\nb\r\nc"))
+
+	// outside multi-line mode $ only matches at the end of the text
+	end := MustCompile(`a$`)
+	end.CRLFLineEndings()
+	assert.Nil(t, findEachWay(t, end, "a\r\n"))
+}
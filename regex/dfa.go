@@ -0,0 +1,595 @@
+package regex
+
+import (
+	"regexp/syntax"
+	"sort"
+	"unicode"
+)
+
+// Lazy DFA execution.
+// A dfa simulates the NFA for a prog one input rune at a time, but caches
+// the set of NFA threads reached after each rune as a DFA state, along with
+// the transitions between those states. The states are built on demand, so
+// only the part of the automaton that the input actually exercises is ever
+// constructed, and the cache is flushed whenever it exceeds its memory
+// budget. A dfa cannot report the positions of submatches, so it is used to
+// locate the boundaries of a match, after which the NFA is run on just the
+// matched span. See https://swtch.com/~rsc/regexp/regexp3.html
+
+const (
+	dfaMemBudget   = 1 << 20 // approximate maximum size of the state cache, in bytes
+	dfaStateCost   = 64      // approximate fixed size of a dfaState, in bytes
+	dfaMinProgress = 10      // minimum runes per state between flushes before giving up
+)
+
+// dfaFlag records facts about the rune preceding a dfa state, which are
+// needed to evaluate empty-width assertions, as well as whether a match has
+// already been seen.
+type dfaFlag uint8
+
+const (
+	dfaBeginText dfaFlag = 1 << iota // at beginning of text
+	dfaPrevNL                        // preceding rune was a newline
+	dfaPrevCR                        // preceding rune was a carriage return
+	dfaPrevWord                      // preceding rune was a word character
+	dfaMatched                       // a match has already been found
+)
+
+// A dfaState is a state in a lazily constructed DFA. It holds the ordered
+// list of NFA instructions that are live at this point in the input. The
+// list contains only rune, match, and empty-width instructions; empty-width
+// instructions are resolved when the next rune becomes known.
+type dfaState struct {
+	insts   []uint32
+	flag    dfaFlag
+	isStart bool       // state is the start state, with no threads in progress
+	next    []dfaTrans // transitions, indexed by rune class
+}
+
+// A dfaTrans is a transition between dfa states.
+type dfaTrans struct {
+	s       *dfaState // next state, or nil if not yet computed
+	matched bool      // whether a match ends just before the rune
+}
+
+// deadState is the state from which no match is possible.
+var deadState = &dfaState{}
+
+// A dfa is a lazily constructed DFA for a prog. It is not safe for
+// concurrent use, so each machine holds its own.
+type dfa struct {
+	prog     *syntax.Prog
+	anchored bool // only start threads at the initial position
+	longest  bool // keep running after a match in search of a longer one
+	reverse  bool // scan the input from right to left
+	mode     emptyMode
+	needFlag dfaFlag
+	classes  runeClasses
+	nclass   int  // number of transitions per state
+	mayFail  bool // give up if the cache thrashes
+	failed   bool // the cache thrashed, so the dfa should no longer be used
+	bounded  *dfa // anchored copy used once no more threads may start, allocated lazily
+	record   bool // have search record every match boundary in bounds
+	bounds   []int
+
+	states map[string]*dfaState
+	start  [16]*dfaState
+	mem    int // approximate size of the cache
+
+	// scratch space
+	q0, q1 sparseSet
+	stack  []uint32
+	kept   []uint32
+	key    []byte
+}
+
+// newDFA returns a dfa for prog, which evaluates empty-width assertions
+// according to mode.
+func newDFA(prog *syntax.Prog, mode emptyMode, anchored, longest, reverse bool) *dfa {
+	d := &dfa{
+		prog:     prog,
+		anchored: anchored,
+		longest:  longest,
+		reverse:  reverse,
+		mode:     mode,
+		needFlag: dfaMatched,
+		classes:  newRuneClasses(prog),
+		q0:       newSparseSet(len(prog.Inst)),
+		q1:       newSparseSet(len(prog.Inst)),
+	}
+	d.nclass = d.classes.n
+	if mode&emptyUnicodeWord != 0 {
+		// Runes outside ASCII that are word characters get classes of
+		// their own, at an offset of classes.n.
+		d.nclass *= 2
+	}
+	for _, inst := range prog.Inst {
+		if inst.Op != syntax.InstEmptyWidth {
+			continue
+		}
+		op := syntax.EmptyOp(inst.Arg)
+		if op&(syntax.EmptyBeginText|syntax.EmptyBeginLine) != 0 {
+			d.needFlag |= dfaBeginText
+		}
+		if op&syntax.EmptyBeginLine != 0 {
+			d.needFlag |= dfaPrevNL
+		}
+		if op&(syntax.EmptyBeginLine|syntax.EmptyEndLine) != 0 && mode&emptyCRLF != 0 {
+			d.needFlag |= dfaPrevNL | dfaPrevCR
+		}
+		if op&(syntax.EmptyWordBoundary|syntax.EmptyNoWordBoundary) != 0 {
+			d.needFlag |= dfaPrevWord
+		}
+	}
+	d.flush()
+	return d
+}
+
+// flush discards all cached states.
+func (d *dfa) flush() {
+	d.states = make(map[string]*dfaState)
+	for i := range d.start {
+		d.start[i] = nil
+	}
+	d.mem = 0
+}
+
+// full reports whether the cache has exceeded its memory budget.
+func (d *dfa) full() bool {
+	return d.mem > dfaMemBudget
+}
+
+// flagBefore computes the flags for a state at a position where prev is
+// the preceding rune in scan order, or endOfText if there is none.
+func (d *dfa) flagBefore(prev rune) dfaFlag {
+	var flag dfaFlag
+	switch {
+	case prev == endOfText:
+		flag |= dfaBeginText
+	case prev == '\n':
+		flag |= dfaPrevNL
+	case prev == '\r':
+		flag |= dfaPrevCR
+	}
+	if d.mode.isWordChar(prev) {
+		flag |= dfaPrevWord
+	}
+	return flag
+}
+
+// startState returns the state with no threads in progress, at a position
+// where prev is the preceding rune in scan order.
+func (d *dfa) startState(prev rune) *dfaState {
+	flag := d.flagBefore(prev) & d.needFlag
+	if s := d.start[flag]; s != nil {
+		return s
+	}
+	d.q0.clear()
+	d.addThreads(&d.q0, uint32(d.prog.Start))
+	s := d.intern(d.q0.dense, flag)
+	s.isStart = true
+	d.start[flag] = s
+	return s
+}
+
+// intern returns the cached state for the given instructions and flags,
+// creating it if necessary.
+// Only rune, match, and empty-width instructions are retained.
+func (d *dfa) intern(insts []uint32, flag dfaFlag) *dfaState {
+	d.kept = d.kept[:0]
+	for _, pc := range insts {
+		switch d.prog.Inst[pc].Op {
+		case syntax.InstMatch, syntax.InstEmptyWidth,
+			syntax.InstRune, syntax.InstRune1, syntax.InstRuneAny, syntax.InstRuneAnyNotNL:
+			d.kept = append(d.kept, pc)
+		}
+	}
+	insts = d.kept
+	if len(insts) == 0 && (d.anchored || flag&dfaMatched != 0) {
+		return deadState
+	}
+	if d.longest {
+		// Thread priority does not matter, so use a canonical order
+		// to avoid creating equivalent states.
+		sort.Slice(insts, func(i, j int) bool { return insts[i] < insts[j] })
+	}
+	d.key = append(d.key[:0], byte(flag))
+	for _, pc := range insts {
+		d.key = append(d.key, byte(pc), byte(pc>>8), byte(pc>>16), byte(pc>>24))
+	}
+	if s, ok := d.states[string(d.key)]; ok {
+		return s
+	}
+	s := &dfaState{
+		insts: append([]uint32(nil), insts...),
+		flag:  flag,
+		next:  make([]dfaTrans, d.nclass),
+	}
+	d.states[string(d.key)] = s
+	d.mem += dfaStateCost + len(d.key) + 4*len(insts) + 16*d.nclass
+	return s
+}
+
+// addThreads adds pc to q, following instructions that do not depend on
+// the input. Empty-width instructions are added to q unresolved.
+func (d *dfa) addThreads(q *sparseSet, pc uint32) {
+	d.stack = append(d.stack[:0], pc)
+	for len(d.stack) > 0 {
+		pc := d.stack[len(d.stack)-1]
+		d.stack = d.stack[:len(d.stack)-1]
+		if pc == 0 || q.contains(pc) {
+			continue
+		}
+		q.insert(pc)
+		inst := &d.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			// push in reverse so that Out is explored first
+			d.stack = append(d.stack, inst.Arg, inst.Out)
+		case syntax.InstNop, syntax.InstCapture:
+			d.stack = append(d.stack, inst.Out)
+		}
+	}
+}
+
+// resolve adds pc to q, following empty-width instructions that are
+// satisfied by cond, and keeping only rune and match instructions.
+func (d *dfa) resolve(q *sparseSet, pc uint32, cond syntax.EmptyOp) {
+	d.stack = append(d.stack[:0], pc)
+	for len(d.stack) > 0 {
+		pc := d.stack[len(d.stack)-1]
+		d.stack = d.stack[:len(d.stack)-1]
+		if pc == 0 || q.contains(pc) {
+			continue
+		}
+		q.insert(pc)
+		inst := &d.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			d.stack = append(d.stack, inst.Arg, inst.Out)
+		case syntax.InstNop, syntax.InstCapture:
+			d.stack = append(d.stack, inst.Out)
+		case syntax.InstEmptyWidth:
+			if syntax.EmptyOp(inst.Arg)&^cond == 0 {
+				d.stack = append(d.stack, inst.Out)
+			}
+		}
+	}
+}
+
+// context computes the empty-width conditions satisfied between the rune
+// described by flag and the rune c. The conditions are expressed in terms
+// of the direction of the scan.
+func (d *dfa) context(flag dfaFlag, c rune) syntax.EmptyOp {
+	var op syntax.EmptyOp
+	if flag&dfaBeginText != 0 {
+		op |= syntax.EmptyBeginText | syntax.EmptyBeginLine
+	}
+	if d.mode&emptyCRLF == 0 {
+		if flag&dfaPrevNL != 0 {
+			op |= syntax.EmptyBeginLine
+		}
+		if c == '\n' {
+			op |= syntax.EmptyEndLine
+		}
+	} else {
+		// A line ends with \r\n, \n or \r, and no line begins or ends
+		// inside \r\n, which a reverse scan sees as \n\r.
+		first, second := '\r', '\n'
+		prevFirst, prevSecond := flag&dfaPrevCR != 0, flag&dfaPrevNL != 0
+		if d.reverse {
+			first, second = second, first
+			prevFirst, prevSecond = prevSecond, prevFirst
+		}
+		if prevSecond || prevFirst && c != second {
+			op |= syntax.EmptyBeginLine
+		}
+		if c == first || c == second && !prevFirst {
+			op |= syntax.EmptyEndLine
+		}
+	}
+	if c == endOfText {
+		op |= syntax.EmptyEndText | syntax.EmptyEndLine
+	}
+	if (flag&dfaPrevWord != 0) != d.mode.isWordChar(c) {
+		op |= syntax.EmptyWordBoundary
+	} else {
+		op |= syntax.EmptyNoWordBoundary
+	}
+	return op
+}
+
+// transition computes the transition out of s on the rune c.
+func (d *dfa) transition(s *dfaState, c rune) dfaTrans {
+	// Determine which empty-width assertions hold before c. Flags that the
+	// prog never looks at are absent from s.flag, but then the corresponding
+	// conditions are never tested either.
+	cond := d.context(s.flag, c)
+
+	// Resolve empty-width instructions into rune and match instructions
+	d.q0.clear()
+	for _, pc := range s.insts {
+		d.resolve(&d.q0, pc, cond)
+	}
+
+	// Step each thread over c, in priority order
+	var t dfaTrans
+	flag := s.flag & dfaMatched
+	d.q1.clear()
+	for _, pc := range d.q0.dense {
+		inst := &d.prog.Inst[pc]
+		var add bool
+		switch inst.Op {
+		case syntax.InstMatch:
+			t.matched = true
+			flag |= dfaMatched
+		case syntax.InstRune:
+			add = c != endOfText && inst.MatchRune(c)
+		case syntax.InstRune1:
+			add = c == inst.Rune[0]
+		case syntax.InstRuneAny:
+			add = c != endOfText
+		case syntax.InstRuneAnyNotNL:
+			add = c != endOfText && c != '\n'
+		}
+		if inst.Op == syntax.InstMatch && !d.longest {
+			// First-match mode: cut off all lower-priority threads.
+			break
+		}
+		if add {
+			d.addThreads(&d.q1, inst.Out)
+		}
+	}
+
+	// Start a new thread at the next position unless a match has been found
+	if !d.anchored && flag&dfaMatched == 0 && c != endOfText {
+		d.addThreads(&d.q1, uint32(d.prog.Start))
+	}
+
+	flag |= d.flagBefore(c) &^ dfaBeginText
+	t.s = d.intern(d.q1.dense, flag&d.needFlag)
+	return t
+}
+
+// next returns the transition out of s on the rune c, computing it if
+// necessary.
+func (d *dfa) next(s *dfaState, c rune) dfaTrans {
+	k := d.classes.lookup(c)
+	if c >= utf8RuneSelf && d.mode&emptyUnicodeWord != 0 && d.mode.isWordChar(c) {
+		k += d.classes.n
+	}
+	t := s.next[k]
+	if t.s == nil {
+		t = d.transition(s, c)
+		s.next[k] = t
+	}
+	return t
+}
+
+// search runs the dfa over the input starting at pos, and returns the
+// position of the last match boundary that it finds, or -1 if there is no
+// match. For a forward dfa the scan runs to the end of the input, the
+// boundary is the end of a match, and only matches that begin before limit
+// are found; for a reverse dfa the scan runs leftwards as far as limit and
+// the boundary is the start of a match. If earliest is true then search
+// returns as soon as any match is found. If skip is true then the search
+// skips over text that does not contain the literal prefix of re (or the
+// literal suffix, for a reverse dfa). The final result is false if the cache
+// had to be flushed so often that the search was abandoned, in which case
+// the caller should fall back to the NFA. Only a dfa with mayFail set will
+// give up in this way. Each rune scanned spends a step from bg, and if bg
+// runs out then search reports no match. If d.record is set then every
+// match boundary found, in scan order, is left in d.bounds.
+func (d *dfa) search(i input, pos, limit int, skip bool, re *Regexp, earliest bool, bg *budget) (int, bool) {
+	var s *dfaState
+	if d.reverse {
+		r, _ := i.step(pos)
+		s = d.startState(r)
+	} else {
+		if pos >= limit {
+			return -1, true
+		}
+		r, _ := i.stepBack(pos)
+		s = d.startState(r)
+	}
+	cur := d // the dfa that s belongs to
+	lastMatch := -1
+	d.bounds = d.bounds[:0]
+	lastFlush, nflush := pos, 0
+	for {
+		if s.isStart && skip && !d.reverse {
+			// No threads in progress; fast search for the literal prefix.
+			advance := i.index(re, pos)
+			if advance < 0 {
+				return lastMatch, true
+			}
+			if advance > 0 {
+				pos += advance
+				if pos >= limit {
+					return lastMatch, true
+				}
+				r, _ := i.stepBack(pos)
+				s = d.startState(r)
+			}
+		}
+		if s.isStart && skip && d.reverse {
+			// No threads in progress; fast search backwards for the
+			// literal suffix.
+			end := i.lastIndex(re, pos)
+			if end < limit {
+				return lastMatch, true
+			}
+			if end < pos {
+				pos = end
+				r, _ := i.step(pos)
+				s = d.startState(r)
+			}
+		}
+
+		var c rune
+		var width int
+		if d.reverse {
+			c, width = i.stepBack(pos)
+			width = -width
+		} else {
+			c, width = i.step(pos)
+			if cur == d && !d.anchored && pos+width >= limit {
+				// No thread may start after this rune, so carry on with
+				// a copy of the dfa that does not start any.
+				if d.bounded == nil {
+					d.bounded = newDFA(d.prog, d.mode, true, d.longest, false)
+					d.bounded.mayFail = d.mayFail
+				}
+				cur = d.bounded
+				s = cur.intern(s.insts, s.flag)
+				if s == deadState {
+					return lastMatch, true
+				}
+			}
+		}
+
+		if !bg.spend(1) {
+			return -1, true
+		}
+		t := cur.next(s, c)
+		if t.matched {
+			lastMatch = pos
+			if d.record {
+				d.bounds = append(d.bounds, pos)
+			}
+			if earliest {
+				return lastMatch, true
+			}
+		}
+		// A reverse scan stops at limit, or at the last rune boundary
+		// before it if limit falls within a rune.
+		if t.s == deadState || width == 0 || (d.reverse && pos+width < limit) {
+			return lastMatch, true
+		}
+		s = t.s
+		pos += width
+
+		if cur.full() {
+			// Give up if the cache is being rebuilt too often to be useful.
+			nflush++
+			progress := pos - lastFlush
+			if progress < 0 {
+				progress = -progress
+			}
+			if cur.mayFail && nflush > 1 && progress < dfaMinProgress*len(cur.states) {
+				d.failed = true
+				cur.flush()
+				return -1, false
+			}
+			lastFlush = pos
+			insts, flag := s.insts, s.flag
+			cur.flush()
+			s = cur.intern(insts, flag)
+		}
+	}
+}
+
+// runeClasses partitions the runes into classes such that no instruction
+// in a prog distinguishes between two runes in the same class. The dfa
+// stores its transitions per class rather than per rune.
+type runeClasses struct {
+	bounds []rune // sorted lowest rune in each class after the first
+	ascii  [utf8RuneSelf]uint16
+	n      int // number of classes, including one for endOfText
+}
+
+const utf8RuneSelf = 0x80
+
+func newRuneClasses(prog *syntax.Prog) runeClasses {
+	set := map[rune]bool{}
+	split := func(lo, hi rune) {
+		set[lo] = true
+		set[hi+1] = true
+	}
+
+	// These runes affect empty-width assertions
+	split('\n', '\n')
+	split('\r', '\r')
+	split('0', '9')
+	split('A', 'Z')
+	split('_', '_')
+	split('a', 'z')
+
+	for _, inst := range prog.Inst {
+		switch inst.Op {
+		case syntax.InstRune:
+			if len(inst.Rune) == 1 {
+				r0 := inst.Rune[0]
+				split(r0, r0)
+				if syntax.Flags(inst.Arg)&syntax.FoldCase != 0 {
+					for r1 := unicode.SimpleFold(r0); r1 != r0; r1 = unicode.SimpleFold(r1) {
+						split(r1, r1)
+					}
+				}
+				continue
+			}
+			for j := 0; j+1 < len(inst.Rune); j += 2 {
+				split(inst.Rune[j], inst.Rune[j+1])
+			}
+		case syntax.InstRune1:
+			split(inst.Rune[0], inst.Rune[0])
+		}
+	}
+
+	var rc runeClasses
+	for r := range set {
+		if r > 0 && r <= unicode.MaxRune {
+			rc.bounds = append(rc.bounds, r)
+		}
+	}
+	sort.Slice(rc.bounds, func(i, j int) bool { return rc.bounds[i] < rc.bounds[j] })
+	rc.n = len(rc.bounds) + 2
+	for r := range rc.ascii {
+		rc.ascii[r] = uint16(rc.search(rune(r)))
+	}
+	return rc
+}
+
+// search finds the class for r by binary search.
+func (rc *runeClasses) search(r rune) int {
+	return sort.Search(len(rc.bounds), func(i int) bool { return rc.bounds[i] > r })
+}
+
+// lookup returns the class for r.
+func (rc *runeClasses) lookup(r rune) int {
+	if r == endOfText {
+		return rc.n - 1
+	}
+	if 0 <= r && r < utf8RuneSelf {
+		return int(rc.ascii[r])
+	}
+	return rc.search(r)
+}
+
+// sparseSet is a set of small integers that preserves insertion order
+// and can be cleared in constant time.
+type sparseSet struct {
+	sparse []uint32
+	dense  []uint32
+}
+
+func newSparseSet(size int) sparseSet {
+	return sparseSet{
+		sparse: make([]uint32, size),
+		dense:  make([]uint32, 0, size),
+	}
+}
+
+func (q *sparseSet) contains(u uint32) bool {
+	j := q.sparse[u]
+	return j < uint32(len(q.dense)) && q.dense[j] == u
+}
+
+func (q *sparseSet) insert(u uint32) {
+	q.sparse[u] = uint32(len(q.dense))
+	q.dense = append(q.dense, u)
+}
+
+func (q *sparseSet) clear() {
+	q.dense = q.dense[:0]
+}
@@ -0,0 +1,109 @@
+package regex
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// engineTestPatterns are run through both the forked regex package and the
+// standard library regexp package, on inputs long enough that the forked
+// package uses its lazy DFA rather than the backtracker
+var engineTestPatterns = []string{
+	`a+b`,
+	`(a|ab)(c|bcd)(d*)`,
+	`^abc`,
+	`abc$`,
+	`(?m)^x\w+$`,
+	`(?m)$`,
+	`^$`,
+	`\bfoo\b`,
+	`\Bo+`,
+	`[a-c]+?d`,
+	`(?i)hello`,
+	`x*`,
+	`(a*)*b`,
+	`é+[^a]`,
+	`(\w+)@(\w+)\.com`,
+	`a.c`,
+	`(?s)a.c`,
+	`\d{3,5}`,
+	`(a|b|c)*abc`,
+	`[^\n]+\n`,
+	`(a|b)*a(a|b){10}`, // large DFA that forces cache flushes
+	`(foo|hello)\s+\w+`,
+	`\w+@\w+\.com`,
+	`[ab]c[de]`,
+	`(?i)héllo`,
+	`\d-\d{2}`,
+	`x.{0,3}@`,
+}
+
+// randomText generates a long string out of fragments that the patterns
+// above are sensitive to
+func randomText(r *rand.Rand, n int) string {
+	fragments := []string{"a", "b", "c", "d", "x", "y", "\n", " ", "é", "@", ".com", "foo", "hello", "HeLLo", "1", "23"}
+	var sb strings.Builder
+	for sb.Len() < n {
+		sb.WriteString(fragments[r.Intn(len(fragments))])
+	}
+	return sb.String()
+}
+
+func compareWithStdlib(t *testing.T, posix bool) {
+	r := rand.New(rand.NewSource(1))
+	for _, pattern := range engineTestPatterns {
+		var ours *Regexp
+		var theirs *regexp.Regexp
+		if posix {
+			var err error
+			if ours, err = CompilePOSIX(pattern); err != nil {
+				continue // not valid POSIX syntax
+			}
+			theirs = regexp.MustCompilePOSIX(pattern)
+		} else {
+			ours = MustCompile(pattern)
+			theirs = regexp.MustCompile(pattern)
+		}
+
+		for i := 0; i < 20; i++ {
+			s := randomText(r, 1+r.Intn(20000)>>uint(r.Intn(10)))
+			if !assert.Equal(t, theirs.FindAllStringSubmatchIndex(s, -1), ours.FindAllStringSubmatchIndex(s, -1), pattern) {
+				break
+			}
+			assert.Equal(t, theirs.MatchString(s), ours.MatchString(s), pattern)
+		}
+	}
+}
+
+func TestEngineMatchesStdlib(t *testing.T) {
+	compareWithStdlib(t, false)
+}
+
+func TestEngineMatchesStdlibPOSIX(t *testing.T) {
+	compareWithStdlib(t, true)
+}
+
+func TestReverseDFALimitWithinRune(t *testing.T) {
+	re := MustCompile(`\S+`)
+	m := re.get()
+	defer re.put(m)
+	d := newDFA(re.reverseProg(), re.empty, true, true, true)
+	// the earliest rune boundary at or after each limit
+	for limit, expected := range []int{0, 1, 3, 3, 5, 5, -1} {
+		start, ok := d.search(m.newInputString("aééb"), 6, limit, false, re, false, nil)
+		assert.True(t, ok)
+		assert.Equal(t, expected, start, "limit %d", limit)
+	}
+
+	pattern := `(b(abx|ab)|(?:[ab])+?((\b)*|[^a]{1,3}))`
+	ours := MustCompile(pattern)
+	require.NoError(t, ours.SetStrategies(DFA|NFA))
+	for _, s := range []string{"aééb", "aééb" + strings.Repeat(" ", 20000)} {
+		assert.Equal(t, regexp.MustCompile(pattern).FindAllStringSubmatchIndex(s, -1), ours.FindAllStringSubmatchIndex(s, -1))
+	}
+}
@@ -0,0 +1,320 @@
+package regex
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Extended syntax.
+// The operators below extend the syntax trees of package regexp/syntax with
+// constructs that RE2 cannot match in linear time: backreferences,
+// lookaround assertions, and atomic groups. A syntax tree that contains any
+// of them is matched by a backtracking engine (see extmatch.go) rather than
+// by the automata used for everything else, and its searches are always
+// limited to a number of steps.
+const (
+	OpBackref       syntax.Op = 128 + iota // matches the text last matched by capture Cap, or if Cap is 0 by the capture called Name
+	OpLookahead                            // matches empty string if Sub[0] matches here
+	OpNegLookahead                         // matches empty string if Sub[0] does not match here
+	OpLookbehind                           // matches empty string if Sub[0] matches text ending here
+	OpNegLookbehind                        // matches empty string if Sub[0] does not match text ending here
+	OpAtomic                               // matches Sub[0] but never backtracks into it
+)
+
+// DefaultExtendedMaxSteps is the step limit for searches with expressions
+// that use extended syntax, when no limit has been set with SetMaxSteps.
+const DefaultExtendedMaxSteps = 1 << 20
+
+// extendedPrefixes maps the syntax that opens each group construct to its
+// operator.
+var extendedPrefixes = []struct {
+	prefix string
+	op     syntax.Op
+}{
+	{"(?<=", OpLookbehind},
+	{"(?<!", OpNegLookbehind},
+	{"(?=", OpLookahead},
+	{"(?!", OpNegLookahead},
+	{"(?>", OpAtomic},
+}
+
+// placeholderPrefix begins the name of the capture groups that stand in for
+// extended constructs while the rest of the expression is parsed.
+const placeholderPrefix = "restructureExt"
+
+// ParseExtended is like syntax.Parse but also accepts backreferences
+// written \k<name> or \k<n>, lookahead (?=re) and (?!re), lookbehind (?<=re)
+// and (?<!re), and atomic groups (?>re). Backreferences are returned with
+// Name set, or Cap for numeric references, and are resolved to capture
+// indexes when the expression is compiled. flags must include
+// syntax.PerlX if any extended syntax is used.
+func ParseExtended(s string, flags syntax.Flags) (*syntax.Regexp, error) {
+	// Each extended construct is rewritten as a capture group with a
+	// reserved name so that syntax.Parse handles its contents, flags and
+	// captures in context, and the groups are replaced afterwards.
+	var out strings.Builder
+	var ops []syntax.Op
+	placeholder := func(op syntax.Op) {
+		fmt.Fprintf(&out, "(?P<%s%d>", placeholderPrefix, len(ops))
+		ops = append(ops, op)
+	}
+
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], `\k<`):
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 || end == 3 {
+				return nil, &syntax.Error{Code: syntax.ErrInvalidNamedCapture, Expr: s[i:]}
+			}
+			out.WriteString(`(?P<` + placeholderPrefix + strconv.Itoa(len(ops)) + `>` + s[i+3:i+end] + `)`)
+			ops = append(ops, OpBackref)
+			i += end + 1
+			continue
+		case s[i] == '\\' && i+1 < len(s):
+			out.WriteString(s[i : i+2])
+			i += 2
+			continue
+		case s[i] == '[':
+			end := classEnd(s, i)
+			out.WriteString(s[i:end])
+			i = end
+			continue
+		case s[i] == '(':
+			if op, n := extendedPrefix(s[i:]); n > 0 {
+				placeholder(op)
+				i += n
+				continue
+			}
+		}
+		_, w := utf8.DecodeRuneInString(s[i:])
+		out.WriteString(s[i : i+w])
+		i += w
+	}
+
+	re, err := syntax.Parse(out.String(), flags)
+	if err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return re, nil
+	}
+	var removed []int
+	re = replacePlaceholders(re, ops, &removed)
+	renumberCaptures(re, removed)
+	return re, nil
+}
+
+// extendedPrefix returns the operator for the extended group construct at
+// the start of s, and the length of the syntax that opens it, or 0 if there
+// is none.
+func extendedPrefix(s string) (syntax.Op, int) {
+	for _, p := range extendedPrefixes {
+		if strings.HasPrefix(s, p.prefix) {
+			return p.op, len(p.prefix)
+		}
+	}
+	return 0, 0
+}
+
+// classEnd returns the position just past the character class that starts
+// at s[i]. If the class is not terminated it returns len(s), leaving the
+// error to be reported by syntax.Parse.
+func classEnd(s string, i int) int {
+	j := i + 1
+	if j < len(s) && s[j] == '^' {
+		j++
+	}
+	if j < len(s) && s[j] == ']' {
+		j++ // a leading ] is literal
+	}
+	for j < len(s) {
+		switch {
+		case s[j] == '\\' && j+1 < len(s):
+			j += 2
+		case strings.HasPrefix(s[j:], "[:"):
+			if end := strings.Index(s[j+2:], ":]"); end >= 0 {
+				j += end + 4
+			} else {
+				j++
+			}
+		case s[j] == ']':
+			return j + 1
+		default:
+			j++
+		}
+	}
+	return len(s)
+}
+
+// replacePlaceholders replaces the placeholder captures in re with the
+// extended constructs they stand for, and appends the index of each
+// placeholder capture to removed.
+func replacePlaceholders(re *syntax.Regexp, ops []syntax.Op, removed *[]int) *syntax.Regexp {
+	for i, sub := range re.Sub {
+		re.Sub[i] = replacePlaceholders(sub, ops, removed)
+	}
+	if re.Op != syntax.OpCapture || !strings.HasPrefix(re.Name, placeholderPrefix) {
+		return re
+	}
+	n, _ := strconv.Atoi(strings.TrimPrefix(re.Name, placeholderPrefix))
+	*removed = append(*removed, re.Cap)
+	if ops[n] == OpBackref {
+		// The capture holds the reference as literal text, and its
+		// flags are those in effect where the reference appeared.
+		ref := &syntax.Regexp{Op: OpBackref, Flags: re.Flags & syntax.FoldCase}
+		if lit := re.Sub[0]; lit.Op == syntax.OpLiteral {
+			ref.Name = string(lit.Rune)
+		}
+		if n, err := strconv.Atoi(ref.Name); err == nil {
+			ref.Cap, ref.Name = n, ""
+		}
+		return ref
+	}
+	return &syntax.Regexp{Op: ops[n], Sub: re.Sub, Flags: re.Flags}
+}
+
+// renumberCaptures renumbers the captures in re to close the gaps left by
+// the removed placeholder captures.
+func renumberCaptures(re *syntax.Regexp, removed []int) {
+	if re.Op == syntax.OpCapture {
+		shift := 0
+		for _, c := range removed {
+			if c < re.Cap {
+				shift++
+			}
+		}
+		re.Cap -= shift
+	}
+	for _, sub := range re.Sub {
+		renumberCaptures(sub, removed)
+	}
+}
+
+// isExtended reports whether op is one of the extended operators.
+func isExtended(op syntax.Op) bool {
+	return op >= OpBackref && op <= OpAtomic
+}
+
+// hasExtended reports whether re uses any extended syntax.
+func hasExtended(re *syntax.Regexp) bool {
+	if isExtended(re.Op) {
+		return true
+	}
+	for _, sub := range re.Sub {
+		if hasExtended(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveBackrefs sets the capture index of each backreference in re that
+// refers to a capture by name and has not been resolved already, and checks
+// that every backreference refers to a capture that exists.
+func resolveBackrefs(re *syntax.Regexp, names []string, maxCap int) error {
+	if re.Op == OpBackref {
+		if re.Cap == 0 && re.Name != "" {
+			for i, name := range names {
+				if i > 0 && name == re.Name {
+					re.Cap = i
+					break
+				}
+			}
+		}
+		if re.Cap <= 0 || re.Cap > maxCap {
+			ref := re.Name
+			if ref == "" {
+				ref = strconv.Itoa(re.Cap)
+			}
+			return fmt.Errorf(`backreference \k<%s> does not refer to a capture`, ref)
+		}
+	}
+	for _, sub := range re.Sub {
+		if err := resolveBackrefs(sub, names, maxCap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relaxExtended returns a copy of re in which each extended construct is
+// replaced with something the standard compiler accepts: assertions and
+// backreferences with an empty match, and atomic groups with their contents.
+// The result has the same captures as re but not the same meaning, so it is
+// only used to obtain a program with the right shape.
+func relaxExtended(re *syntax.Regexp) *syntax.Regexp {
+	switch re.Op {
+	case OpBackref, OpLookahead, OpNegLookahead, OpLookbehind, OpNegLookbehind:
+		return &syntax.Regexp{Op: syntax.OpEmptyMatch}
+	case OpAtomic:
+		return relaxExtended(re.Sub[0])
+	}
+	out := *re
+	out.Sub = nil
+	out.Sub0 = [1]*syntax.Regexp{}
+	for _, sub := range re.Sub {
+		out.Sub = append(out.Sub, relaxExtended(sub))
+	}
+	return &out
+}
+
+// syntaxString is like re.String but also formats extended constructs.
+func syntaxString(re *syntax.Regexp) string {
+	if !hasExtended(re) {
+		return re.String()
+	}
+
+	// Format a copy in which extended constructs are replaced by
+	// placeholder captures, then substitute each placeholder.
+	var ext []*syntax.Regexp
+	var stub func(re *syntax.Regexp) *syntax.Regexp
+	stub = func(re *syntax.Regexp) *syntax.Regexp {
+		if isExtended(re.Op) {
+			ext = append(ext, re)
+			return &syntax.Regexp{
+				Op:   syntax.OpCapture,
+				Name: fmt.Sprintf("%s%d", placeholderPrefix, len(ext)-1),
+				Sub:  []*syntax.Regexp{{Op: syntax.OpEmptyMatch}},
+			}
+		}
+		out := *re
+		out.Sub = nil
+		out.Sub0 = [1]*syntax.Regexp{}
+		for _, sub := range re.Sub {
+			out.Sub = append(out.Sub, stub(sub))
+		}
+		return &out
+	}
+	s := stub(re).String()
+	for i, e := range ext {
+		var repl string
+		switch e.Op {
+		case OpBackref:
+			if e.Name != "" {
+				repl = `\k<` + e.Name + `>`
+			} else {
+				repl = `\k<` + strconv.Itoa(e.Cap) + `>`
+			}
+			if e.Flags&syntax.FoldCase != 0 {
+				repl = "(?i:" + repl + ")"
+			}
+		case OpAtomic:
+			repl = "(?>" + syntaxString(e.Sub[0]) + ")"
+		default:
+			for _, p := range extendedPrefixes {
+				if p.op == e.Op {
+					repl = p.prefix + syntaxString(e.Sub[0]) + ")"
+				}
+			}
+		}
+		// Depending on the Go version the empty capture prints with or
+		// without an explicit empty group.
+		name := fmt.Sprintf("(?P<%s%d>", placeholderPrefix, i)
+		s = strings.Replace(s, name+"(?:))", repl, 1)
+		s = strings.Replace(s, name+")", repl, 1)
+	}
+	return s
+}
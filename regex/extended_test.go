@@ -0,0 +1,57 @@
+package regex
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtendedEngineMatchesStdlib(t *testing.T) {
+	// An empty lookahead changes nothing about what matches, but sends the
+	// pattern to the backtracking engine for extended syntax
+	r := rand.New(rand.NewSource(1))
+	for _, pattern := range engineTestPatterns {
+		ours := MustCompileExtended(`(?=)(?:` + pattern + `)`)
+		ours.SetMaxSteps(1 << 30)
+		theirs := regexp.MustCompile(pattern)
+		for i := 0; i < 20; i++ {
+			s := randomText(r, 1+r.Intn(200))
+			if !assert.Equal(t, theirs.FindAllStringSubmatchIndex(s, -1), ours.FindAllStringSubmatchIndex(s, -1), pattern) {
+				break
+			}
+		}
+	}
+}
+
+func TestCompileExtended(t *testing.T) {
+	re := MustCompileExtended(`(?P<q>["'])(\w*)\k<q>`)
+	assert.Equal(t, []int{5, 9, 5, 6, 6, 8}, re.FindStringSubmatchIndex(`"ab' 'cd'`))
+	assert.Equal(t, `(?P<q>["'])(\w*)\k<q>`, re.String())
+
+	re = MustCompileExtended(`(?i)(ab)\k<1>`)
+	assert.True(t, re.MatchString("abAB"))
+
+	re = MustCompileExtended(`(?<=\$)\d+(?![\d.])`)
+	assert.Equal(t, [][]int{{6, 8}}, re.FindAllStringIndex("$1.5 $20 30", -1))
+
+	re = MustCompileExtended(`(?>a+)a`)
+	assert.False(t, re.MatchString("aaaa"))
+
+	// numbering of later captures is unaffected by the extended constructs
+	re = MustCompileExtended(`(?=(a))(\w)\k<2>`)
+	assert.Equal(t, []int{2, 4, 2, 3, 2, 3}, re.FindStringSubmatchIndex("abaa"))
+
+	_, err := CompileExtended(`\k<2>(a)`)
+	assert.Error(t, err)
+
+	// plain expressions compile exactly as with Compile
+	re = MustCompileExtended(`a+b`)
+	assert.Equal(t, []int{1, 4}, re.FindStringIndex("caab"))
+
+	// exponential backtracking stops at the default step limit
+	re = MustCompileExtended(`((a|aa)*)\k<1>b`)
+	assert.False(t, re.MatchString(strings.Repeat("a", 60)))
+}
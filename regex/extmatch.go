@@ -0,0 +1,408 @@
+package regex
+
+import (
+	"io"
+	"regexp/syntax"
+	"unicode"
+)
+
+// Backtracking execution for extended syntax.
+// An extMachine matches a syntax tree directly by recursive backtracking,
+// passing each node a continuation to call with the position at which the
+// node's match ends. This can take time exponential in the size of the
+// input, so every node visited spends a step from the search's budget.
+
+// An extMachine holds the state for one search with an extended expression.
+type extMachine struct {
+	i       input
+	end     int   // length of the input
+	caps    []int // captures for the current path
+	bg      *budget
+	longest bool
+	best    []int // captures for the longest match so far, when longest is set
+	limit   int   // only begin a match before this position
+}
+
+// extExecute is like execute for expressions that use extended syntax.
+func (re *Regexp) extExecute(bg *budget, r io.RuneReader, b []byte, s string, pos, limit int, ncap int, dstCap []int) []int {
+	if r != nil {
+		panic("regexp: cannot match " + re.expr + " against a RuneReader: backreferences and lookaround need random access")
+	}
+	x := &extMachine{
+		bg:      bg,
+		longest: re.longest,
+		caps:    make([]int, re.prog.NumCap),
+		limit:   limit,
+	}
+	if b != nil {
+		x.i, x.end = &inputBytes{str: b, latin1: re.latin1, empty: re.empty}, len(b)
+	} else {
+		x.i, x.end = &inputString{str: s, latin1: re.latin1, empty: re.empty}, len(s)
+	}
+	if !x.search(re.ext, pos) {
+		return nil
+	}
+	if ncap == 0 {
+		if dstCap == nil {
+			return empty
+		}
+		return dstCap
+	}
+	return append(dstCap, x.caps[:ncap]...)
+}
+
+// needAutomaton panics if re uses extended syntax or allows approximate
+// matches, which the named feature does not support because it needs to run
+// the usual NFA.
+func (re *Regexp) needAutomaton(feature string) {
+	if re.ext != nil {
+		panic("regexp: " + feature + " is not supported for " + re.expr + ": it uses backreferences or lookaround")
+	}
+	if re.fuzzy != nil {
+		panic("regexp: " + feature + " is not supported for " + re.expr + ": it allows approximate matches")
+	}
+}
+
+// search tries to match re at each position from pos onwards, and reports
+// whether there was a match, in which case x.caps holds its captures.
+func (x *extMachine) search(re *syntax.Regexp, pos int) bool {
+	for start := pos; start <= x.end && start < x.limit; {
+		for j := range x.caps {
+			x.caps[j] = -1
+		}
+		x.best = nil
+		x.caps[0] = start
+		matched := x.match(re, start, func(p int) bool {
+			x.caps[1] = p
+			if !x.longest {
+				return true
+			}
+			if x.best == nil || p > x.best[1] {
+				x.best = append(x.best[:0], x.caps...)
+			}
+			return false // keep looking for a longer match
+		})
+		if x.bg.exhausted() {
+			return false
+		}
+		if x.longest && x.best != nil {
+			copy(x.caps, x.best)
+			return true
+		}
+		if matched {
+			return true
+		}
+		_, w := x.i.step(start)
+		if w == 0 {
+			break
+		}
+		start += w
+	}
+	return false
+}
+
+// match matches re at pos, calling k with the position at which each
+// possible match of re ends, in order of preference, until k returns true.
+// It reports whether k returned true.
+func (x *extMachine) match(re *syntax.Regexp, pos int, k func(int) bool) bool {
+	if !x.bg.spend(1) {
+		return false
+	}
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return false
+
+	case syntax.OpEmptyMatch:
+		return k(pos)
+
+	case syntax.OpLiteral:
+		fold := re.Flags&syntax.FoldCase != 0
+		for _, want := range re.Rune {
+			c, w := x.i.step(pos)
+			if w == 0 || !(c == want || fold && equalFold(c, want)) {
+				return false
+			}
+			pos += w
+		}
+		return k(pos)
+
+	case syntax.OpCharClass:
+		c, w := x.i.step(pos)
+		if w == 0 || !inClass(re.Rune, c) {
+			return false
+		}
+		return k(pos + w)
+
+	case syntax.OpAnyCharNotNL:
+		c, w := x.i.step(pos)
+		if w == 0 || c == '\n' {
+			return false
+		}
+		return k(pos + w)
+
+	case syntax.OpAnyChar:
+		_, w := x.i.step(pos)
+		if w == 0 {
+			return false
+		}
+		return k(pos + w)
+
+	case syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		if x.i.context(pos)&emptyOpFor(re.Op) == 0 {
+			return false
+		}
+		return k(pos)
+
+	case syntax.OpCapture:
+		c := 2 * re.Cap
+		if c+1 >= len(x.caps) {
+			return x.match(re.Sub[0], pos, k)
+		}
+		begin, end := x.caps[c], x.caps[c+1]
+		x.caps[c] = pos
+		matched := x.match(re.Sub[0], pos, func(p int) bool {
+			prev := x.caps[c+1]
+			x.caps[c+1] = p
+			if k(p) {
+				return true
+			}
+			x.caps[c+1] = prev
+			return false
+		})
+		if !matched {
+			x.caps[c], x.caps[c+1] = begin, end
+		}
+		return matched
+
+	case syntax.OpConcat:
+		return x.concat(re.Sub, pos, k)
+
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if x.match(sub, pos, k) {
+				return true
+			}
+		}
+		return false
+
+	case syntax.OpStar:
+		return x.repeat(re, 0, -1, 0, pos, k)
+	case syntax.OpPlus:
+		return x.repeat(re, 1, -1, 0, pos, k)
+	case syntax.OpQuest:
+		return x.repeat(re, 0, 1, 0, pos, k)
+	case syntax.OpRepeat:
+		return x.repeat(re, re.Min, re.Max, 0, pos, k)
+
+	case OpBackref:
+		begin, end := x.caps[2*re.Cap], x.caps[2*re.Cap+1]
+		if begin < 0 || end < 0 {
+			return false
+		}
+		fold := re.Flags&syntax.FoldCase != 0
+		for q := begin; q < end; {
+			want, wq := x.i.step(q)
+			c, w := x.i.step(pos)
+			if w == 0 || !(c == want || fold && equalFold(c, want)) {
+				return false
+			}
+			q += wq
+			pos += w
+		}
+		return k(pos)
+
+	case OpLookahead, OpNegLookahead:
+		saved := append([]int(nil), x.caps...)
+		found := x.match(re.Sub[0], pos, func(int) bool { return true })
+		if x.bg.exhausted() {
+			return false
+		}
+		if re.Op == OpNegLookahead {
+			copy(x.caps, saved)
+			found = !found
+		}
+		if found && k(pos) {
+			return true
+		}
+		copy(x.caps, saved)
+		return false
+
+	case OpLookbehind, OpNegLookbehind:
+		saved := append([]int(nil), x.caps...)
+		found := x.lookbehind(re.Sub[0], pos)
+		if x.bg.exhausted() {
+			return false
+		}
+		if re.Op == OpNegLookbehind {
+			copy(x.caps, saved)
+			found = !found
+		}
+		if found && k(pos) {
+			return true
+		}
+		copy(x.caps, saved)
+		return false
+
+	case OpAtomic:
+		saved := append([]int(nil), x.caps...)
+		end := -1
+		if !x.match(re.Sub[0], pos, func(p int) bool { end = p; return true }) {
+			return false
+		}
+		if k(end) {
+			return true
+		}
+		copy(x.caps, saved)
+		return false
+	}
+	panic("regexp: unhandled op in extended expression")
+}
+
+// concat matches each of subs in turn starting at pos.
+func (x *extMachine) concat(subs []*syntax.Regexp, pos int, k func(int) bool) bool {
+	if len(subs) == 0 {
+		return k(pos)
+	}
+	return x.match(subs[0], pos, func(p int) bool {
+		return x.concat(subs[1:], p, k)
+	})
+}
+
+// repeat matches re.Sub[0] between min and max times, or at least min times
+// if max is -1, having matched it count times already. Once min is reached,
+// an iteration that matches the empty string ends the repetition if it is
+// the first, and otherwise fails, which agrees with the captures reported
+// by the automata.
+func (x *extMachine) repeat(re *syntax.Regexp, min, max, count, pos int, k func(int) bool) bool {
+	sub := re.Sub[0]
+	if count < min {
+		return x.match(sub, pos, func(p int) bool {
+			return x.repeat(re, min, max, count+1, p, k)
+		})
+	}
+	if max != -1 && count >= max {
+		return k(pos)
+	}
+	more := func() bool {
+		return x.match(sub, pos, func(p int) bool {
+			if p == pos {
+				return count == 0 && k(p)
+			}
+			return x.repeat(re, min, max, count+1, p, k)
+		})
+	}
+	if re.Flags&syntax.NonGreedy != 0 {
+		return k(pos) || more()
+	}
+	return more() || k(pos)
+}
+
+// lookbehind reports whether re matches text ending at pos. It tries each
+// starting position in turn, working backwards from pos, and stops early if
+// re cannot match more than a fixed number of runes.
+func (x *extMachine) lookbehind(re *syntax.Regexp, pos int) bool {
+	maxRunes := maxWidth(re)
+	for start, n := pos, 0; ; n++ {
+		if x.match(re, start, func(p int) bool { return p == pos }) {
+			return true
+		}
+		if x.bg.exhausted() || n == maxRunes {
+			return false
+		}
+		_, w := x.i.stepBack(start)
+		if w == 0 {
+			return false
+		}
+		start -= w
+	}
+}
+
+// maxWidth returns the maximum number of runes matched by re, or -1 if there
+// is no limit.
+func maxWidth(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, OpAtomic:
+		return maxWidth(re.Sub[0])
+	case syntax.OpConcat:
+		total := 0
+		for _, sub := range re.Sub {
+			n := maxWidth(sub)
+			if n < 0 {
+				return -1
+			}
+			total += n
+		}
+		return total
+	case syntax.OpAlternate:
+		most := 0
+		for _, sub := range re.Sub {
+			n := maxWidth(sub)
+			if n < 0 {
+				return -1
+			}
+			if n > most {
+				most = n
+			}
+		}
+		return most
+	case syntax.OpQuest:
+		return maxWidth(re.Sub[0])
+	case syntax.OpRepeat:
+		n := maxWidth(re.Sub[0])
+		if n < 0 || re.Max < 0 {
+			return -1
+		}
+		return n * re.Max
+	case syntax.OpStar, syntax.OpPlus, OpBackref:
+		return -1
+	}
+	return 0 // empty-width assertions and empty matches
+}
+
+// emptyOpFor returns the empty-width condition tested by op.
+func emptyOpFor(op syntax.Op) syntax.EmptyOp {
+	switch op {
+	case syntax.OpBeginLine:
+		return syntax.EmptyBeginLine
+	case syntax.OpEndLine:
+		return syntax.EmptyEndLine
+	case syntax.OpBeginText:
+		return syntax.EmptyBeginText
+	case syntax.OpEndText:
+		return syntax.EmptyEndText
+	case syntax.OpWordBoundary:
+		return syntax.EmptyWordBoundary
+	case syntax.OpNoWordBoundary:
+		return syntax.EmptyNoWordBoundary
+	}
+	return 0
+}
+
+// inClass reports whether c is in the class described by the sorted ranges
+// in runes.
+func inClass(runes []rune, c rune) bool {
+	for j := 0; j+1 < len(runes); j += 2 {
+		if c < runes[j] {
+			return false
+		}
+		if c <= runes[j+1] {
+			return true
+		}
+	}
+	return false
+}
+
+// equalFold reports whether a and b are equal under simple case folding.
+func equalFold(a, b rune) bool {
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return a == b
+}
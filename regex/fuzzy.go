@@ -0,0 +1,207 @@
+package regex
+
+import (
+	"io"
+	"regexp/syntax"
+)
+
+// Approximate matching.
+// A fuzzy search runs the NFA in machine.go with each thread also counting
+// the edits it has made to the input to get this far: a rune instruction
+// can be skipped without reading anything (a deletion), satisfied by a rune
+// it does not match (a substitution), or made to wait while a rune is read
+// (an insertion). Threads are distinguished by both instruction and cost,
+// so the queues have one entry per instruction for each cost allowed. Each
+// thread also records the cost at each of its capture positions, from
+// which the edits made within each subexpression of the match are found.
+// As in TRE, the leftmost match wins, then the one with the fewest edits,
+// and then the one the usual rules prefer. Once a match has been found,
+// threads that cannot find a preferred one are dropped, so the search
+// finishes in one pass over the input. A match never begins with an
+// insertion, since the match after the inserted rune would need one edit
+// fewer.
+
+// fuzzyProg describes the edits allowed in a fuzzy search.
+type fuzzyProg struct {
+	maxEdits int         // limit on edits in the whole match, or 0 if only groups may be edited
+	limits   map[int]int // limits on edits within individual groups
+	group    []int       // innermost group with a limit containing each instruction, or -1
+	total    int         // most edits any match can have
+}
+
+// SetMaxEdits allows future searches to find approximate matches, which
+// match the expression after up to n runes of the input have been inserted,
+// deleted, or substituted. The leftmost match is preferred, and among those
+// that begin there the one with the fewest edits, and then the one the
+// usual semantics prefer. If n is zero then matches must be exact, except
+// within groups given limits by SetGroupMaxEdits. Once edits are allowed,
+// the slices returned by the methods whose names contain SubmatchIndex hold
+// the number of edits made within the match and within each subexpression
+// after the usual index pairs, as returned by SubmatchEdits. It should be
+// called before the Regexp is used, and panics for expressions that use
+// extended syntax.
+func (re *Regexp) SetMaxEdits(n int) {
+	re.fuzzyProg().maxEdits = n
+	re.updateFuzzy()
+}
+
+// SetGroupMaxEdits allows up to n edits within the subexpression with the
+// given index, as for SetMaxEdits. Only the innermost subexpression with a
+// limit is checked. If SetMaxEdits has not been called then edits are made
+// only within subexpressions given limits by this method.
+func (re *Regexp) SetGroupMaxEdits(group, n int) {
+	re.fuzzyProg().limits[group] = n
+	re.updateFuzzy()
+}
+
+// fuzzyProg returns the description of the edits allowed for re, creating
+// it if necessary.
+func (re *Regexp) fuzzyProg() *fuzzyProg {
+	if re.ext != nil {
+		panic("regexp: approximate matching is not supported for " + re.expr + ": it uses backreferences or lookaround")
+	}
+	if re.fuzzy == nil {
+		re.fuzzy = &fuzzyProg{limits: make(map[int]int)}
+	}
+	return re.fuzzy
+}
+
+// updateFuzzy recomputes the per-instruction limits after a setting has
+// changed, and turns fuzzy searching off again if no edits are allowed.
+func (re *Regexp) updateFuzzy() {
+	f := re.fuzzy
+	f.total = f.maxEdits
+	if f.total == 0 {
+		for _, n := range f.limits {
+			f.total += n
+		}
+	}
+	if f.total == 0 {
+		re.fuzzy = nil
+		return
+	}
+
+	regions := groupRegions(re.prog)
+	f.group = make([]int, len(re.prog.Inst))
+	for pc := range f.group {
+		f.group[pc] = -1
+	}
+	for k, n := range f.limits {
+		if n == 0 && f.maxEdits == 0 {
+			continue
+		}
+		for _, pc := range regions[k] {
+			if g := f.group[pc]; g < 0 || len(regions[k]) < len(regions[g]) {
+				f.group[pc] = k
+			}
+		}
+	}
+}
+
+// SubmatchEdits returns the number of edits made within each subexpression
+// of a match, with the total for the whole match at index 0, given the
+// indices loc returned for the match by one of the methods whose names
+// contain SubmatchIndex. It returns nil if approximate matching is not
+// enabled.
+func (re *Regexp) SubmatchEdits(loc []int) []int {
+	n := 1 + re.numSubexp
+	if re.fuzzy == nil || len(loc) != 3*n {
+		return nil
+	}
+	return loc[2*n:]
+}
+
+// fuzzyExecute is like executeAt for fuzzy searches. If all of the
+// captures are requested then the edits made within each of them follow.
+func (re *Regexp) fuzzyExecute(bg *budget, r io.RuneReader, b []byte, s string, pos, limit int, ncap int, dstCap []int) []int {
+	if r != nil {
+		panic("regexp: cannot search for approximate matches of " + re.expr + " in a RuneReader: the input must be read more than once")
+	}
+	m := re.get()
+	m.budget = bg
+	m.limit = limit
+	m.init(re.prog.NumCap)
+	m.initFuzzy(re.fuzzy)
+	var i input
+	if b != nil {
+		i = m.newInputBytes(b)
+	} else {
+		i = m.newInputString(s)
+	}
+	if !m.match(i, pos) {
+		re.put(m)
+		return nil
+	}
+	if ncap < re.prog.NumCap {
+		m.matchcap = m.matchcap[:ncap]
+		return m.finish(ncap, dstCap)
+	}
+
+	n := 1 + re.numSubexp
+	start := len(dstCap)
+	dstCap = append(dstCap, m.matchcap...)
+	for len(dstCap)-start < 2*n {
+		dstCap = append(dstCap, -1)
+	}
+	for k := 0; k < n; k++ {
+		edits := 0
+		if 2*k+1 < len(m.matchcap) && m.matchcap[2*k] >= 0 && m.matchcap[2*k+1] >= 0 {
+			edits = m.matchecap[2*k+1] - m.matchecap[2*k]
+		}
+		dstCap = append(dstCap, edits)
+	}
+	re.put(m)
+	return dstCap
+}
+
+// canEdit reports whether a thread at pc that has made cost edits, with
+// costs at its capture positions given by ecap, may make another.
+func (m *machine) canEdit(pc uint32, cost int, ecap []int) bool {
+	f := m.fuzzy
+	if cost >= f.total {
+		return false
+	}
+	g := f.group[pc]
+	if g < 0 {
+		return f.maxEdits > 0
+	}
+	return cost-ecap[2*g] < f.limits[g]
+}
+
+// mayImprove reports whether thread t could still find an approximate
+// match preferred to the one found so far: one that begins further left,
+// or in the same place with fewer edits, or with as many edits if t takes
+// priority over the match, which above reports, or in leftmost-longest mode
+// if it could be longer.
+func (m *machine) mayImprove(t *thread, above bool) bool {
+	switch {
+	case t.cap[0] != m.matchcap[0]:
+		return t.cap[0] < m.matchcap[0]
+	case t.cost != m.matchcost:
+		return t.cost < m.matchcost
+	}
+	return above || m.re.longest
+}
+
+// stepFuzzy adds to nextq the threads that follow t, which is at pc and
+// has read the rune at pos, in order of priority: the rune matched if ok is
+// true, then substituted for one that matches, and then inserted before
+// pc. It returns t unless t was reused for one of them.
+func (m *machine) stepFuzzy(nextq *queue, pc uint32, t *thread, ok bool, pos, nextPos int, nextCond syntax.EmptyOp) *thread {
+	cost, cap, out := t.cost, t.cap, t.inst.Out
+	m.cost, m.ecap = cost, t.ecap
+	edit := m.canEdit(pc, cost, m.ecap)
+	if ok {
+		t = m.add(nextq, out, nextPos, cap, nextCond, t)
+	}
+	if edit {
+		m.cost = cost + 1
+		if !ok {
+			t = m.add(nextq, out, nextPos, cap, nextCond, t)
+		}
+		if cap[0] != pos {
+			t = m.add(nextq, pc, nextPos, cap, nextCond, t)
+		}
+	}
+	return t
+}
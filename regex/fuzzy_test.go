@@ -0,0 +1,97 @@
+package regex
+
+import (
+	"math/rand"
+	"regexp"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// matchEdits returns the fewest edits, in runes, for text to match pattern
+// without the first rune of text being an insertion, which a fuzzy match
+// never begins with
+func matchEdits(text, pattern string) int {
+	const never = 1 << 20
+	a, b := []rune(text), []rune(pattern)
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = never
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if i > 1 && prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestFuzzyMatchesEditDistance(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, pattern := range []string{"hello", "abcd", "foo.com", "xyx"} {
+		re := MustCompile(regexp.QuoteMeta(pattern))
+		re.SetMaxEdits(2)
+		for i := 0; i < 50; i++ {
+			s := randomText(r, 1+r.Intn(30))
+
+			// the leftmost substring that matches with at most two edits,
+			// and the fewest edits for a substring beginning there
+			begin, best := 0, 3
+			for ; begin <= len(s); begin++ {
+				for end := begin; end <= len(s); end++ {
+					if !utf8.ValidString(s[begin:end]) {
+						continue
+					}
+					if d := matchEdits(s[begin:end], pattern); d < best {
+						best = d
+					}
+				}
+				if best <= 2 {
+					break
+				}
+			}
+
+			loc := re.FindStringSubmatchIndex(s)
+			if best > 2 {
+				assert.Nil(t, loc, "%q in %q", pattern, s)
+				continue
+			}
+			if !assert.NotNil(t, loc, "%q in %q", pattern, s) {
+				continue
+			}
+			edits := re.SubmatchEdits(loc)
+			assert.Equal(t, begin, loc[0], "%q in %q", pattern, s)
+			assert.Equal(t, best, edits[0], "%q in %q", pattern, s)
+			assert.Equal(t, best, matchEdits(s[loc[0]:loc[1]], pattern), "%q in %q", pattern, s)
+		}
+	}
+}
+
+func TestFuzzyGroupLimits(t *testing.T) {
+	re := MustCompile(`(\w+) (colour)`)
+	re.SetGroupMaxEdits(2, 1)
+
+	loc := re.FindStringSubmatchIndex("the color red")
+	assert.Equal(t, []int{0, 9, 0, 3, 4, 9, 1, 0, 1}, loc)
+	assert.Equal(t, []int{1, 0, 1}, re.SubmatchEdits(loc))
+
+	assert.Nil(t, re.FindStringSubmatchIndex("the colr red"))
+	assert.Nil(t, re.FindStringSubmatchIndex("the-colour red"))
+
+	re.SetGroupMaxEdits(2, 0)
+	assert.Nil(t, re.SubmatchEdits([]int{0, 10, 0, 3, 4, 10, 0, 0, 0}))
+}
@@ -0,0 +1,521 @@
+package regex
+
+import (
+	"bytes"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Required literals.
+// Many regexps have no literal prefix but nevertheless contain a literal
+// string, or one of a small set of literal strings, that must appear in
+// every match. For example, every match of `\w+@\w+` contains "@". Before
+// running any of the matching engines we search for such a literal, which
+// is much faster than running the engines over text that cannot match.
+// If the literal does not appear then there is no match, and if there is a
+// bound on how far into a match the literal can appear then we also skip
+// ahead to the first position at which a match could begin.
+
+const (
+	maxExactSet   = 16 // maximum size of a set of exact strings
+	maxExactLen   = 64 // maximum length of a string in a set of exact strings
+	maxLiteralSet = 64 // maximum size of a set of required literals
+	unbounded     = -1 // a length with no upper bound
+	litUTFMax     = utf8.UTFMax
+)
+
+// litInfo describes the literal strings associated with a syntax tree.
+type litInfo struct {
+	exact    []string // every string the tree can match, or nil if unknown
+	required []string // at least one of these is in every match, or nil if none
+	before   int      // max bytes before the required literal within a match, or unbounded
+	maxLen   int      // max bytes in a match, or unbounded
+}
+
+// addLen adds two lengths, either of which may be unbounded.
+func addLen(a, b int) int {
+	if a == unbounded || b == unbounded {
+		return unbounded
+	}
+	return a + b
+}
+
+// maxOf returns the larger of two lengths, either of which may be unbounded.
+func maxOf(a, b int) int {
+	if a == unbounded || b == unbounded {
+		return unbounded
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// usable reports whether a set of literals can be searched for.
+func usable(lits []string) bool {
+	if len(lits) == 0 || len(lits) > maxLiteralSet {
+		return false
+	}
+	for _, lit := range lits {
+		if lit == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// better reports whether the literal set a with bound abefore is more
+// selective than the set b with bound bbefore.
+func better(a []string, abefore int, b []string, bbefore int) bool {
+	if !usable(a) {
+		return false
+	}
+	if !usable(b) {
+		return true
+	}
+	amin, bmin := minLen(a), minLen(b)
+	if amin != bmin {
+		return amin > bmin
+	}
+	if (abefore == unbounded) != (bbefore == unbounded) {
+		return abefore != unbounded
+	}
+	return len(a) < len(b)
+}
+
+func minLen(lits []string) int {
+	n := len(lits[0])
+	for _, lit := range lits[1:] {
+		if len(lit) < n {
+			n = len(lit)
+		}
+	}
+	return n
+}
+
+// dedup sorts and removes duplicates from a set of strings.
+func dedup(set []string) []string {
+	sort.Strings(set)
+	out := set[:0]
+	for i, s := range set {
+		if i == 0 || s != set[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// cross returns the concatenation of each string in a with each string in b,
+// or nil if the result would be too large.
+func cross(a, b []string) []string {
+	if len(a)*len(b) > maxExactSet {
+		return nil
+	}
+	var out []string
+	for _, x := range a {
+		for _, y := range b {
+			if len(x)+len(y) > maxExactLen {
+				return nil
+			}
+			out = append(out, x+y)
+		}
+	}
+	return dedup(out)
+}
+
+// best returns the most selective required literals for a tree.
+func (info litInfo) best() ([]string, int) {
+	if better(info.exact, 0, info.required, info.before) {
+		return info.exact, 0
+	}
+	return info.required, info.before
+}
+
+// analyzeLiterals computes the litInfo for a simplified syntax tree.
+func analyzeLiterals(re *syntax.Regexp) litInfo {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine,
+		syntax.OpBeginText, syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return litInfo{exact: []string{""}, maxLen: 0}
+
+	case syntax.OpLiteral:
+		info := litInfo{maxLen: len(string(re.Rune))}
+		for _, r := range re.Rune {
+			if r == utf8.RuneError {
+				// This also matches invalid UTF-8, which a byte search would miss.
+				return info
+			}
+		}
+		if re.Flags&syntax.FoldCase == 0 {
+			info.exact = []string{string(re.Rune)}
+			return info
+		}
+		info.exact = []string{""}
+		for _, r := range re.Rune {
+			variants := []string{string(r)}
+			for r1 := unicode.SimpleFold(r); r1 != r; r1 = unicode.SimpleFold(r1) {
+				variants = append(variants, string(r1))
+			}
+			if info.exact = cross(info.exact, variants); info.exact == nil {
+				break
+			}
+		}
+		return info
+
+	case syntax.OpCharClass:
+		info := litInfo{maxLen: 0}
+		var count int
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			count += int(re.Rune[i+1]-re.Rune[i]) + 1
+			info.maxLen = utf8.RuneLen(re.Rune[i+1])
+		}
+		if info.maxLen < 0 {
+			info.maxLen = litUTFMax
+		}
+		if count > 0 && count <= maxExactSet {
+			for i := 0; i+1 < len(re.Rune); i += 2 {
+				for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+					if r == utf8.RuneError {
+						return litInfo{maxLen: info.maxLen}
+					}
+					info.exact = append(info.exact, string(r))
+				}
+			}
+		}
+		return info
+
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return litInfo{maxLen: litUTFMax}
+
+	case syntax.OpCapture:
+		return analyzeLiterals(re.Sub[0])
+
+	case syntax.OpQuest:
+		sub := analyzeLiterals(re.Sub[0])
+		info := litInfo{maxLen: sub.maxLen}
+		if sub.exact != nil && len(sub.exact) < maxExactSet {
+			info.exact = dedup(append(append([]string{}, sub.exact...), ""))
+		}
+		return info
+
+	case syntax.OpStar:
+		sub := analyzeLiterals(re.Sub[0])
+		if sub.maxLen == 0 {
+			return litInfo{exact: []string{""}, maxLen: 0}
+		}
+		return litInfo{maxLen: unbounded}
+
+	case syntax.OpPlus, syntax.OpRepeat:
+		sub := analyzeLiterals(re.Sub[0])
+		info := litInfo{maxLen: unbounded}
+		if re.Op == syntax.OpRepeat && re.Max >= 0 && sub.maxLen != unbounded {
+			info.maxLen = sub.maxLen * re.Max
+		}
+		if sub.maxLen == 0 {
+			info.maxLen = 0
+		}
+		if re.Op == syntax.OpPlus || re.Min >= 1 {
+			// The first repetition contains the required literal.
+			info.required, info.before = sub.best()
+		}
+		return info
+
+	case syntax.OpConcat:
+		var info litInfo
+		var run []string // cross product of a run of consecutive exact subs
+		var runStart int // offset of the start of the run
+		offset := 0      // max offset of the current sub from the start
+		allExact := true
+		consider := func(lits []string, before int) {
+			if better(lits, before, info.required, info.before) {
+				info.required, info.before = lits, before
+			}
+		}
+		for _, sub := range re.Sub {
+			x := analyzeLiterals(sub)
+			if run != nil && x.exact != nil {
+				if next := cross(run, x.exact); next != nil {
+					run = next
+					offset = addLen(offset, x.maxLen)
+					continue
+				}
+			}
+			if run != nil {
+				consider(run, runStart)
+			}
+			run, runStart = x.exact, offset
+			if x.exact == nil {
+				allExact = false
+			}
+			lits, before := x.required, x.before
+			consider(lits, addLen(offset, before))
+			offset = addLen(offset, x.maxLen)
+		}
+		if run != nil {
+			consider(run, runStart)
+		}
+		if allExact && run != nil && runStart == 0 {
+			info.exact = run
+		}
+		info.maxLen = offset
+		return info
+
+	case syntax.OpAlternate:
+		// Every alternative must contribute literals to the required set
+		info := litInfo{exact: []string{}, before: 0, maxLen: 0}
+		var required []string
+		for _, sub := range re.Sub {
+			x := analyzeLiterals(sub)
+			info.maxLen = maxOf(info.maxLen, x.maxLen)
+			if info.exact != nil && x.exact != nil && len(info.exact)+len(x.exact) <= maxExactSet {
+				info.exact = append(info.exact, x.exact...)
+			} else {
+				info.exact = nil
+			}
+			if required != nil || info.before != unbounded {
+				lits, before := x.best()
+				if usable(lits) && len(required)+len(lits) <= maxLiteralSet {
+					required = append(required, lits...)
+					info.before = maxOf(info.before, before)
+				} else {
+					required = nil
+					info.before = unbounded
+				}
+			}
+		}
+		if info.exact != nil {
+			info.exact = dedup(info.exact)
+		}
+		if required != nil {
+			info.required = dedup(required)
+		}
+		return info
+	}
+	return litInfo{maxLen: unbounded}
+}
+
+// requiredLiterals returns a set of literal strings, one of which appears in
+// every match of the simplified syntax tree re, together with the maximum
+// number of bytes between the start of a match and the start of the literal,
+// or unbounded if there is no such limit. It returns nil if there is no such
+// set of literals.
+func requiredLiterals(re *syntax.Regexp) ([]string, int) {
+	lits, before := analyzeLiterals(re).best()
+	if !usable(lits) {
+		return nil, unbounded
+	}
+	return lits, before
+}
+
+// RequiredLiterals returns a set of literal strings, at least one of which
+// appears in every match of the regular expression. It returns nil if the
+// analysis could not find any such set.
+func (re *Regexp) RequiredLiterals() []string {
+	return re.required
+}
+
+// skipToRequired returns the first position at or after pos where a match
+// could begin, based on the location of the required literals, or -1 if
+// there can be no match at or after pos that begins before limit.
+func (re *Regexp) skipToRequired(b []byte, s string, pos, limit int) int {
+	n := len(s)
+	if b != nil {
+		n = len(b)
+	}
+	if re.requiredBefore != unbounded && limit < n-re.requiredBefore-re.requiredMax {
+		// A literal after this cannot belong to a match that begins
+		// before limit.
+		n = limit + re.requiredBefore + re.requiredMax
+	}
+
+	var end int // end of the first literal found
+	switch {
+	case re.requiredSet != nil && b != nil:
+		end = re.requiredSet.indexEnd(b[pos:n])
+	case re.requiredSet != nil:
+		end = re.requiredSet.indexEndString(s[pos:n])
+	case b != nil:
+		end = bytes.Index(b[pos:n], re.requiredBytes)
+		if end >= 0 {
+			end += len(re.requiredBytes)
+		}
+	default:
+		end = strings.Index(s[pos:n], re.required[0])
+		if end >= 0 {
+			end += len(re.required[0])
+		}
+	}
+	if end < 0 {
+		return -1
+	}
+	if re.requiredBefore == unbounded {
+		return pos
+	}
+
+	// The first literal to end might not be the first literal to start, but
+	// no literal can start earlier than the longest literal before its end.
+	start := pos + end - re.requiredMax - re.requiredBefore
+	if start < pos {
+		return pos
+	}
+	// The lengths are in bytes, so start may fall within a rune.
+	return re.runeStart(b, s, start)
+}
+
+// literalSet is an Aho-Corasick automaton that searches for any of a set
+// of literal strings at once.
+type literalSet struct {
+	classes [256]uint8 // byte classes; bytes not in any literal are class 0
+	nclass  int
+	trans   []int32 // trans[state*nclass+class] is the next state
+	final   []bool  // final[state] is true if a literal ends at state
+}
+
+func newLiteralSet(lits []string) *literalSet {
+	ls := &literalSet{nclass: 1}
+	for _, lit := range lits {
+		for i := 0; i < len(lit); i++ {
+			if ls.classes[lit[i]] == 0 {
+				ls.classes[lit[i]] = uint8(ls.nclass)
+				ls.nclass++
+			}
+		}
+	}
+
+	// Build the trie, with -1 for missing edges
+	newState := func() int32 {
+		for i := 0; i < ls.nclass; i++ {
+			ls.trans = append(ls.trans, -1)
+		}
+		ls.final = append(ls.final, false)
+		return int32(len(ls.final) - 1)
+	}
+	newState()
+	for _, lit := range lits {
+		var state int32
+		for i := 0; i < len(lit); i++ {
+			k := int(state)*ls.nclass + int(ls.classes[lit[i]])
+			if ls.trans[k] < 0 {
+				next := newState()
+				ls.trans[k] = next
+			}
+			state = ls.trans[k]
+		}
+		ls.final[state] = true
+	}
+
+	// Fill in the missing edges using failure links, breadth first
+	fail := make([]int32, len(ls.final))
+	var queue []int32
+	for c := 0; c < ls.nclass; c++ {
+		if next := ls.trans[c]; next > 0 {
+			queue = append(queue, next)
+		} else {
+			ls.trans[c] = 0
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		ls.final[state] = ls.final[state] || ls.final[fail[state]]
+		for c := 0; c < ls.nclass; c++ {
+			k := int(state)*ls.nclass + c
+			f := ls.trans[int(fail[state])*ls.nclass+c]
+			if next := ls.trans[k]; next >= 0 {
+				fail[next] = f
+				queue = append(queue, next)
+			} else {
+				ls.trans[k] = f
+			}
+		}
+	}
+	return ls
+}
+
+// indexEnd returns the position just after the first literal to end in b,
+// or -1 if there is none.
+func (ls *literalSet) indexEnd(b []byte) int {
+	var state int32
+	for i, c := range b {
+		state = ls.trans[int(state)*ls.nclass+int(ls.classes[c])]
+		if ls.final[state] {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// indexEndString is like indexEnd but for strings.
+func (ls *literalSet) indexEndString(s string) int {
+	var state int32
+	for i := 0; i < len(s); i++ {
+		state = ls.trans[int(state)*ls.nclass+int(ls.classes[s[i]])]
+		if ls.final[state] {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// prefixLiterals returns a set of literal strings, one of which begins
+// every match of the simplified syntax tree re, or nil if there is no such
+// set.
+func prefixLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpCapture, syntax.OpPlus:
+		return prefixLiterals(re.Sub[0])
+
+	case syntax.OpConcat:
+		run := []string{""}
+		for _, sub := range re.Sub {
+			if x := analyzeLiterals(sub); x.exact != nil {
+				if next := cross(run, x.exact); next != nil {
+					run = next
+					continue
+				}
+			} else if lits := prefixLiterals(sub); lits != nil {
+				if next := cross(run, lits); next != nil {
+					run = next
+				}
+			}
+			break
+		}
+		if !usable(run) {
+			return nil
+		}
+		return run
+
+	case syntax.OpAlternate:
+		var lits []string
+		for _, sub := range re.Sub {
+			x := prefixLiterals(sub)
+			if x == nil || len(lits)+len(x) > maxExactSet {
+				return nil
+			}
+			lits = append(lits, x...)
+		}
+		return dedup(lits)
+	}
+
+	if x := analyzeLiterals(re); usable(x.exact) {
+		return x.exact
+	}
+	return nil
+}
+
+// suffixLiterals returns a set of literal strings, one of which ends every
+// match of the simplified syntax tree re, or nil if there is no such set.
+func suffixLiterals(re *syntax.Regexp) []string {
+	lits := prefixLiterals(reverseSyntax(re))
+	for i, lit := range lits {
+		runes := []rune(lit)
+		for j, k := 0, len(runes)-1; j < k; j, k = j+1, k-1 {
+			runes[j], runes[k] = runes[k], runes[j]
+		}
+		lits[i] = string(runes)
+	}
+	return lits
+}
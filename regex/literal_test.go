@@ -0,0 +1,50 @@
+package regex
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredLiterals(t *testing.T) {
+	assert.Equal(t, []string{"@"}, MustCompile(`\w+@\w+`).RequiredLiterals())
+	assert.Equal(t, []string{"ERROR:", "FATAL:"}, MustCompile(`(ERROR|FATAL):\s+`).RequiredLiterals())
+	assert.Equal(t, []string{".com", ".org"}, MustCompile(`^[a-z]+@(\w+)\.(com|org)$`).RequiredLiterals())
+	assert.Nil(t, MustCompile(`\w+`).RequiredLiterals())
+	assert.Nil(t, MustCompile(`a|\w+`).RequiredLiterals())
+}
+
+func TestRequiredLiteralsMultibyte(t *testing.T) {
+	// The required literal is found a fixed number of bytes after the
+	// earliest place a match could begin, which may fall within a rune
+	patterns := []string{
+		`((((?m:^)|x))?|.)(?:c)+?((\B|(?:.)+?))*`,
+		`.c`,
+		`..@\w+`,
+		`[^a]{2}xyz`,
+		`(é|ab)c`,
+	}
+	r := rand.New(rand.NewSource(1))
+	fragments := []string{"c", "é", "€", "1", "a", "xyz", "@", "\n", "𝄞"}
+	for _, pattern := range patterns {
+		ours, theirs := MustCompile(pattern), regexp.MustCompile(pattern)
+		for i := 0; i < 20; i++ {
+			var sb strings.Builder
+			for n := r.Intn(10); n >= 0; n-- {
+				sb.WriteString(fragments[r.Intn(len(fragments))])
+			}
+			s := sb.String() + strings.Repeat(" ", 20000)
+			if !assert.Equal(t, theirs.FindAllStringIndex(s, -1), ours.FindAllStringIndex(s, -1), "%s on %q", pattern, s[:len(s)-20000]) {
+				break
+			}
+			assert.Equal(t, theirs.FindAllIndex([]byte(s), -1), ours.FindAllIndex([]byte(s), -1), pattern)
+		}
+	}
+
+	s := "c1éé1c" + strings.Repeat(" ", 20000)
+	re := MustCompile(patterns[0])
+	assert.Equal(t, regexp.MustCompile(patterns[0]).FindAllStringIndex(s, -1), re.FindAllStringIndex(s, -1))
+}
@@ -20,9 +20,12 @@ type queue struct {
 // It holds both the instruction pc and the actual thread.
 // Some queue entries are just place holders so that the machine
 // knows it has considered that pc.  Such entries have t == nil.
+// In an approximate search there is an entry for each pc at each
+// number of edits, and key combines the two.
 type entry struct {
-	pc uint32
-	t  *thread
+	pc  uint32
+	key uint32
+	t   *thread
 }
 
 // A thread is the state of a single path through the machine:
@@ -31,6 +34,8 @@ type entry struct {
 type thread struct {
 	inst *syntax.Inst
 	cap  []int
+	cost int   // edits made so far, in an approximate search
+	ecap []int // edits made before each capture position was recorded
 }
 
 // A machine holds all the state during an NFA simulation for p.
@@ -40,10 +45,24 @@ type machine struct {
 	op             *onePassProg // compiled onepass program, or notOnePass
 	maxBitStateLen int          // max length of string to search with bitstate
 	b              *bitState    // state for backtracker, allocated lazily
+	fwd, rev       *dfa         // lazy DFAs for locating matches, allocated lazily
+	last           *dfa         // lazy DFA for locating the last match, allocated lazily
+	budget         *budget      // limits the work done by the current call, or nil
+	partial        bool         // record threads still running at the end of the input
+	hitEnd         bool         // a thread was still running at the end of the input
+	partialcap     []int        // capture information for that thread
+	waiting        []waiting    // every thread still running at the end of the input
 	q0, q1         queue        // two queues for runq, nextq
 	pool           []*thread    // pool of available threads
 	matched        bool         // whether a match was found
+	limit          int          // only begin a match before this position
 	matchcap       []int        // capture information for the match
+	fuzzy          *fuzzyProg   // edits allowed in an approximate search, or nil
+	matchcost      int          // edits made by the match, in an approximate search
+	matchecap      []int        // edits made before each capture position of the match
+	outrank        int          // number of threads on runq that take priority over the match
+	cost           int          // edits made by the thread being added, in an approximate search
+	ecap           []int        // edits made before each capture position of that thread
 
 	// cached inputs, to avoid allocation
 	inputBytes  inputBytes
@@ -53,11 +72,15 @@ type machine struct {
 
 func (m *machine) newInputBytes(b []byte) input {
 	m.inputBytes.str = b
+	m.inputBytes.latin1 = m.re.latin1
+	m.inputBytes.empty = m.re.empty
 	return &m.inputBytes
 }
 
 func (m *machine) newInputString(s string) input {
 	m.inputString.str = s
+	m.inputString.latin1 = m.re.latin1
+	m.inputString.empty = m.re.empty
 	return &m.inputString
 }
 
@@ -78,9 +101,6 @@ func progMachine(p *syntax.Prog, op *onePassProg) *machine {
 	if ncap < 2 {
 		ncap = 2
 	}
-	if op == notOnePass {
-		m.maxBitStateLen = maxBitStateLen(p)
-	}
 	m.matchcap = make([]int, ncap)
 	return m
 }
@@ -92,6 +112,21 @@ func (m *machine) init(ncap int) {
 	m.matchcap = m.matchcap[:ncap]
 }
 
+// initFuzzy prepares m for an approximate search allowing the edits
+// described by f, after init. The queues need room for a thread at each
+// instruction for each number of edits.
+func (m *machine) initFuzzy(f *fuzzyProg) {
+	m.fuzzy = f
+	n := len(m.p.Inst) * (f.total + 1)
+	if len(m.q0.sparse) < n {
+		m.q0 = queue{make([]uint32, n), make([]entry, 0, n)}
+		m.q1 = queue{make([]uint32, n), make([]entry, 0, n)}
+	}
+	if len(m.matchecap) != len(m.matchcap) {
+		m.matchecap = make([]int, len(m.matchcap))
+	}
+}
+
 // alloc allocates a new thread with the given instruction.
 // It uses the free pool if possible.
 func (m *machine) alloc(i *syntax.Inst) *thread {
@@ -103,6 +138,9 @@ func (m *machine) alloc(i *syntax.Inst) *thread {
 		t = new(thread)
 		t.cap = make([]int, len(m.matchcap), cap(m.matchcap))
 	}
+	if m.fuzzy != nil && len(t.ecap) != len(t.cap) {
+		t.ecap = make([]int, len(t.cap))
+	}
 	t.inst = i
 	return t
 }
@@ -127,6 +165,10 @@ func (m *machine) match(i input, pos int) bool {
 	for i := range m.matchcap {
 		m.matchcap[i] = -1
 	}
+	for i := range m.matchecap {
+		m.matchecap[i] = 0
+	}
+	m.matchcost, m.outrank = 0, 0
 	runq, nextq := &m.q0, &m.q1
 	r, r1 := endOfText, endOfText
 	width, width1 := 0, 0
@@ -136,24 +178,34 @@ func (m *machine) match(i input, pos int) bool {
 	}
 	var flag syntax.EmptyOp
 	if pos == 0 {
-		flag = syntax.EmptyOpContext(-1, r)
+		flag = m.re.empty.context(endOfText, r)
 	} else {
 		flag = i.context(pos)
 	}
 	for {
+		if !m.budget.spend(len(runq.dense) + 1) {
+			m.matched = false
+			break
+		}
 		if len(runq.dense) == 0 {
 			if startCond&syntax.EmptyBeginText != 0 && pos != 0 {
 				// Anchored match, past beginning of text.
 				break
 			}
+			if pos >= m.limit {
+				// No match can begin here or later.
+				break
+			}
 			if m.matched {
 				// Have match; finished exploring alternatives.
 				break
 			}
-			if len(m.re.prefix) > 0 && r1 != m.re.prefixRune && i.canCheckPrefix() {
-				// Match requires literal prefix; fast search for it.
+			if len(m.re.prefix) > 0 && r1 != m.re.prefixRune && i.canCheckPrefix() && !m.partial &&
+				m.fuzzy == nil && startCond&syntax.EmptyBeginText == 0 {
+				// Match requires literal prefix; fast search for it. The
+				// prefix of an anchored onepass program follows the anchor.
 				advance := i.index(m.re, pos)
-				if advance < 0 {
+				if advance < 0 || pos+advance >= m.limit {
 					break
 				}
 				pos += advance
@@ -161,13 +213,14 @@ func (m *machine) match(i input, pos int) bool {
 				r1, width1 = i.step(pos + width)
 			}
 		}
-		if !m.matched {
+		if !m.matched && pos < m.limit {
 			if len(m.matchcap) > 0 {
 				m.matchcap[0] = pos
 			}
+			m.cost, m.ecap = 0, m.matchecap
 			m.add(runq, uint32(m.p.Start), pos, m.matchcap, flag, nil)
 		}
-		flag = syntax.EmptyOpContext(r, r1)
+		flag = m.re.empty.context(r, r1)
 		m.step(runq, nextq, pos, pos+width, r, flag)
 		if width == 0 {
 			break
@@ -204,15 +257,26 @@ func (m *machine) clear(q *queue) {
 // The step processes the rune c (which may be endOfText),
 // which starts at position pos and ends at nextPos.
 // nextCond gives the setting for the empty-width flags after c.
+//
+// In an approximate search each thread may also substitute the rune for
+// one its instruction matches, or insert it before that instruction, if
+// it may still make edits. A thread that can no longer find a match
+// preferred to the one found so far is dropped instead.
 func (m *machine) step(runq, nextq *queue, pos, nextPos int, c rune, nextCond syntax.EmptyOp) {
 	longest := m.re.longest
+	fuzzy := m.fuzzy != nil
+	nextOutrank := -1
 	for j := 0; j < len(runq.dense); j++ {
+		if fuzzy && j == m.outrank && nextOutrank < 0 {
+			nextOutrank = len(nextq.dense)
+		}
 		d := &runq.dense[j]
 		t := d.t
 		if t == nil {
 			continue
 		}
-		if longest && m.matched && len(t.cap) > 0 && m.matchcap[0] < t.cap[0] {
+		if longest && m.matched && len(t.cap) > 0 && m.matchcap[0] < t.cap[0] ||
+			fuzzy && m.matched && !m.mayImprove(t, j < m.outrank) {
 			// m.free(t)
 			m.pool = append(m.pool, t)
 			continue
@@ -224,6 +288,20 @@ func (m *machine) step(runq, nextq *queue, pos, nextPos int, c rune, nextCond sy
 			panic("bad inst")
 
 		case syntax.InstMatch:
+			if fuzzy {
+				// Threads that survived mayImprove are preferred to the
+				// match found so far, except that in leftmost-longest mode
+				// one with as many edits must also be longer.
+				if !longest || !m.matched || t.cap[0] < m.matchcap[0] || t.cost < m.matchcost || m.matchcap[1] < pos {
+					t.cap[1], t.ecap[1] = pos, t.cost
+					copy(m.matchcap, t.cap)
+					copy(m.matchecap, t.ecap)
+					m.matchcost = t.cost
+					m.outrank, nextOutrank = j, len(nextq.dense)
+				}
+				m.matched = true
+				break
+			}
 			if len(t.cap) > 0 && (!longest || !m.matched || m.matchcap[1] < pos) {
 				t.cap[1] = pos
 				copy(m.matchcap, t.cap)
@@ -249,7 +327,22 @@ func (m *machine) step(runq, nextq *queue, pos, nextPos int, c rune, nextCond sy
 		case syntax.InstRuneAnyNotNL:
 			add = c != '\n'
 		}
-		if add {
+		if c == endOfText && m.partial && i.Op != syntax.InstMatch && !m.hitEnd {
+			// This thread wanted more input. Threads are visited in
+			// priority order, so the first one is the one to report.
+			m.hitEnd = true
+			copy(m.partialcap, t.cap)
+		}
+		if c == endOfText && m.partial && i.Op != syntax.InstMatch {
+			start := -1
+			if len(t.cap) > 0 {
+				start = t.cap[0]
+			}
+			m.waiting = append(m.waiting, waiting{pc: d.pc, start: start})
+		}
+		if fuzzy && c != endOfText && i.Op != syntax.InstMatch {
+			t = m.stepFuzzy(nextq, d.pc, t, add, pos, nextPos, nextCond)
+		} else if add {
 			t = m.add(nextq, i.Out, nextPos, t.cap, nextCond, t)
 		}
 		if t != nil {
@@ -257,6 +350,12 @@ func (m *machine) step(runq, nextq *queue, pos, nextPos int, c rune, nextCond sy
 			m.pool = append(m.pool, t)
 		}
 	}
+	if fuzzy {
+		if nextOutrank < 0 {
+			nextOutrank = len(nextq.dense)
+		}
+		m.outrank = nextOutrank
+	}
 	runq.dense = runq.dense[:0]
 }
 
@@ -264,11 +363,21 @@ func (m *machine) step(runq, nextq *queue, pos, nextPos int, c rune, nextCond sy
 // It also recursively adds an entry for all instructions reachable from pc by following
 // empty-width conditions satisfied by cond.  pos gives the current position
 // in the input.
+//
+// In an approximate search, m.cost gives the edits made so far and m.ecap
+// the edits made before each capture position, and the entries are
+// distinct for each cost. A rune instruction reached may also be skipped,
+// as if the rune it matches had been deleted from the input, if the thread
+// may still make edits.
 func (m *machine) add(q *queue, pc uint32, pos int, cap []int, cond syntax.EmptyOp, t *thread) *thread {
 	if pc == 0 {
 		return t
 	}
-	if j := q.sparse[pc]; j < uint32(len(q.dense)) && q.dense[j].pc == pc {
+	key := pc
+	if m.fuzzy != nil {
+		key = pc*uint32(m.fuzzy.total+1) + uint32(m.cost)
+	}
+	if j := q.sparse[key]; j < uint32(len(q.dense)) && q.dense[j].key == key {
 		return t
 	}
 
@@ -277,7 +386,8 @@ func (m *machine) add(q *queue, pc uint32, pos int, cap []int, cond syntax.Empty
 	d := &q.dense[j]
 	d.t = nil
 	d.pc = pc
-	q.sparse[pc] = uint32(j)
+	d.key = key
+	q.sparse[key] = uint32(j)
 
 	i := &m.p.Inst[pc]
 	switch i.Op {
@@ -298,7 +408,14 @@ func (m *machine) add(q *queue, pc uint32, pos int, cap []int, cond syntax.Empty
 		if int(i.Arg) < len(cap) {
 			opos := cap[i.Arg]
 			cap[i.Arg] = pos
-			m.add(q, i.Out, pos, cap, cond, nil)
+			if m.fuzzy != nil {
+				ocost := m.ecap[i.Arg]
+				m.ecap[i.Arg] = m.cost
+				m.add(q, i.Out, pos, cap, cond, nil)
+				m.ecap[i.Arg] = ocost
+			} else {
+				m.add(q, i.Out, pos, cap, cond, nil)
+			}
 			cap[i.Arg] = opos
 		} else {
 			t = m.add(q, i.Out, pos, cap, cond, t)
@@ -313,20 +430,119 @@ func (m *machine) add(q *queue, pc uint32, pos int, cap []int, cond syntax.Empty
 			copy(t.cap, cap)
 		}
 		d.t = t
+		if m.fuzzy != nil {
+			t.cost = m.cost
+			if &t.ecap[0] != &m.ecap[0] {
+				copy(t.ecap, m.ecap)
+			}
+			if i.Op != syntax.InstMatch && m.canEdit(pc, m.cost, m.ecap) {
+				m.cost++
+				m.add(q, i.Out, pos, cap, cond, nil)
+				m.cost--
+			}
+		}
 		t = nil
 	}
 	return t
 }
 
+// locate runs the lazy DFAs over the input to find the position at which
+// the leftmost match at or after pos begins, or -1 if there is no match
+// that begins before limit. If
+// ncap is zero then it only determines whether there is a match, and the
+// position is not meaningful. It returns false if the DFA had to give up,
+// in which case the NFA must be used instead.
+func (m *machine) locate(i input, pos, limit, size int, ncap int) (int, bool) {
+	anchored := m.re.cond&syntax.EmptyBeginText != 0
+	if anchored && pos != 0 {
+		return -1, true
+	}
+	if m.rev == nil {
+		m.rev = newDFA(m.re.reverseProg(), m.re.empty, true, true, true)
+	}
+
+	// If every match ends at the end of the text then the reverse DFA can
+	// find the leftmost match on its own, by running backwards from the end.
+	if m.re.reverseAnchored && !anchored {
+		start, ok := m.rev.search(i, size, pos, false, m.re, false, m.budget)
+		if start >= limit {
+			start = -1
+		}
+		return start, ok
+	}
+
+	// The forward DFA uses leftmost-first semantics to find the end of the
+	// leftmost match. This is also where the leftmost-longest match begins.
+	if m.fwd == nil {
+		m.fwd = newDFA(m.p, m.re.empty, anchored, false, false)
+		m.fwd.mayFail = true
+	}
+	if m.fwd.failed {
+		return -1, false
+	}
+	prefix := len(m.re.prefix) > 0 && !anchored
+	end, ok := m.fwd.search(i, pos, limit, prefix, m.re, ncap == 0, m.budget)
+	if !ok || end < 0 || ncap == 0 {
+		return end, ok
+	}
+
+	// The reverse DFA runs backwards from the end of the match to find the
+	// earliest position at which a match ending there can begin.
+	start, _ := m.rev.search(i, end, pos, false, m.re, false, m.budget)
+	if start < 0 {
+		// Cannot happen if the forward DFA found a match, but be safe.
+		return -1, false
+	}
+	return start, true
+}
+
 // empty is a non-nil 0-element slice,
 // so doExecute can avoid an allocation
 // when 0 captures are requested from a successful match.
 var empty = make([]int, 0)
 
-// doExecute finds the leftmost match in the input and returns
-// the position of its subexpressions.
-func (re *Regexp) doExecute(r io.RuneReader, b []byte, s string, pos int, ncap int) []int {
+// doExecute finds the leftmost match in the input, appends the position
+// of its subexpressions to dstCap and returns the result.
+func (re *Regexp) doExecute(r io.RuneReader, b []byte, s string, pos int, ncap int, dstCap []int) []int {
+	return re.execute(re.newBudget(nil), r, b, s, pos, ncap, dstCap)
+}
+
+// execute is like doExecute but spends steps from bg, which may be nil. If
+// bg runs out then it returns nil, and bg records the reason.
+func (re *Regexp) execute(bg *budget, r io.RuneReader, b []byte, s string, pos int, ncap int, dstCap []int) []int {
+	return re.executeAt(bg, r, b, s, pos, noLimit, ncap, dstCap)
+}
+
+// noLimit is the limit passed to executeAt for a search in which a match
+// may begin anywhere after pos.
+const noLimit = int(^uint(0) >> 1)
+
+// executeAt is like execute but only finds a match that begins before
+// limit, so that a search anchored at pos passes pos+1.
+func (re *Regexp) executeAt(bg *budget, r io.RuneReader, b []byte, s string, pos, limit int, ncap int, dstCap []int) []int {
+	if pos >= limit {
+		return nil
+	}
+	if re.ext != nil {
+		return re.extExecute(bg, r, b, s, pos, limit, ncap, dstCap)
+	}
+	if re.fuzzy != nil {
+		return re.fuzzyExecute(bg, r, b, s, pos, limit, ncap, dstCap)
+	}
+	if r == nil && re.required != nil {
+		// Search for the required literals, which is faster than running
+		// any of the engines over text that cannot contain a match.
+		start := re.skipToRequired(b, s, pos, limit)
+		if start < 0 || start >= limit {
+			return nil
+		}
+		if re.cond&syntax.EmptyBeginText == 0 {
+			pos = start
+		}
+	}
 	m := re.get()
+	m.budget = bg
+	m.limit = limit
 	var i input
 	var size int
 	if r != nil {
@@ -338,7 +554,37 @@ func (re *Regexp) doExecute(r io.RuneReader, b []byte, s string, pos int, ncap i
 		i = m.newInputString(s)
 		size = len(s)
 	}
-	if size < m.maxBitStateLen && r == nil {
+	allowed := re.strategies
+	if allowed&OnePass != 0 && re.onepass != notOnePass {
+		if !m.onepass(i, pos, ncap) {
+			re.put(m)
+			return nil
+		}
+		return m.finish(ncap, dstCap)
+	}
+	// The backtracker is used for inputs short enough for it, or for all
+	// inputs if the NFA is not allowed.
+	backtrack := r == nil && allowed&Backtrack != 0 && shouldBacktrack(re.prog) &&
+		(size < m.maxBitStateLen || allowed&NFA == 0)
+	if r == nil && (!backtrack || size >= m.maxBitStateLen) && allowed&DFA != 0 && re.useDFA && limit > pos+1 {
+		// Use the DFA to find where the match is, if there is one, so
+		// that the NFA only needs to run over the matched text.
+		if start, ok := m.locate(i, pos, limit, size, ncap); ok {
+			if start < 0 {
+				re.put(m)
+				return nil
+			}
+			if ncap == 0 {
+				re.put(m)
+				if dstCap == nil {
+					return empty
+				}
+				return dstCap
+			}
+			pos = start
+		}
+	}
+	if backtrack {
 		if m.b == nil {
 			m.b = newBitState(m.p)
 		}
@@ -353,12 +599,123 @@ func (re *Regexp) doExecute(r io.RuneReader, b []byte, s string, pos int, ncap i
 			return nil
 		}
 	}
+	return m.finish(ncap, dstCap)
+}
+
+// finish appends the captures for the match that m found to dstCap, and
+// returns m to its Regexp's cache.
+func (m *machine) finish(ncap int, dstCap []int) []int {
+	re := m.re
 	if ncap == 0 {
 		re.put(m)
-		return empty // empty but not nil
+		if dstCap == nil {
+			return empty // empty but not nil
+		}
+		return dstCap
 	}
-	cap := make([]int, len(m.matchcap))
-	copy(cap, m.matchcap)
+	dstCap = append(dstCap, m.matchcap...)
 	re.put(m)
-	return cap
+	return dstCap
+}
+
+// onepass runs the onepass program for m's Regexp over the input starting
+// at pos, which can only match if pos is at the beginning of the text.
+// It reports whether a match was found. If so, m.matchcap holds the
+// submatch information.
+func (m *machine) onepass(i input, pos int, ncap int) bool {
+	re := m.re
+	startCond := re.cond
+	if startCond == ^syntax.EmptyOp(0) { // impossible
+		return false
+	}
+	m.matchcap = m.matchcap[:ncap]
+	for j := range m.matchcap {
+		m.matchcap[j] = -1
+	}
+
+	r, r1 := endOfText, endOfText
+	width, width1 := 0, 0
+	r, width = i.step(pos)
+	if r != endOfText {
+		r1, width1 = i.step(pos + width)
+	}
+	var flag syntax.EmptyOp
+	if pos == 0 {
+		flag = re.empty.context(endOfText, r)
+	} else {
+		flag = i.context(pos)
+	}
+	pc := re.onepass.Start
+	inst := &re.onepass.Inst[pc]
+	// If there is a simple literal prefix, skip over it.
+	if pos == 0 && inst.Op == syntax.InstEmptyWidth && syntax.EmptyOp(inst.Arg)&^flag == 0 &&
+		len(re.prefix) > 0 && i.canCheckPrefix() {
+		// Match requires literal prefix; fast search for it.
+		if !i.hasPrefix(re) {
+			return false
+		}
+		pos += len(re.prefix)
+		r, width = i.step(pos)
+		r1, width1 = i.step(pos + width)
+		flag = i.context(pos)
+		pc = int(re.prefixEnd)
+	}
+	for {
+		if !m.budget.spend(1) {
+			return false
+		}
+		inst = &re.onepass.Inst[pc]
+		pc = int(inst.Out)
+		switch inst.Op {
+		default:
+			panic("bad inst")
+		case syntax.InstMatch:
+			if len(m.matchcap) > 0 {
+				m.matchcap[0] = 0
+				m.matchcap[1] = pos
+			}
+			return true
+		case syntax.InstRune:
+			if !inst.MatchRune(r) {
+				return false
+			}
+		case syntax.InstRune1:
+			if r != inst.Rune[0] {
+				return false
+			}
+		case syntax.InstRuneAny:
+			// Nothing
+		case syntax.InstRuneAnyNotNL:
+			if r == '\n' {
+				return false
+			}
+		// peek at the input rune to see which branch of the Alt to take
+		case syntax.InstAlt, syntax.InstAltMatch:
+			pc = int(onePassNext(inst, r))
+			continue
+		case syntax.InstFail:
+			return false
+		case syntax.InstNop:
+			continue
+		case syntax.InstEmptyWidth:
+			if syntax.EmptyOp(inst.Arg)&^flag != 0 {
+				return false
+			}
+			continue
+		case syntax.InstCapture:
+			if int(inst.Arg) < len(m.matchcap) {
+				m.matchcap[inst.Arg] = pos
+			}
+			continue
+		}
+		if width == 0 {
+			return false
+		}
+		flag = re.empty.context(r, r1)
+		pos += width
+		r, width = r1, width1
+		if r != endOfText {
+			r1, width1 = i.step(pos + width)
+		}
+	}
 }
@@ -533,40 +533,54 @@ func find(prog *syntax.Prog, f func(*syntax.Prog, int) bool) (matches []uint32)
 
 var notOnePass *onePassProg = nil
 
+// Reasons that compileOnePass gives for a Prog not being onepass.
+const (
+	notOnePassEmpty     = "the program is empty"
+	notOnePassBegin     = "the expression is not anchored at the beginning of the text"
+	notOnePassEnd       = "the expression is not anchored at the end of the text"
+	notOnePassTooLong   = "the program has too many instructions"
+	notOnePassAmbiguous = "the next character does not always decide which branch of an alternation or repetition to take"
+	notOnePassExtended  = "the expression uses extended syntax"
+)
+
 // compileOnePass returns a new *syntax.Prog suitable for onePass execution if the original Prog
 // can be recharacterized as a one-pass regexp program, or syntax.notOnePass if the
-// Prog cannot be converted. For a one pass prog, the fundamental condition that must
-// be true is: at any InstAlt, there must be no ambiguity about what branch to  take.
-func compileOnePass(prog *syntax.Prog) (p *onePassProg) {
+// Prog cannot be converted, together with the reason why not. For a one pass prog, the
+// fundamental condition that must be true is: at any InstAlt, there must be no ambiguity
+// about what branch to  take.
+func compileOnePass(prog *syntax.Prog) (p *onePassProg, reason string) {
 	if prog.Start == 0 {
-		return notOnePass
+		return notOnePass, notOnePassEmpty
 	}
-	// onepass regexp is anchored
-	if prog.Inst[prog.Start].Op != syntax.InstEmptyWidth ||
-		syntax.EmptyOp(prog.Inst[prog.Start].Arg)&syntax.EmptyBeginText != syntax.EmptyBeginText {
-		return notOnePass
+	// onepass regexp is anchored, possibly inside capture groups
+	start := &prog.Inst[skipCaptures(prog, uint32(prog.Start))]
+	if start.Op != syntax.InstEmptyWidth ||
+		syntax.EmptyOp(start.Arg)&syntax.EmptyBeginText != syntax.EmptyBeginText {
+		return notOnePass, notOnePassBegin
 	}
-	// every instruction leading to InstMatch must be EmptyEndText
+	// every instruction leading to InstMatch must be EmptyEndText, apart
+	// from capture groups closing after it
 	for _, inst := range prog.Inst {
-		opOut := prog.Inst[inst.Out].Op
 		switch inst.Op {
-		default:
-			if opOut == syntax.InstMatch {
-				return notOnePass
-			}
+		case syntax.InstCapture, syntax.InstNop:
+			// skipped over by leadsToMatch
 		case syntax.InstAlt, syntax.InstAltMatch:
-			if opOut == syntax.InstMatch || prog.Inst[inst.Arg].Op == syntax.InstMatch {
-				return notOnePass
+			if leadsToMatch(prog, inst.Out) || leadsToMatch(prog, inst.Arg) {
+				return notOnePass, notOnePassEnd
 			}
 		case syntax.InstEmptyWidth:
-			if opOut == syntax.InstMatch {
-				if syntax.EmptyOp(inst.Arg)&syntax.EmptyEndText == syntax.EmptyEndText {
-					continue
-				}
-				return notOnePass
+			if leadsToMatch(prog, inst.Out) && syntax.EmptyOp(inst.Arg)&syntax.EmptyEndText != syntax.EmptyEndText {
+				return notOnePass, notOnePassEnd
+			}
+		default:
+			if leadsToMatch(prog, inst.Out) {
+				return notOnePass, notOnePassEnd
 			}
 		}
 	}
+	if len(prog.Inst) >= 1000 {
+		return notOnePass, notOnePassTooLong
+	}
 	// Creates a slightly optimized copy of the original Prog
 	// that cleans up some Prog idioms that block valid onepass programs
 	p = onePassCopy(prog)
@@ -574,8 +588,24 @@ func compileOnePass(prog *syntax.Prog) (p *onePassProg) {
 	// checkAmbiguity on InstAlts, build onepass Prog if possible
 	p = makeOnePass(p)
 
-	if p != notOnePass {
-		cleanupOnePass(p, prog)
+	if p == notOnePass {
+		return notOnePass, notOnePassAmbiguous
 	}
-	return p
+	cleanupOnePass(p, prog)
+	return p, ""
+}
+
+// skipCaptures follows capture and nop instructions from pc, and returns
+// the first instruction that is neither.
+func skipCaptures(prog *syntax.Prog, pc uint32) uint32 {
+	for prog.Inst[pc].Op == syntax.InstCapture || prog.Inst[pc].Op == syntax.InstNop {
+		pc = prog.Inst[pc].Out
+	}
+	return pc
+}
+
+// leadsToMatch reports whether pc reaches InstMatch through nothing but
+// capture and nop instructions.
+func leadsToMatch(prog *syntax.Prog, pc uint32) bool {
+	return prog.Inst[skipCaptures(prog, pc)].Op == syntax.InstMatch
 }
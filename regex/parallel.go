@@ -0,0 +1,267 @@
+package regex
+
+import (
+	"bytes"
+	"regexp/syntax"
+	"runtime"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// minChunkSize is the smallest chunk that FindAllSubmatchIndexParallel
+// chooses for itself, below which the cost of starting a search in each
+// chunk outweighs the benefit of searching them concurrently.
+const minChunkSize = 64 << 10
+
+// ParallelOptions controls how FindAllSubmatchIndexParallel splits its
+// input into chunks and searches them.
+type ParallelOptions struct {
+	// Workers is the number of goroutines that search chunks at once, or 0
+	// for runtime.GOMAXPROCS(0).
+	Workers int
+
+	// ChunkSize is the approximate length of each chunk, or 0 to split the
+	// input into four chunks per worker, but none shorter than 64KB.
+	ChunkSize int
+
+	// Separator, if nonzero, is an ASCII character such as '\n' just after
+	// which every chunk must begin. If no match of the expression can
+	// contain it then each chunk is searched on its own, without reading
+	// past its end. Other characters are only allowed after ByteMode.
+	Separator byte
+}
+
+// FindAllSubmatchIndexParallel is like FindAllSubmatchIndex but splits b
+// into chunks and searches them concurrently, which is useful for very large
+// inputs. It returns exactly the same matches as FindAllSubmatchIndex.
+//
+// The search of each chunk begins at its start and continues until it finds
+// a match that begins in a later chunk, so a match that straddles the
+// boundary between two chunks is found by the search of the first of them.
+// The searches of adjacent chunks agree as soon as one of them resumes from
+// the same position as the other, and where they do not, the search of the
+// later chunk is repeated from the end of the match that straddles the
+// boundary until they do. Each search reads beyond its chunk only as far as
+// a match that begins within it could extend, and not at all if
+// opts.Separator is set and the expression cannot match it.
+//
+// Searches limited by SetMaxSteps, and expressions that use the extended
+// syntax, are not split into chunks.
+func (re *Regexp) FindAllSubmatchIndexParallel(b []byte, n int, opts ParallelOptions) [][]int {
+	if n < 0 {
+		n = len(b) + 1
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.Separator >= utf8.RuneSelf && !re.latin1 {
+		panic("regexp: FindAllSubmatchIndexParallel: separator is not an ASCII character")
+	}
+	bounds := re.chunkBounds(b, workers, opts)
+	if workers == 1 || len(bounds) <= 2 || re.newBudget(nil) != nil {
+		return re.FindAllSubmatchIndex(b, n)
+	}
+
+	// If no match can contain the separator then no match can straddle a
+	// boundary, and every chunk ends just after a separator, so searching
+	// the text up to the end of a chunk gives the same matches within it as
+	// searching the whole text.
+	alone := opts.Separator != 0 && !re.canMatchRune(rune(opts.Separator))
+
+	// Search the chunks
+	chunks := make([]*chunkResult, len(bounds)-1)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(chunks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range next {
+				chunks[k] = re.searchChunk(b, bounds[k], bounds[k+1], alone)
+			}
+		}()
+	}
+	for k := range chunks {
+		next <- k
+	}
+	close(next)
+	wg.Wait()
+
+	matches := re.joinChunks(b, bounds, chunks, n)
+	if len(matches) == 0 {
+		return nil
+	}
+	return matches
+}
+
+// chunkBounds returns the positions at which the chunks of b begin, followed
+// by len(b)+1 so that a match at the end of b belongs to the last chunk.
+func (re *Regexp) chunkBounds(b []byte, workers int, opts ParallelOptions) []int {
+	size := opts.ChunkSize
+	if size <= 0 {
+		size = len(b) / (4 * workers)
+		if size < minChunkSize {
+			size = minChunkSize
+		}
+	}
+
+	bounds := []int{0}
+	for pos := size; pos < len(b); pos += size {
+		if opts.Separator != 0 {
+			i := bytes.IndexByte(b[pos-1:], opts.Separator)
+			if i < 0 {
+				break
+			}
+			pos += i
+		} else if !re.latin1 {
+			for pos < len(b) && !utf8.RuneStart(b[pos]) {
+				pos++
+			}
+		}
+		if pos >= len(b) {
+			break
+		}
+		bounds = append(bounds, pos)
+	}
+	return append(bounds, len(b)+1)
+}
+
+// canMatchRune reports whether some match of re could contain r.
+func (re *Regexp) canMatchRune(r rune) bool {
+	if re.ext != nil || re.fuzzy != nil {
+		return true
+	}
+	for i := range re.prog.Inst {
+		inst := &re.prog.Inst[i]
+		switch inst.Op {
+		case syntax.InstRune, syntax.InstRune1:
+			if inst.MatchRune(r) {
+				return true
+			}
+		case syntax.InstRuneAny:
+			return true
+		case syntax.InstRuneAnyNotNL:
+			if r != '\n' {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A chunkResult holds the successive searches made in one chunk, as made by
+// eachMatch, together with the state from which each began, so that they
+// can be joined up with the searches of the chunk before.
+type chunkResult struct {
+	steps   []chunkStep
+	pos     int  // position at which the search after the last step begins
+	prevEnd int  // end of the match found by the last step, or -1
+	done    bool // the search after the last step finds no match in the rest of the text
+}
+
+// A chunkStep is one of the searches made in a chunk.
+type chunkStep struct {
+	pos      int   // position at which the search began
+	adjacent bool  // whether the previous match ended at pos
+	match    []int // match that was found, or nil if it was not accepted
+}
+
+// searchChunk searches the chunk of b from lo to hi, recording every match
+// that begins within it. Each search stops as soon as no match can begin
+// before hi, and if alone is true then only the text up to hi is searched.
+func (re *Regexp) searchChunk(b []byte, lo, hi int, alone bool) *chunkResult {
+	text := b
+	if alone && hi < len(b) {
+		text = b[:hi]
+	}
+	r := &chunkResult{pos: lo, prevEnd: -1}
+	for r.pos <= len(text) {
+		matches, accept, next := re.nextMatch(nil, "", text, r.pos, hi, r.prevEnd, nil)
+		if matches == nil {
+			// The search of the last chunk is the only one not bounded
+			// by the start of another.
+			r.done = hi > len(b)
+			return r
+		}
+		step := chunkStep{pos: r.pos, adjacent: r.pos == r.prevEnd}
+		if accept {
+			step.match = re.pad(matches)
+		}
+		r.steps = append(r.steps, step)
+		r.pos, r.prevEnd = next, matches[1]
+	}
+	r.done = len(text) == len(b)
+	return r
+}
+
+// resume returns the index of the step in r that began in the given state,
+// len(r.steps) if the search after the last step begins in it, or -1 if no
+// search in r began in it.
+func (r *chunkResult) resume(pos int, adjacent bool) int {
+	i := sort.Search(len(r.steps), func(i int) bool { return r.steps[i].pos >= pos })
+	if i < len(r.steps) {
+		if r.steps[i].pos == pos && r.steps[i].adjacent == adjacent {
+			return i
+		}
+		return -1
+	}
+	if r.pos == pos && (r.prevEnd == pos) == adjacent {
+		return i
+	}
+	return -1
+}
+
+// joinChunks returns the first n matches that eachMatch would find in b,
+// given the searches made in each of the chunks beginning at bounds.
+func (re *Regexp) joinChunks(b []byte, bounds []int, chunks []*chunkResult, n int) [][]int {
+	var out [][]int
+	pos, prevEnd := 0, -1
+	for k := 0; len(out) < n && pos <= len(b); {
+		for pos >= bounds[k+1] {
+			k++
+		}
+
+		r := chunks[k]
+		if i := r.resume(pos, pos == prevEnd); i >= 0 {
+			// The search of this chunk began in the same state as ours
+			// would, so every search from then on is the same as ours.
+			for _, step := range r.steps[i:] {
+				if step.match != nil && len(out) < n {
+					out = append(out, step.match)
+				}
+			}
+			if r.done {
+				break
+			}
+			pos, prevEnd = r.pos, r.prevEnd
+		} else {
+			// Search from where the previous match ended until we reach a
+			// state in which the search of this chunk also began.
+			matches, accept, next := re.nextMatch(nil, "", b, pos, noLimit, prevEnd, nil)
+			if matches == nil {
+				break
+			}
+			if matches[0] < bounds[k+1] {
+				if accept {
+					out = append(out, re.pad(matches))
+				}
+				pos, prevEnd = next, matches[1]
+				continue
+			}
+		}
+
+		// The next match begins in a later chunk. Since no match begins
+		// between pos and the start of the next chunk, searching from the
+		// start of that chunk finds the same match, unless the previous
+		// match ended there.
+		if k+1 == len(chunks) {
+			break
+		}
+		if pos < bounds[k+1] {
+			pos = bounds[k+1]
+		}
+	}
+	return out
+}
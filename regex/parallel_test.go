@@ -0,0 +1,68 @@
+package regex
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindAllSubmatchIndexParallel(t *testing.T) {
+	patterns := append([]string{``, `\b`, `(?m)^`, `x*y?`, `.*`, `(?s).*`, `(?s)x.*?y`, `[^,]*`, `$`, `\w+\s\w+`, `(?m)^[^\n]*d$`}, engineTestPatterns...)
+	r := rand.New(rand.NewSource(1))
+	for _, pattern := range patterns {
+		for _, longest := range []bool{false, true} {
+			re := MustCompile(pattern)
+			if longest {
+				re.Longest()
+			}
+			for i := 0; i < 5; i++ {
+				in := []byte(randomText(r, 300))
+				expected := re.FindAllSubmatchIndex(in, -1)
+				for _, size := range []int{1, 2, 3, 7, 50} {
+					for _, sep := range []byte{0, '\n', 'x'} {
+						opts := ParallelOptions{Workers: 4, ChunkSize: size, Separator: sep}
+						actual := re.FindAllSubmatchIndexParallel(in, -1, opts)
+						if !assert.Equal(t, expected, actual, "%s on %q with %+v", pattern, in, opts) {
+							return
+						}
+						assert.Equal(t, re.FindAllSubmatchIndex(in, 3), re.FindAllSubmatchIndexParallel(in, 3, opts))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestFindAllSubmatchIndexParallel_Sparse(t *testing.T) {
+	patterns := []string{`[A-Z]{3}\d`, `ERROR: (\w+)`, `\bfoo\w*`, `x+y`, `(?i)needle`, `a[^z]*z`, `\d+$`}
+	strategies := []Strategy{AllStrategies, NFA, Backtrack, DFA | NFA}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 3; i++ {
+		var sb strings.Builder
+		for sb.Len() < 10000 {
+			sb.WriteString("lorem ipsum dolor sit amet ")
+			if r.Intn(50) == 0 {
+				sb.WriteString(randomText(r, 10) + "ABC1 ERROR: disk foobar xxy NeEdLe abcz 42")
+			}
+		}
+		in := []byte(sb.String())
+		for _, pattern := range patterns {
+			for _, s := range strategies {
+				re := MustCompile(pattern)
+				if re.SetStrategies(s) != nil {
+					continue
+				}
+				expected := re.FindAllSubmatchIndex(in, -1)
+				for _, size := range []int{7, 13, 100, 5000} {
+					opts := ParallelOptions{Workers: 4, ChunkSize: size}
+					actual := re.FindAllSubmatchIndexParallel(in, -1, opts)
+					if !assert.Equal(t, expected, actual, "%s with %v and %+v", pattern, s, opts) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
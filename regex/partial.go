@@ -0,0 +1,80 @@
+package regex
+
+// FindSubmatchIndexPartial is like FindSubmatchIndex but also reports
+// whether the search reached the end of b while some thread of the match
+// was still waiting for input, so that more input could change the result.
+// This is useful for validating text as it is typed.
+//
+// If there is a match then loc holds its index pairs, as for
+// FindSubmatchIndex, matched is true, and hitEnd reports whether appending
+// to b could change the match. If there is no match but appending to b could
+// produce one, then matched is false, hitEnd is true, and loc holds the
+// index pairs for the match in progress, in which the match itself and any
+// subexpression that had begun but not yet ended are taken to extend to the
+// end of b. Otherwise loc is nil and both flags are false.
+//
+// Unanchored expressions could always match text appended later, so hitEnd
+// is only meaningful for expressions anchored at the beginning with ^.
+// It panics if the expression uses extended syntax.
+func (re *Regexp) FindSubmatchIndexPartial(b []byte) (loc []int, matched, hitEnd bool) {
+	if b == nil {
+		b = []byte{}
+	}
+	return re.doExecutePartial(b, "")
+}
+
+// FindStringSubmatchIndexPartial is like FindSubmatchIndexPartial but for
+// strings.
+func (re *Regexp) FindStringSubmatchIndexPartial(s string) (loc []int, matched, hitEnd bool) {
+	return re.doExecutePartial(nil, s)
+}
+
+// doExecutePartial runs the NFA over b if b is non-nil, otherwise over s,
+// without skipping ahead in the input, and records the highest priority
+// thread still running at the end of the input.
+func (re *Regexp) doExecutePartial(b []byte, s string) ([]int, bool, bool) {
+	re.needAutomaton("partial matching")
+	m := re.get()
+	defer re.put(m)
+
+	i, size := m.newInputString(s), len(s)
+	if b != nil {
+		i, size = m.newInputBytes(b), len(b)
+	}
+	if m.matchPartial(i) {
+		return re.pad(append([]int(nil), m.matchcap...)), true, m.hitEnd
+	}
+	if !m.hitEnd {
+		return nil, false, false
+	}
+	loc := re.pad(append([]int(nil), m.partialcap...))
+	for j := 0; j < len(loc); j += 2 {
+		if loc[j] >= 0 && loc[j+1] < 0 {
+			loc[j+1] = size
+		}
+	}
+	return loc, false, true
+}
+
+// A waiting thread is one that was still running at the end of the input.
+type waiting struct {
+	pc    uint32 // instruction that was waiting for the next rune
+	start int    // position at which the thread's match began
+}
+
+// matchPartial runs the NFA over the whole input from the beginning,
+// recording the threads still running at the end. It reports whether there
+// was a match.
+func (m *machine) matchPartial(i input) bool {
+	ncap := m.re.prog.NumCap
+	m.init(ncap)
+	if cap(m.partialcap) < ncap {
+		m.partialcap = make([]int, ncap)
+	}
+	m.partialcap = m.partialcap[:ncap]
+	m.partial, m.hitEnd = true, false
+	m.waiting = m.waiting[:0]
+	matched := m.match(i, 0)
+	m.partial = false
+	return matched
+}
@@ -0,0 +1,40 @@
+package regex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindPartial(t *testing.T) {
+	loc, matched, hitEnd := MustCompile(`^\d+`).FindStringSubmatchIndexPartial("12")
+	assert.Equal(t, []int{0, 2}, loc)
+	assert.True(t, matched)
+	assert.True(t, hitEnd)
+
+	loc, matched, hitEnd = MustCompile(`^\d{2}`).FindStringSubmatchIndexPartial("12")
+	assert.Equal(t, []int{0, 2}, loc)
+	assert.True(t, matched)
+	assert.False(t, hitEnd)
+
+	loc, matched, hitEnd = MustCompile(`^(a)(b)(c)`).FindStringSubmatchIndexPartial("ab")
+	assert.Equal(t, []int{0, 2, 0, 1, 1, 2, 2, 2}, loc)
+	assert.False(t, matched)
+	assert.True(t, hitEnd)
+
+	loc, matched, hitEnd = MustCompile(`^(a)(b+)`).FindStringSubmatchIndexPartial("abb")
+	assert.Equal(t, []int{0, 3, 0, 1, 1, 3}, loc)
+	assert.True(t, matched)
+	assert.True(t, hitEnd)
+
+	loc, matched, hitEnd = MustCompile(`^abc`).FindStringSubmatchIndexPartial("abd")
+	assert.Nil(t, loc)
+	assert.False(t, matched)
+	assert.False(t, hitEnd)
+
+	// the literal prefix must not be used to skip over the partial match
+	loc, matched, hitEnd = MustCompile(`abc`).FindStringSubmatchIndexPartial("xxab")
+	assert.Equal(t, []int{2, 4}, loc)
+	assert.False(t, matched)
+	assert.True(t, hitEnd)
+}
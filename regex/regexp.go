@@ -13,14 +13,17 @@
 // More precisely, it is the syntax accepted by RE2 and described at
 // https://golang.org/s/re2syntax, except for \C.
 // For an overview of the syntax, run
-//   go doc regexp/syntax
+//
+//	go doc regexp/syntax
 //
 // The regexp implementation provided by this package is
 // guaranteed to run in time linear in the size of the input.
 // (This is a property not guaranteed by most open source
 // implementations of regular expressions.) For more information
 // about this property, see
+//
 //	http://swtch.com/~rsc/regexp/regexp1.html
+//
 // or any book about automata theory.
 //
 // All characters are UTF-8-encoded code points.
@@ -65,7 +68,6 @@
 // before returning.
 //
 // (There are a few other methods that do not match this pattern.)
-//
 package regex
 
 import (
@@ -88,6 +90,7 @@ type Regexp struct {
 	expr           string
 	prog           *syntax.Prog   // compiled program
 	onepass        *onePassProg   // onepass program or nil
+	notOnePass     string         // why the program is not onepass, or ""
 	prefix         string         // required prefix in unanchored matches
 	prefixBytes    []byte         // prefix, as a []byte
 	prefixComplete bool           // prefix is the entire regexp
@@ -97,10 +100,38 @@ type Regexp struct {
 	numSubexp      int
 	subexpNames    []string
 	longest        bool
-
-	// cache of machines for running regexp
-	mu      sync.Mutex
-	machine []*machine
+	syntax         *syntax.Regexp // simplified syntax tree; use simplified()
+	syntaxData     []byte         // syntax, encoded, if restored by UnmarshalBinary
+	syntaxOnce     sync.Once
+	required       []string       // one of these appears in every match
+	requiredBytes  []byte         // required[0], as a []byte
+	requiredSet    *literalSet    // automaton for required, if more than one
+	requiredBefore int            // max bytes before the required literal in a match
+	requiredMax    int            // length of the longest required literal
+	useDFA         bool           // use the lazy DFA to locate matches in long inputs
+	maxSteps       int            // limit on the steps taken by each call, or 0
+	ext            *syntax.Regexp // syntax tree for the backtracking engine, if extended syntax is used
+	fuzzy          *fuzzyProg     // edits allowed in approximate matches, or nil
+	latin1         bool           // each byte of the input is a rune, as set by ByteMode
+	empty          emptyMode      // how to evaluate empty-width assertions
+	strategies     Strategy       // strategies that searches may use
+	maxBacktrack   int            // size in bits of the backtracker's largest visited set
+
+	suffix      []string // every match ends with one of these
+	suffixBytes [][]byte // suffix, as []byte
+
+	// reversed program, compiled lazily for locating the start of matches
+	reverseOnce     sync.Once
+	reverse         *syntax.Prog
+	reverseAnchored bool // every match ends at the end of the text
+
+	// innermost subexpression containing each instruction, computed lazily
+	groupsOnce sync.Once
+	groups     []int
+
+	// cache of machines for running regexp, including the state for the
+	// backtracker and the lazy DFAs that each of them holds
+	machines sync.Pool
 }
 
 // String returns the source text used to compile the regular expression.
@@ -122,9 +153,25 @@ func Compile(expr string) (*Regexp, error) {
 	return compile(expr, syntax.Perl, false)
 }
 
-// CompileSyntax is like Compile but takes a syntax tree as input.
+// CompileSyntax is like Compile but takes a syntax tree as input. Like
+// Compile it uses leftmost-first semantics; call Longest on the result for
+// leftmost-longest semantics.
 func CompileSyntax(ast *syntax.Regexp) (*Regexp, error) {
-	return compileSyntax(ast, ast.String(), true)
+	return compileSyntax(ast, syntaxString(ast), false)
+}
+
+// CompileExtended is like Compile but also accepts the extended syntax
+// described at ParseExtended. Expressions that use it are matched by
+// backtracking, which can take time exponential in the length of the input,
+// so their searches are limited to DefaultExtendedMaxSteps steps unless
+// another limit is set with SetMaxSteps. Expressions that do not use it are
+// compiled exactly as by Compile.
+func CompileExtended(expr string) (*Regexp, error) {
+	re, err := ParseExtended(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	return compileSyntax(re, expr, false)
 }
 
 // CompilePOSIX is like Compile but restricts the regular expression
@@ -158,6 +205,17 @@ func (re *Regexp) Longest() {
 	re.longest = true
 }
 
+// SetMaxSteps limits the work done by each future search to roughly n steps,
+// where a step is one instruction executed by the backtracker, one thread
+// advanced by the NFA, or one rune scanned by the DFA. A search that runs
+// out of steps stops and reports no match, or returns ErrBudgetExceeded if
+// it was started by one of the Context methods. For the 'All' routines the
+// limit applies to the whole call. If n is zero there is no limit. It should
+// be called before the Regexp is used.
+func (re *Regexp) SetMaxSteps(n int) {
+	re.maxSteps = n
+}
+
 func compile(expr string, mode syntax.Flags, longest bool) (*Regexp, error) {
 	re, err := syntax.Parse(expr, mode)
 	if err != nil {
@@ -169,6 +227,9 @@ func compile(expr string, mode syntax.Flags, longest bool) (*Regexp, error) {
 func compileSyntax(re *syntax.Regexp, expr string, longest bool) (*Regexp, error) {
 	maxCap := re.MaxCap()
 	capNames := re.CapNames()
+	if hasExtended(re) {
+		return compileExtended(re, expr, longest, maxCap, capNames)
+	}
 
 	re = re.Simplify()
 	prog, err := syntax.Compile(re)
@@ -176,14 +237,18 @@ func compileSyntax(re *syntax.Regexp, expr string, longest bool) (*Regexp, error
 		return nil, err
 	}
 	regexp := &Regexp{
-		expr:        expr,
-		prog:        prog,
-		onepass:     compileOnePass(prog),
-		numSubexp:   maxCap,
-		subexpNames: capNames,
-		cond:        prog.StartCond(),
-		longest:     longest,
+		expr:         expr,
+		prog:         prog,
+		numSubexp:    maxCap,
+		subexpNames:  capNames,
+		cond:         prog.StartCond(),
+		longest:      longest,
+		syntax:       re,
+		useDFA:       true,
+		strategies:   AllStrategies,
+		maxBacktrack: maxBacktrackVector,
 	}
+	regexp.onepass, regexp.notOnePass = compileOnePass(prog)
 	if regexp.onepass == notOnePass {
 		regexp.prefix, regexp.prefixComplete = prog.Prefix()
 	} else {
@@ -195,34 +260,78 @@ func compileSyntax(re *syntax.Regexp, expr string, longest bool) (*Regexp, error
 		regexp.prefixBytes = []byte(regexp.prefix)
 		regexp.prefixRune, _ = utf8.DecodeRuneInString(regexp.prefix)
 	}
+	regexp.required, regexp.requiredBefore = requiredLiterals(re)
+	if len(regexp.required) == 1 {
+		regexp.requiredBytes = []byte(regexp.required[0])
+	} else if len(regexp.required) > 1 {
+		regexp.requiredSet = newLiteralSet(regexp.required)
+	}
+	for _, lit := range regexp.required {
+		if len(lit) > regexp.requiredMax {
+			regexp.requiredMax = len(lit)
+		}
+	}
+	regexp.suffix = suffixLiterals(re)
+	for _, lit := range regexp.suffix {
+		regexp.suffixBytes = append(regexp.suffixBytes, []byte(lit))
+	}
 	return regexp, nil
 }
 
+// compileExtended compiles an expression that uses extended syntax. The
+// program is compiled from a relaxed copy of the expression and is used only
+// for the shape of its captures; matching is done by the backtracking engine
+// over the syntax tree itself.
+func compileExtended(re *syntax.Regexp, expr string, longest bool, maxCap int, capNames []string) (*Regexp, error) {
+	if err := resolveBackrefs(re, capNames, maxCap); err != nil {
+		return nil, err
+	}
+	prog, err := syntax.Compile(relaxExtended(re).Simplify())
+	if err != nil {
+		return nil, err
+	}
+	// Captures inside lookaround assertions are not in the relaxed program.
+	prog.NumCap = 2 * (maxCap + 1)
+	return &Regexp{
+		expr:        expr,
+		prog:        prog,
+		onepass:     notOnePass,
+		notOnePass:  notOnePassExtended,
+		numSubexp:   maxCap,
+		subexpNames: capNames,
+		longest:     longest,
+		syntax:      re,
+		ext:         re.Simplify(),
+	}, nil
+}
+
 // get returns a machine to use for matching re.
 // It uses the re's machine cache if possible, to avoid
 // unnecessary allocation.
 func (re *Regexp) get() *machine {
-	re.mu.Lock()
-	if n := len(re.machine); n > 0 {
-		z := re.machine[n-1]
-		re.machine = re.machine[:n-1]
-		re.mu.Unlock()
+	if z, ok := re.machines.Get().(*machine); ok {
 		return z
 	}
-	re.mu.Unlock()
 	z := progMachine(re.prog, re.onepass)
 	z.re = re
+	z.limit = noLimit
+	z.maxBitStateLen = re.maxBitStateLen()
 	return z
 }
 
-// put returns a machine to the re's machine cache.
-// There is no attempt to limit the size of the cache, so it will
-// grow to the maximum number of simultaneous matches
-// run using re.  (The cache empties when re gets garbage collected.)
+// put returns a machine to the re's machine cache. The cache is a
+// sync.Pool, so that matches running in parallel do not contend for a lock,
+// and machines that have not been used since the last garbage collection or
+// two are released. The references to the input are cleared so that it can
+// be collected too.
 func (re *Regexp) put(z *machine) {
-	re.mu.Lock()
-	re.machine = append(re.machine, z)
-	re.mu.Unlock()
+	z.budget = nil
+	z.limit = noLimit
+	z.fuzzy = nil
+	z.inputBytes.str = nil
+	z.inputString.str = ""
+	z.inputReader.r = nil
+	re.machines.Put(z)
 }
 
 // MustCompile is like Compile but panics if the expression cannot be parsed.
@@ -247,6 +356,16 @@ func MustCompilePOSIX(str string) *Regexp {
 	return regexp
 }
 
+// MustCompileExtended is like CompileExtended but panics if the expression
+// cannot be parsed.
+func MustCompileExtended(str string) *Regexp {
+	regexp, error := CompileExtended(str)
+	if error != nil {
+		panic(`regexp: CompileExtended(` + quote(str) + `): ` + error.Error())
+	}
+	return regexp
+}
+
 func quote(s string) string {
 	if strconv.CanBackquote(s) {
 		return "`" + s + "`"
@@ -273,8 +392,10 @@ const endOfText rune = -1
 // input abstracts different representations of the input text. It provides
 // one-character lookahead.
 type input interface {
-	step(pos int) (r rune, width int) // advance one rune
-	canCheckPrefix() bool             // can we look ahead without losing info?
+	step(pos int) (r rune, width int)     // advance one rune
+	stepBack(pos int) (r rune, width int) // the rune before pos
+	lastIndex(re *Regexp, pos int) int    // end of the last literal suffix before pos
+	canCheckPrefix() bool                 // can we look ahead without losing info?
 	hasPrefix(re *Regexp) bool
 	index(re *Regexp, pos int) int
 	context(pos int) syntax.EmptyOp
@@ -282,13 +403,15 @@ type input interface {
 
 // inputString scans a string.
 type inputString struct {
-	str string
+	str    string
+	latin1 bool      // each byte is a rune, as set by ByteMode
+	empty  emptyMode // how to evaluate empty-width assertions
 }
 
 func (i *inputString) step(pos int) (rune, int) {
 	if pos < len(i.str) {
 		c := i.str[pos]
-		if c < utf8.RuneSelf {
+		if c < utf8.RuneSelf || i.latin1 {
 			return rune(c), 1
 		}
 		return utf8.DecodeRuneInString(i.str[pos:])
@@ -296,6 +419,27 @@ func (i *inputString) step(pos int) (rune, int) {
 	return endOfText, 0
 }
 
+func (i *inputString) stepBack(pos int) (rune, int) {
+	if pos > 0 && pos <= len(i.str) {
+		c := i.str[pos-1]
+		if c < utf8.RuneSelf || i.latin1 {
+			return rune(c), 1
+		}
+		return utf8.DecodeLastRuneInString(i.str[:pos])
+	}
+	return endOfText, 0
+}
+
+func (i *inputString) lastIndex(re *Regexp, pos int) int {
+	end := -1
+	for _, lit := range re.suffix {
+		if j := strings.LastIndex(i.str[:pos], lit); j >= 0 && j+len(lit) > end {
+			end = j + len(lit)
+		}
+	}
+	return end
+}
+
 func (i *inputString) canCheckPrefix() bool {
 	return true
 }
@@ -309,25 +453,22 @@ func (i *inputString) index(re *Regexp, pos int) int {
 }
 
 func (i *inputString) context(pos int) syntax.EmptyOp {
-	r1, r2 := endOfText, endOfText
-	if pos > 0 && pos <= len(i.str) {
-		r1, _ = utf8.DecodeLastRuneInString(i.str[:pos])
-	}
-	if pos < len(i.str) {
-		r2, _ = utf8.DecodeRuneInString(i.str[pos:])
-	}
-	return syntax.EmptyOpContext(r1, r2)
+	r1, _ := i.stepBack(pos)
+	r2, _ := i.step(pos)
+	return i.empty.context(r1, r2)
 }
 
 // inputBytes scans a byte slice.
 type inputBytes struct {
-	str []byte
+	str    []byte
+	latin1 bool      // each byte is a rune, as set by ByteMode
+	empty  emptyMode // how to evaluate empty-width assertions
 }
 
 func (i *inputBytes) step(pos int) (rune, int) {
 	if pos < len(i.str) {
 		c := i.str[pos]
-		if c < utf8.RuneSelf {
+		if c < utf8.RuneSelf || i.latin1 {
 			return rune(c), 1
 		}
 		return utf8.DecodeRune(i.str[pos:])
@@ -335,6 +476,27 @@ func (i *inputBytes) step(pos int) (rune, int) {
 	return endOfText, 0
 }
 
+func (i *inputBytes) stepBack(pos int) (rune, int) {
+	if pos > 0 && pos <= len(i.str) {
+		c := i.str[pos-1]
+		if c < utf8.RuneSelf || i.latin1 {
+			return rune(c), 1
+		}
+		return utf8.DecodeLastRune(i.str[:pos])
+	}
+	return endOfText, 0
+}
+
+func (i *inputBytes) lastIndex(re *Regexp, pos int) int {
+	end := -1
+	for _, lit := range re.suffixBytes {
+		if j := bytes.LastIndex(i.str[:pos], lit); j >= 0 && j+len(lit) > end {
+			end = j + len(lit)
+		}
+	}
+	return end
+}
+
 func (i *inputBytes) canCheckPrefix() bool {
 	return true
 }
@@ -348,14 +510,9 @@ func (i *inputBytes) index(re *Regexp, pos int) int {
 }
 
 func (i *inputBytes) context(pos int) syntax.EmptyOp {
-	r1, r2 := endOfText, endOfText
-	if pos > 0 && pos <= len(i.str) {
-		r1, _ = utf8.DecodeLastRune(i.str[:pos])
-	}
-	if pos < len(i.str) {
-		r2, _ = utf8.DecodeRune(i.str[pos:])
-	}
-	return syntax.EmptyOpContext(r1, r2)
+	r1, _ := i.stepBack(pos)
+	r2, _ := i.step(pos)
+	return i.empty.context(r1, r2)
 }
 
 // inputReader scans a RuneReader.
@@ -379,6 +536,14 @@ func (i *inputReader) step(pos int) (rune, int) {
 	return r, w
 }
 
+func (i *inputReader) stepBack(pos int) (rune, int) {
+	return endOfText, 0
+}
+
+func (i *inputReader) lastIndex(re *Regexp, pos int) int {
+	return -1
+}
+
 func (i *inputReader) canCheckPrefix() bool {
 	return false
 }
@@ -405,17 +570,17 @@ func (re *Regexp) LiteralPrefix() (prefix string, complete bool) {
 // MatchReader reports whether the Regexp matches the text read by the
 // RuneReader.
 func (re *Regexp) MatchReader(r io.RuneReader) bool {
-	return re.doExecute(r, nil, "", 0, 0) != nil
+	return re.doExecute(r, nil, "", 0, 0, nil) != nil
 }
 
 // MatchString reports whether the Regexp matches the string s.
 func (re *Regexp) MatchString(s string) bool {
-	return re.doExecute(nil, nil, s, 0, 0) != nil
+	return re.doExecute(nil, nil, s, 0, 0, nil) != nil
 }
 
 // Match reports whether the Regexp matches the byte slice b.
 func (re *Regexp) Match(b []byte) bool {
-	return re.doExecute(nil, b, "", 0, 0) != nil
+	return re.doExecute(nil, b, "", 0, 0, nil) != nil
 }
 
 // MatchReader checks whether a textual regular expression matches the text
@@ -496,7 +661,7 @@ func (re *Regexp) replaceAll(bsrc []byte, src string, nmatch int, repl func(dst
 		endPos = len(src)
 	}
 	for searchPos <= endPos {
-		a := re.doExecute(nil, bsrc, src, searchPos, nmatch)
+		a := re.doExecute(nil, bsrc, src, searchPos, nmatch, nil)
 		if len(a) == 0 {
 			break // no more matches
 		}
@@ -518,12 +683,7 @@ func (re *Regexp) replaceAll(bsrc []byte, src string, nmatch int, repl func(dst
 		lastMatchEnd = a[1]
 
 		// Advance past this match; always advance at least one character.
-		var width int
-		if bsrc != nil {
-			_, width = utf8.DecodeRune(bsrc[searchPos:])
-		} else {
-			_, width = utf8.DecodeRuneInString(src[searchPos:])
-		}
+		width := re.runeWidth(bsrc, src, searchPos)
 		if searchPos+width > a[1] {
 			searchPos += width
 		} else if searchPos+1 > a[1] {
@@ -626,6 +786,48 @@ func (re *Regexp) pad(a []int) []int {
 
 // Find matches in slice b if b is non-nil, otherwise find matches in string s.
 func (re *Regexp) allMatches(s string, b []byte, n int, deliver func([]int)) {
+	re.eachMatch(re.newBudget(nil), s, b, n, false, func(match []int) bool {
+		deliver(match)
+		return true
+	})
+}
+
+// nextMatch runs one of the searches made by eachMatch, beginning at pos in
+// b if b is non-nil and otherwise in s, where prevMatchEnd is the end of the
+// match found by the previous search or -1. It returns the match, or nil if
+// there is none that begins before limit, whether to accept it, and the
+// position at which the next search should begin.
+func (re *Regexp) nextMatch(bg *budget, s string, b []byte, pos, limit, prevMatchEnd int, buf []int) (matches []int, accept bool, next int) {
+	matches = re.executeAt(bg, nil, b, s, pos, limit, re.prog.NumCap, buf)
+	if len(matches) == 0 {
+		return nil, false, pos
+	}
+
+	accept = true
+	if matches[1] == pos {
+		// We've found an empty match.
+		if matches[0] == prevMatchEnd {
+			// We don't allow an empty match right
+			// after a previous match, so ignore it.
+			accept = false
+		}
+		width := re.runeWidth(b, s, pos)
+		if width > 0 {
+			next = pos + width
+		} else {
+			next = pos + 1
+		}
+	} else {
+		next = matches[1]
+	}
+	return matches, accept, next
+}
+
+// eachMatch is like allMatches but stops as soon as deliver returns false.
+// If reuse is true then the slice passed to deliver is overwritten by the
+// next match, so that only one index slice is allocated for the whole search.
+// All of the searches spend steps from bg, which may be nil.
+func (re *Regexp) eachMatch(bg *budget, s string, b []byte, n int, reuse bool, deliver func([]int) bool) {
 	var end int
 	if b == nil {
 		end = len(s)
@@ -633,39 +835,22 @@ func (re *Regexp) allMatches(s string, b []byte, n int, deliver func([]int)) {
 		end = len(b)
 	}
 
+	var buf []int
 	for pos, i, prevMatchEnd := 0, 0, -1; i < n && pos <= end; {
-		matches := re.doExecute(nil, b, s, pos, re.prog.NumCap)
-		if len(matches) == 0 {
+		matches, accept, next := re.nextMatch(bg, s, b, pos, noLimit, prevMatchEnd, buf)
+		if matches == nil {
 			break
 		}
+		pos, prevMatchEnd = next, matches[1]
 
-		accept := true
-		if matches[1] == pos {
-			// We've found an empty match.
-			if matches[0] == prevMatchEnd {
-				// We don't allow an empty match right
-				// after a previous match, so ignore it.
-				accept = false
-			}
-			var width int
-			// TODO: use step()
-			if b == nil {
-				_, width = utf8.DecodeRuneInString(s[pos:end])
-			} else {
-				_, width = utf8.DecodeRune(b[pos:end])
+		if accept {
+			matches = re.pad(matches)
+			if reuse {
+				buf = matches[:0]
 			}
-			if width > 0 {
-				pos += width
-			} else {
-				pos = end + 1
+			if !deliver(matches) {
+				break
 			}
-		} else {
-			pos = matches[1]
-		}
-		prevMatchEnd = matches[1]
-
-		if accept {
-			deliver(re.pad(matches))
 			i++
 		}
 	}
@@ -674,7 +859,7 @@ func (re *Regexp) allMatches(s string, b []byte, n int, deliver func([]int)) {
 // Find returns a slice holding the text of the leftmost match in b of the regular expression.
 // A return value of nil indicates no match.
 func (re *Regexp) Find(b []byte) []byte {
-	a := re.doExecute(nil, b, "", 0, 2)
+	a := re.doExecute(nil, b, "", 0, 2, nil)
 	if a == nil {
 		return nil
 	}
@@ -686,7 +871,7 @@ func (re *Regexp) Find(b []byte) []byte {
 // b[loc[0]:loc[1]].
 // A return value of nil indicates no match.
 func (re *Regexp) FindIndex(b []byte) (loc []int) {
-	a := re.doExecute(nil, b, "", 0, 2)
+	a := re.doExecute(nil, b, "", 0, 2, nil)
 	if a == nil {
 		return nil
 	}
@@ -699,7 +884,7 @@ func (re *Regexp) FindIndex(b []byte) (loc []int) {
 // an empty string.  Use FindStringIndex or FindStringSubmatch if it is
 // necessary to distinguish these cases.
 func (re *Regexp) FindString(s string) string {
-	a := re.doExecute(nil, nil, s, 0, 2)
+	a := re.doExecute(nil, nil, s, 0, 2, nil)
 	if a == nil {
 		return ""
 	}
@@ -711,7 +896,7 @@ func (re *Regexp) FindString(s string) string {
 // itself is at s[loc[0]:loc[1]].
 // A return value of nil indicates no match.
 func (re *Regexp) FindStringIndex(s string) (loc []int) {
-	a := re.doExecute(nil, nil, s, 0, 2)
+	a := re.doExecute(nil, nil, s, 0, 2, nil)
 	if a == nil {
 		return nil
 	}
@@ -724,7 +909,7 @@ func (re *Regexp) FindStringIndex(s string) (loc []int) {
 // byte offset loc[0] through loc[1]-1.
 // A return value of nil indicates no match.
 func (re *Regexp) FindReaderIndex(r io.RuneReader) (loc []int) {
-	a := re.doExecute(r, nil, "", 0, 2)
+	a := re.doExecute(r, nil, "", 0, 2, nil)
 	if a == nil {
 		return nil
 	}
@@ -737,7 +922,7 @@ func (re *Regexp) FindReaderIndex(r io.RuneReader) (loc []int) {
 // comment.
 // A return value of nil indicates no match.
 func (re *Regexp) FindSubmatch(b []byte) [][]byte {
-	a := re.doExecute(nil, b, "", 0, re.prog.NumCap)
+	a := re.doExecute(nil, b, "", 0, re.prog.NumCap, nil)
 	if a == nil {
 		return nil
 	}
@@ -801,7 +986,7 @@ func (re *Regexp) expand(dst []byte, template string, bsrc []byte, src string, m
 		}
 		template = rest
 		if num >= 0 {
-			if 2*num+1 < len(match) && match[2*num] >= 0 {
+			if num <= re.numSubexp && 2*num+1 < len(match) && match[2*num] >= 0 {
 				if bsrc != nil {
 					dst = append(dst, bsrc[match[2*num]:match[2*num+1]]...)
 				} else {
@@ -884,7 +1069,27 @@ func extract(str string) (name string, num int, rest string, ok bool) {
 // in the package comment.
 // A return value of nil indicates no match.
 func (re *Regexp) FindSubmatchIndex(b []byte) []int {
-	return re.pad(re.doExecute(nil, b, "", 0, re.prog.NumCap))
+	return re.pad(re.doExecute(nil, b, "", 0, re.prog.NumCap, nil))
+}
+
+// AppendSubmatchIndex is like FindSubmatchIndex but appends the index pairs
+// to dst and returns the result, so that callers can reuse the same slice
+// across many matches. If there was no match then dst is returned unchanged,
+// so a result no longer than dst indicates no match.
+func (re *Regexp) AppendSubmatchIndex(dst []int, b []byte) []int {
+	n := len(dst)
+	buf := dst
+	if buf == nil {
+		buf = make([]int, 0, 2*(1+re.numSubexp))
+	}
+	a := re.doExecute(nil, b, "", 0, re.prog.NumCap, buf)
+	if a == nil {
+		return dst
+	}
+	for len(a)-n < (1+re.numSubexp)*2 {
+		a = append(a, -1)
+	}
+	return a
 }
 
 // FindStringSubmatch returns a slice of strings holding the text of the
@@ -893,7 +1098,7 @@ func (re *Regexp) FindSubmatchIndex(b []byte) []int {
 // package comment.
 // A return value of nil indicates no match.
 func (re *Regexp) FindStringSubmatch(s string) []string {
-	a := re.doExecute(nil, nil, s, 0, re.prog.NumCap)
+	a := re.doExecute(nil, nil, s, 0, re.prog.NumCap, nil)
 	if a == nil {
 		return nil
 	}
@@ -912,7 +1117,7 @@ func (re *Regexp) FindStringSubmatch(s string) []string {
 // 'Index' descriptions in the package comment.
 // A return value of nil indicates no match.
 func (re *Regexp) FindStringSubmatchIndex(s string) []int {
-	return re.pad(re.doExecute(nil, nil, s, 0, re.prog.NumCap))
+	return re.pad(re.doExecute(nil, nil, s, 0, re.prog.NumCap, nil))
 }
 
 // FindReaderSubmatchIndex returns a slice holding the index pairs
@@ -921,7 +1126,28 @@ func (re *Regexp) FindStringSubmatchIndex(s string) []int {
 // by the 'Submatch' and 'Index' descriptions in the package comment.  A
 // return value of nil indicates no match.
 func (re *Regexp) FindReaderSubmatchIndex(r io.RuneReader) []int {
-	return re.pad(re.doExecute(r, nil, "", 0, re.prog.NumCap))
+	return re.pad(re.doExecute(r, nil, "", 0, re.prog.NumCap, nil))
+}
+
+// FindSubmatchIndexAt is like FindSubmatchIndex but finds the leftmost match
+// that begins at or after pos. The text before pos is still examined by
+// assertions such as ^ and \b, so a match at pos is found only if it would
+// also be found at pos by searching all of b, and the indices returned are
+// relative to the beginning of b.
+func (re *Regexp) FindSubmatchIndexAt(b []byte, pos int) []int {
+	if pos < 0 || pos > len(b) {
+		return nil
+	}
+	return re.pad(re.doExecute(nil, b, "", pos, re.prog.NumCap, nil))
+}
+
+// FindPrefixSubmatchIndexAt is like FindSubmatchIndexAt but only finds a
+// match that begins exactly at pos, without searching the rest of b for one.
+func (re *Regexp) FindPrefixSubmatchIndexAt(b []byte, pos int) []int {
+	if pos < 0 || pos > len(b) {
+		return nil
+	}
+	return re.pad(re.executeAt(re.newBudget(nil), nil, b, "", pos, pos+1, re.prog.NumCap, nil))
 }
 
 const startSize = 10 // The size at which to start a slice in the 'All' routines.
@@ -1008,7 +1234,7 @@ func (re *Regexp) FindAllSubmatch(b []byte, n int) [][][]byte {
 	}
 	result := make([][][]byte, 0, startSize)
 	re.allMatches("", b, n, func(match []int) {
-		slice := make([][]byte, len(match)/2)
+		slice := make([][]byte, 1+re.numSubexp)
 		for j := range slice {
 			if match[2*j] >= 0 {
 				slice[j] = b[match[2*j]:match[2*j+1]]
@@ -1040,6 +1266,17 @@ func (re *Regexp) FindAllSubmatchIndex(b []byte, n int) [][]int {
 	return result
 }
 
+// EachSubmatchIndex calls deliver with the index pairs for each successive
+// match of the expression in b, as defined by the 'All' description in the
+// package comment. It stops early if deliver returns false. The slice passed
+// to deliver is reused for the next match, so it must not be retained.
+func (re *Regexp) EachSubmatchIndex(b []byte, n int, deliver func([]int) bool) {
+	if n < 0 {
+		n = len(b) + 1
+	}
+	re.eachMatch(re.newBudget(nil), "", b, n, true, deliver)
+}
+
 // FindAllStringSubmatch is the 'All' version of FindStringSubmatch; it
 // returns a slice of all successive matches of the expression, as defined by
 // the 'All' description in the package comment.
@@ -1050,7 +1287,7 @@ func (re *Regexp) FindAllStringSubmatch(s string, n int) [][]string {
 	}
 	result := make([][]string, 0, startSize)
 	re.allMatches(s, nil, n, func(match []int) {
-		slice := make([]string, len(match)/2)
+		slice := make([]string, 1+re.numSubexp)
 		for j := range slice {
 			if match[2*j] >= 0 {
 				slice[j] = s[match[2*j]:match[2*j+1]]
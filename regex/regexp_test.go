@@ -0,0 +1,136 @@
+package regex
+
+import (
+	"math/rand"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendSubmatchIndex(t *testing.T) {
+	re := MustCompile(`(\w+)@(\w+)?`)
+	dst := []int{7, 8}
+
+	got := re.AppendSubmatchIndex(dst, []byte("mail joe@ now"))
+	assert.Equal(t, []int{7, 8, 5, 9, 5, 8, -1, -1}, got)
+
+	// no match leaves dst as it was
+	got = re.AppendSubmatchIndex(dst, []byte("no address"))
+	assert.Equal(t, []int{7, 8}, got)
+	assert.Nil(t, re.AppendSubmatchIndex(nil, []byte("no address")))
+}
+
+func TestCompileSyntaxLeftmostFirst(t *testing.T) {
+	ast, err := syntax.Parse(`a|ab`, syntax.Perl)
+	require.NoError(t, err)
+	re, err := CompileSyntax(ast)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, re.FindStringIndex("ab"))
+	re.Longest()
+	assert.Equal(t, []int{0, 2}, re.FindStringIndex("ab"))
+}
+
+func TestFindSubmatchIndexAt(t *testing.T) {
+	// Without assertions the text before pos makes no difference, so the
+	// results can be checked against the standard library on b[pos:]
+	patterns := []string{
+		`(a|ab)(c|bcd)(d*)`,
+		`[a-c]*d?`,
+		`x(y|z)*(?:@|\.)?`,
+		`(?i)(ab)+é?`,
+	}
+	strategies := []Strategy{
+		AllStrategies,
+		Backtrack,
+		NFA,
+		DFA | NFA,
+	}
+	alphabet := []string{"a", "b", "c", "d", "x", "y", "z", "@", ".", "é", " "}
+	r := rand.New(rand.NewSource(1))
+	var inputs []string
+	for i := 0; i < 300; i++ {
+		var sb strings.Builder
+		for n := r.Intn(10); n > 0; n-- {
+			sb.WriteString(alphabet[r.Intn(len(alphabet))])
+		}
+		inputs = append(inputs, sb.String())
+	}
+
+	shift := func(loc []int, pos int) []int {
+		for i := range loc {
+			if loc[i] >= 0 {
+				loc[i] += pos
+			}
+		}
+		return loc
+	}
+	for _, pattern := range patterns {
+		unanchored := regexp.MustCompile(pattern)
+		anchored := regexp.MustCompile(`^(?:` + pattern + `)`)
+		for _, s := range strategies {
+			ours := MustCompile(pattern)
+			require.NoError(t, ours.SetStrategies(s))
+			for _, in := range inputs {
+				for pos := 0; pos <= len(in); pos++ {
+					b := []byte(in)
+					assert.Equal(t, shift(unanchored.FindSubmatchIndex(b[pos:]), pos), ours.FindSubmatchIndexAt(b, pos),
+						"%s with %v on %q at %d", pattern, s, in, pos)
+					assert.Equal(t, shift(anchored.FindSubmatchIndex(b[pos:]), pos), ours.FindPrefixSubmatchIndexAt(b, pos),
+						"prefix %s with %v on %q at %d", pattern, s, in, pos)
+				}
+			}
+		}
+	}
+}
+
+func TestFindSubmatchIndexAt_Context(t *testing.T) {
+	b := []byte("foobar bar")
+	re := MustCompile(`\bbar`)
+	assert.Equal(t, []int{7, 10}, re.FindSubmatchIndexAt(b, 3))
+	assert.Nil(t, re.FindPrefixSubmatchIndexAt(b, 3))
+	assert.Equal(t, []int{7, 10}, re.FindPrefixSubmatchIndexAt(b, 7))
+
+	re = MustCompile(`^foo`)
+	assert.Nil(t, re.FindSubmatchIndexAt([]byte("foofoo"), 3))
+	assert.Nil(t, re.FindPrefixSubmatchIndexAt([]byte("foofoo"), 3))
+
+	re = MustCompile(`(?m)^(\w+)`)
+	assert.Equal(t, []int{4, 7, 4, 7}, re.FindPrefixSubmatchIndexAt([]byte("ab\n\nxyz"), 4))
+	assert.Nil(t, re.FindPrefixSubmatchIndexAt([]byte("ab\n\nxyz"), 5))
+	assert.Nil(t, re.FindSubmatchIndexAt([]byte("ab"), 3))
+
+	re = MustCompileExtended(`(?P<x>x)\k<x>`)
+	assert.Equal(t, []int{3, 5, 3, 4}, re.FindSubmatchIndexAt([]byte("xx xxx"), 1))
+	assert.Nil(t, re.FindPrefixSubmatchIndexAt([]byte("xx xxx"), 1))
+	assert.Equal(t, []int{4, 6, 4, 5}, re.FindPrefixSubmatchIndexAt([]byte("xx xxx"), 4))
+
+	re = MustCompile(`abc`)
+	re.SetMaxEdits(1)
+	assert.Equal(t, []int{4, 7, 1}, re.FindSubmatchIndexAt([]byte("abc xbc"), 3))
+	assert.Nil(t, re.FindPrefixSubmatchIndexAt([]byte("abc xbc"), 3))
+	assert.Equal(t, []int{4, 7, 1}, re.FindPrefixSubmatchIndexAt([]byte("abc xbc"), 4))
+}
+
+func TestFindSubmatchIndexAt_WithinRune(t *testing.T) {
+	// A position within a rune is searched from as given, so no match may
+	// begin before it whichever engines are used
+	b := []byte("aééb")
+	pattern := `(b(abx|ab)|(?:[ab])+?((\b)*|[^a]{1,3}))`
+	nfa := MustCompile(pattern)
+	require.NoError(t, nfa.SetStrategies(NFA))
+	for _, s := range []Strategy{AllStrategies, Backtrack, DFA | NFA} {
+		re := MustCompile(pattern)
+		require.NoError(t, re.SetStrategies(s))
+		for pos := 0; pos <= len(b); pos++ {
+			loc := re.FindSubmatchIndexAt(b, pos)
+			assert.Equal(t, nfa.FindSubmatchIndexAt(b, pos), loc, "%v at %d", s, pos)
+			if loc != nil {
+				assert.True(t, loc[0] >= pos, "%v at %d", s, pos)
+			}
+		}
+	}
+}
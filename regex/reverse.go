@@ -0,0 +1,170 @@
+package regex
+
+import "regexp/syntax"
+
+// reverseSyntax returns a copy of the syntax tree re that matches the
+// reverse of each string matched by re. Captures are removed, since the
+// reversed program is only used to locate match boundaries.
+func reverseSyntax(re *syntax.Regexp) *syntax.Regexp {
+	if re.Op == syntax.OpCapture {
+		return reverseSyntax(re.Sub[0])
+	}
+
+	rev := *re
+	rev.Sub = nil
+	rev.Sub0 = [1]*syntax.Regexp{}
+	for _, sub := range re.Sub {
+		rev.Sub = append(rev.Sub, reverseSyntax(sub))
+	}
+
+	switch re.Op {
+	case syntax.OpLiteral:
+		rev.Rune = make([]rune, len(re.Rune))
+		for i, r := range re.Rune {
+			rev.Rune[len(re.Rune)-1-i] = r
+		}
+	case syntax.OpConcat:
+		for i, j := 0, len(rev.Sub)-1; i < j; i, j = i+1, j-1 {
+			rev.Sub[i], rev.Sub[j] = rev.Sub[j], rev.Sub[i]
+		}
+	case syntax.OpBeginLine:
+		rev.Op = syntax.OpEndLine
+	case syntax.OpEndLine:
+		rev.Op = syntax.OpBeginLine
+	case syntax.OpBeginText:
+		rev.Op = syntax.OpEndText
+	case syntax.OpEndText:
+		rev.Op = syntax.OpBeginText
+	}
+	return &rev
+}
+
+// reverseProg returns the compiled program for the reverse of re,
+// compiling it on first use.
+func (re *Regexp) reverseProg() *syntax.Prog {
+	re.reverseOnce.Do(func() {
+		prog, err := syntax.Compile(reverseSyntax(re.simplified()))
+		if err != nil {
+			// The forward program compiled, so this cannot happen.
+			panic(err)
+		}
+		re.reverse = prog
+		re.reverseAnchored = prog.StartCond()&syntax.EmptyBeginText != 0
+	})
+	return re.reverse
+}
+
+// FindLastSubmatchIndex returns a slice holding the index pairs identifying
+// the last match of the regular expression in b and the matches, if any, of
+// its subexpressions. The last match is found by scanning backwards from the
+// end of b for the match that begins furthest to the right, and then
+// extending it as far to the left as possible, so that for example \d+
+// finds all of "345" at the end of "12 345" rather than just "5". It is only
+// extended to a position from which the leftmost-first match ends in the
+// same place, so x*|abc finds the empty match at the end of "zabc". A
+// return value of nil indicates no match.
+func (re *Regexp) FindLastSubmatchIndex(b []byte) []int {
+	if b == nil {
+		b = []byte{}
+	}
+	return re.pad(re.doExecuteLast(b, "", re.prog.NumCap))
+}
+
+// FindLastStringSubmatchIndex is like FindLastSubmatchIndex but for strings.
+func (re *Regexp) FindLastStringSubmatchIndex(s string) []int {
+	return re.pad(re.doExecuteLast(nil, s, re.prog.NumCap))
+}
+
+// FindLastIndex returns a two-element slice of integers defining the
+// location of the last match in b of the regular expression, as defined by
+// FindLastSubmatchIndex. A return value of nil indicates no match.
+func (re *Regexp) FindLastIndex(b []byte) []int {
+	if b == nil {
+		b = []byte{}
+	}
+	return re.doExecuteLast(b, "", 2)
+}
+
+// FindLastStringIndex is like FindLastIndex but for strings.
+func (re *Regexp) FindLastStringIndex(s string) []int {
+	return re.doExecuteLast(nil, s, 2)
+}
+
+// doExecuteLast finds the last match in b if b is non-nil, otherwise in s,
+// and returns the position of its subexpressions.
+func (re *Regexp) doExecuteLast(b []byte, s string, ncap int) []int {
+	if re.cond&syntax.EmptyBeginText != 0 {
+		// Anchored at the beginning, so there can be only one match.
+		return re.doExecute(nil, b, s, 0, ncap, nil)
+	}
+	bg := re.newBudget(nil)
+	if re.ext != nil || re.fuzzy != nil {
+		// The reverse program cannot follow extended syntax or edits, so
+		// take the last of the successive non-overlapping matches instead.
+		var last []int
+		re.eachMatch(bg, s, b, len(b)+len(s)+1, false, func(match []int) bool {
+			last = match
+			return true
+		})
+		if last == nil || bg.exhausted() {
+			return nil
+		}
+		if ncap < re.prog.NumCap {
+			// Keep the edits that follow the captures of an approximate match
+			// only if all of the captures were requested.
+			last = last[:ncap]
+		}
+		return last
+	}
+
+	// Scan backwards for the rightmost position at which a match begins.
+	m := re.get()
+	i, size := m.newInputString(s), len(s)
+	if b != nil {
+		i, size = m.newInputBytes(b), len(b)
+	}
+	re.reverseProg()
+	if m.last == nil {
+		m.last = newDFA(re.reverse, re.empty, false, true, true)
+	}
+	start, _ := m.last.search(i, size, 0, len(re.suffix) > 0, re, true, bg)
+	if start < 0 {
+		re.put(m)
+		return nil
+	}
+
+	// Find where the match that begins there ends.
+	re.put(m)
+	a := re.executeAt(bg, nil, b, s, start, start+1, 2, nil)
+	if a == nil {
+		return nil // only if the budget ran out
+	}
+
+	// Extend the match backwards as far as possible. The reverse DFA finds
+	// every position at which some match ending at a[1] begins, in a single
+	// scan, but the match preferred there may end somewhere else, so the
+	// leftmost position whose preferred match also ends at a[1] is used.
+	m = re.get()
+	i = m.newInputString(s)
+	if b != nil {
+		i = m.newInputBytes(b)
+	}
+	if m.rev == nil {
+		m.rev = newDFA(re.reverse, re.empty, true, true, true)
+	}
+	m.rev.record = true
+	m.rev.search(i, a[1], 0, false, re, false, bg)
+	m.rev.record = false
+	for k := len(m.rev.bounds) - 1; k >= 0; k-- {
+		first := m.rev.bounds[k]
+		if first >= start {
+			break
+		}
+		if ext := re.executeAt(bg, nil, b, s, first, first+1, ncap, nil); ext != nil && ext[1] == a[1] {
+			re.put(m)
+			return ext
+		}
+	}
+	re.put(m)
+	return re.executeAt(bg, nil, b, s, start, start+1, ncap, nil)
+}
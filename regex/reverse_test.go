@@ -0,0 +1,66 @@
+package regex
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// findLastReference finds the last match of pattern in s using the standard
+// library: the rightmost position at which a match begins, extended left to
+// the earliest position from which the preferred match ends in the same place
+func findLastReference(pattern, s string) []int {
+	prefix := regexp.MustCompile(`^(?:` + pattern + `)`)
+	for p := len(s); p >= 0; p-- {
+		loc := prefix.FindStringIndex(s[p:])
+		if loc == nil {
+			continue
+		}
+		end := p + loc[1]
+		for q := 0; q <= p; q++ {
+			if loc = prefix.FindStringIndex(s[q:]); loc != nil && q+loc[1] == end {
+				return []int{q, end}
+			}
+		}
+	}
+	return nil
+}
+
+func TestFindLastMatchesReference(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, pattern := range engineTestPatterns {
+		if strings.ContainsAny(pattern, "^$") || strings.Contains(pattern, `\b`) || strings.Contains(pattern, `\B`) {
+			continue // the reference does not preserve context at the cut
+		}
+		re := MustCompile(pattern)
+		for i := 0; i < 10; i++ {
+			s := randomText(r, 1+r.Intn(300))
+			if !assert.Equal(t, findLastReference(pattern, s), re.FindLastStringIndex(s), pattern) {
+				break
+			}
+		}
+	}
+}
+
+func TestFindLastPreferredMatch(t *testing.T) {
+	// "abc" matches, but at its start the empty match is preferred
+	assert.Equal(t, []int{4, 4}, MustCompile(`x*|abc`).FindLastStringIndex("zabc"))
+	assert.Equal(t, []int{2, 4}, MustCompile(`b*c|x*|abc`).FindLastStringIndex("zabc"))
+	assert.Equal(t, []int{3, 6}, MustCompile(`\d+`).FindLastStringIndex("12 345"))
+}
+
+func TestFindLastAnchored(t *testing.T) {
+	assert.Equal(t, []int{8, 12}, MustCompile(`\w+$`).FindLastStringIndex("ham and spam"))
+	assert.Equal(t, []int{0, 3}, MustCompile(`^\w+`).FindLastStringIndex("ham and spam"))
+	assert.Equal(t, []int{4, 7}, MustCompile(`(?m)^\w+`).FindLastStringIndex("ham\nand spam"))
+	assert.Nil(t, MustCompile(`z+$`).FindLastStringIndex("ham and spam"))
+}
+
+func TestFindLastSuffix(t *testing.T) {
+	re := MustCompile(`(\w)\w*\.go`)
+	assert.Equal(t, []int{8, 14, 8, 9}, re.FindLastStringSubmatchIndex("foo.go, bar.go, baz"))
+	assert.Nil(t, re.FindLastStringSubmatchIndex("foo.c, bar.c"))
+}
@@ -0,0 +1,606 @@
+package regex
+
+import (
+	"encoding/binary"
+	"errors"
+	"regexp/syntax"
+)
+
+// serialMagic begins the data written by MarshalBinary. Its last byte is
+// the version of the format, which changes whenever the compiled form of a
+// Regexp does.
+const serialMagic = "rgx\x01"
+
+var errSerialFormat = errors.New("regexp: data was not encoded by this version of MarshalBinary")
+
+// An encoder appends values to a buffer as varints and length-prefixed
+// strings.
+type encoder struct {
+	buf []byte
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) int(v int) {
+	n := binary.PutVarint(e.tmp[:], int64(v))
+	e.buf = append(e.buf, e.tmp[:n]...)
+}
+
+func (e *encoder) uint(v uint64) {
+	n := binary.PutUvarint(e.tmp[:], v)
+	e.buf = append(e.buf, e.tmp[:n]...)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) strings(list []string) {
+	e.bool(list != nil)
+	e.uint(uint64(len(list)))
+	for _, s := range list {
+		e.string(s)
+	}
+}
+
+func (e *encoder) runes(list []rune) {
+	e.uint(uint64(len(list)))
+	for _, r := range list {
+		e.int(int(r))
+	}
+}
+
+func (e *encoder) inst(inst *syntax.Inst) {
+	e.uint(uint64(inst.Op))
+	e.uint(uint64(inst.Out))
+	e.uint(uint64(inst.Arg))
+	e.runes(inst.Rune)
+}
+
+func (e *encoder) syntax(re *syntax.Regexp) {
+	e.uint(uint64(re.Op))
+	e.uint(uint64(re.Flags))
+	e.runes(re.Rune)
+	e.int(re.Min)
+	e.int(re.Max)
+	e.int(re.Cap)
+	e.string(re.Name)
+	e.uint(uint64(len(re.Sub)))
+	for _, sub := range re.Sub {
+		e.syntax(sub)
+	}
+}
+
+// A decoder reads the values appended by an encoder. After the first error
+// every method returns a zero value.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) fail() {
+	d.buf, d.err = nil, errSerialFormat
+}
+
+func (d *decoder) int() int {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return int(v)
+}
+
+func (d *decoder) uint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// len reads the length of a list, each element of which takes at least one
+// byte, so that corrupt data cannot cause a huge allocation.
+func (d *decoder) len() int {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bool() bool {
+	return d.uint() != 0
+}
+
+func (d *decoder) string() string {
+	n := d.len()
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.len()
+	b := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) strings() []string {
+	present := d.bool()
+	n := d.len()
+	if !present {
+		return nil
+	}
+	list := make([]string, n)
+	for i := range list {
+		list[i] = d.string()
+	}
+	return list
+}
+
+func (d *decoder) runes() []rune {
+	n := d.len()
+	if n == 0 {
+		return nil
+	}
+	list := make([]rune, n)
+	for i := range list {
+		list[i] = rune(d.int())
+	}
+	return list
+}
+
+func (d *decoder) inst(inst *syntax.Inst) {
+	inst.Op = syntax.InstOp(d.uint())
+	inst.Out = uint32(d.uint())
+	inst.Arg = uint32(d.uint())
+	inst.Rune = d.runes()
+}
+
+func (d *decoder) syntax() *syntax.Regexp {
+	re := &syntax.Regexp{
+		Op:    syntax.Op(d.uint()),
+		Flags: syntax.Flags(d.uint()),
+		Rune:  d.runes(),
+		Min:   d.int(),
+		Max:   d.int(),
+		Cap:   d.int(),
+		Name:  d.string(),
+	}
+	n := d.len()
+	for i := 0; i < n && d.err == nil; i++ {
+		re.Sub = append(re.Sub, d.syntax())
+	}
+	return re
+}
+
+// checkSyntax reads a syntax tree written by encoder.syntax without building
+// it, and reports whether compiling it cannot fail: every node has the
+// number of children its op requires, character classes hold pairs of
+// runes, and captures are numbered below numSubexp+1. Only the ops found
+// in simplified trees are accepted.
+func (d *decoder) checkSyntax(numSubexp int) bool {
+	op := syntax.Op(d.uint())
+	d.uint() // flags
+	nrunes := d.len()
+	for i := 0; i < nrunes; i++ {
+		d.int()
+	}
+	d.int() // min
+	d.int() // max
+	capture := d.int()
+	d.bytes() // name
+	nsub := d.len()
+	if d.err != nil {
+		return false
+	}
+	switch op {
+	case syntax.OpNoMatch, syntax.OpEmptyMatch, syntax.OpLiteral, syntax.OpAnyCharNotNL, syntax.OpAnyChar,
+		syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		if nsub != 0 {
+			return false
+		}
+	case syntax.OpCharClass:
+		if nsub != 0 || nrunes%2 != 0 {
+			return false
+		}
+	case syntax.OpCapture:
+		if nsub != 1 || capture < 0 || capture > numSubexp {
+			return false
+		}
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest:
+		if nsub != 1 {
+			return false
+		}
+	case syntax.OpConcat, syntax.OpAlternate:
+	default:
+		return false
+	}
+	for i := 0; i < nsub; i++ {
+		if !d.checkSyntax(numSubexp) {
+			return false
+		}
+	}
+	return true
+}
+
+// simplified returns the simplified syntax tree of re. The tree of a
+// Regexp restored by UnmarshalBinary is only needed to compile the reverse
+// program, so it is not decoded until then.
+func (re *Regexp) simplified() *syntax.Regexp {
+	re.syntaxOnce.Do(func() {
+		if re.syntaxData == nil {
+			return
+		}
+		d := &decoder{buf: re.syntaxData}
+		re.syntax = d.syntax()
+		if d.err != nil || len(d.buf) != 0 {
+			panic(errSerialFormat)
+		}
+		re.syntaxData = nil
+	})
+	return re.syntax
+}
+
+// MarshalBinary encodes the compiled form of re, including its program,
+// onepass tables, and the settings made since it was compiled, such as
+// Longest, ByteMode, and SetMaxSteps. UnmarshalBinary restores it without
+// parsing or compiling the expression again, so a program that compiles
+// many expressions at startup can instead load them from data generated
+// ahead of time. Expressions that use the extended syntax or allow edits
+// cannot be encoded.
+func (re *Regexp) MarshalBinary() ([]byte, error) {
+	if re.ext != nil {
+		return nil, errors.New("regexp: cannot marshal an expression that uses extended syntax")
+	}
+	if re.fuzzy != nil {
+		return nil, errors.New("regexp: cannot marshal an expression that allows edits")
+	}
+	e := &encoder{buf: []byte(serialMagic)}
+	e.string(re.expr)
+
+	// The program
+	e.uint(uint64(len(re.prog.Inst)))
+	for i := range re.prog.Inst {
+		e.inst(&re.prog.Inst[i])
+	}
+	e.int(re.prog.Start)
+	e.int(re.prog.NumCap)
+
+	// The onepass program
+	e.bool(re.onepass != notOnePass)
+	if re.onepass != notOnePass {
+		e.uint(uint64(len(re.onepass.Inst)))
+		for i := range re.onepass.Inst {
+			inst := &re.onepass.Inst[i]
+			e.inst(&inst.Inst)
+			e.uint(uint64(len(inst.Next)))
+			for _, next := range inst.Next {
+				e.uint(uint64(next))
+			}
+		}
+		e.int(re.onepass.Start)
+		e.int(re.onepass.NumCap)
+	}
+	e.string(re.notOnePass)
+
+	// The literals used to skip ahead
+	e.string(re.prefix)
+	e.bool(re.prefixComplete)
+	e.int(int(re.prefixRune))
+	e.uint(uint64(re.prefixEnd))
+	e.strings(re.required)
+	e.int(re.requiredBefore)
+	e.strings(re.suffix)
+
+	// Everything else
+	e.int(re.numSubexp)
+	e.strings(re.subexpNames)
+	tree := &encoder{}
+	tree.syntax(re.simplified())
+	e.bytes(tree.buf)
+	e.bool(re.longest)
+	e.bool(re.useDFA)
+	e.int(re.maxSteps)
+	e.bool(re.latin1)
+	e.uint(uint64(re.empty))
+	e.uint(uint64(re.strategies))
+	e.int(re.maxBacktrack)
+	return e.buf, nil
+}
+
+// UnmarshalBinary restores a Regexp encoded by MarshalBinary into re, which
+// must be new, as in
+//
+//	re := new(regex.Regexp)
+//	err := re.UnmarshalBinary(data)
+//
+// It returns an error if data was encoded by a different version of this
+// package, or if it is not consistent with a compiled expression, which
+// rules out data that would make searches panic or loop forever. Beyond
+// that, data that has been tampered with can load successfully and then
+// match different text, so it should come from a trusted source.
+func (re *Regexp) UnmarshalBinary(data []byte) error {
+	if len(data) < len(serialMagic) || string(data[:len(serialMagic)]) != serialMagic {
+		return errSerialFormat
+	}
+	d := &decoder{buf: data[len(serialMagic):]}
+	re.expr = d.string()
+
+	// The program
+	prog := &syntax.Prog{Inst: make([]syntax.Inst, d.len())}
+	for i := range prog.Inst {
+		d.inst(&prog.Inst[i])
+	}
+	prog.Start = d.int()
+	prog.NumCap = d.int()
+	re.prog = prog
+
+	// The onepass program
+	re.onepass = notOnePass
+	if d.bool() {
+		op := &onePassProg{Inst: make([]onePassInst, d.len())}
+		for i := range op.Inst {
+			inst := &op.Inst[i]
+			d.inst(&inst.Inst)
+			if n := d.len(); n > 0 {
+				inst.Next = make([]uint32, n)
+				for j := range inst.Next {
+					inst.Next[j] = uint32(d.uint())
+				}
+			}
+		}
+		op.Start = d.int()
+		op.NumCap = d.int()
+		re.onepass = op
+	}
+	re.notOnePass = d.string()
+
+	// The literals used to skip ahead
+	re.prefix = d.string()
+	re.prefixComplete = d.bool()
+	re.prefixRune = rune(d.int())
+	re.prefixEnd = uint32(d.uint())
+	re.required = d.strings()
+	re.requiredBefore = d.int()
+	re.suffix = d.strings()
+
+	// Everything else
+	re.numSubexp = d.int()
+	re.subexpNames = d.strings()
+	re.syntaxData = d.bytes()
+	re.longest = d.bool()
+	re.useDFA = d.bool()
+	re.maxSteps = d.int()
+	re.latin1 = d.bool()
+	re.empty = emptyMode(d.uint())
+	re.strategies = Strategy(d.uint())
+	re.maxBacktrack = d.int()
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buf) != 0 || !re.validProg() {
+		return errSerialFormat
+	}
+	tree := &decoder{buf: re.syntaxData}
+	if !tree.checkSyntax(re.numSubexp) || len(tree.buf) != 0 {
+		return errSerialFormat
+	}
+
+	// Rebuild the derived fields
+	re.cond = prog.StartCond()
+	if re.prefix != "" {
+		re.prefixBytes = []byte(re.prefix)
+	}
+	if len(re.required) == 1 {
+		re.requiredBytes = []byte(re.required[0])
+	} else if len(re.required) > 1 {
+		re.requiredSet = newLiteralSet(re.required)
+	}
+	for _, lit := range re.required {
+		if len(lit) > re.requiredMax {
+			re.requiredMax = len(lit)
+		}
+	}
+	for _, lit := range re.suffix {
+		re.suffixBytes = append(re.suffixBytes, []byte(lit))
+	}
+	return nil
+}
+
+// validProg reports whether the decoded programs and the fields describing
+// them are consistent in the ways that searches rely on, so that corrupt
+// data cannot make a search index out of range, meet an unknown
+// instruction, or loop forever.
+func (re *Regexp) validProg() bool {
+	prog := re.prog
+	if re.numSubexp < 0 || prog.NumCap < 2 || prog.NumCap > 2*(re.numSubexp+1) ||
+		len(re.subexpNames) != re.numSubexp+1 ||
+		re.maxBacktrack < 0 || re.requiredBefore < unbounded {
+		return false
+	}
+	// As compiled, the program begins with the only InstFail, which the
+	// matchers treat as a dead end and never follow an instruction to.
+	n := uint32(len(prog.Inst))
+	if prog.Start < 0 || uint32(prog.Start) >= n || prog.Inst[0].Op != syntax.InstFail {
+		return false
+	}
+	for i := range prog.Inst {
+		inst := &prog.Inst[i]
+		if !validInst(inst, n, prog.NumCap) {
+			return false
+		}
+		switch inst.Op {
+		case syntax.InstFail:
+			if i != 0 {
+				return false
+			}
+		case syntax.InstMatch:
+		case syntax.InstAlt, syntax.InstAltMatch:
+			if len(inst.Rune) != 0 || inst.Out == 0 || inst.Arg == 0 {
+				return false
+			}
+		default:
+			if inst.Out == 0 {
+				return false
+			}
+		}
+	}
+	if emptyLoops(prog) {
+		return false
+	}
+	if re.onepass == notOnePass {
+		return true
+	}
+
+	// The onepass matcher follows Alt instructions by the rune ranges in
+	// their Rune slices to the pcs in Next, or to Inst[0], which must fail,
+	// if none match. It never revisits a pc without consuming a rune.
+	op := re.onepass
+	n = uint32(len(op.Inst))
+	if op.NumCap != prog.NumCap || op.Start < 0 || uint32(op.Start) >= n ||
+		op.Inst[0].Op != syntax.InstFail || re.prefixEnd >= n {
+		return false
+	}
+	for i := range op.Inst {
+		inst := &op.Inst[i]
+		switch inst.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			if !validInst(&syntax.Inst{Op: syntax.InstRune, Out: inst.Out, Rune: inst.Rune}, n, op.NumCap) ||
+				inst.Arg >= n || len(inst.Next) < (len(inst.Rune)+1)/2 {
+				return false
+			}
+		default:
+			if !validInst(&inst.Inst, n, op.NumCap) {
+				return false
+			}
+		}
+		for _, next := range inst.Next {
+			if next >= n {
+				return false
+			}
+		}
+	}
+	return !onePassLoops(op)
+}
+
+// validInst reports whether inst is an instruction that the matchers know,
+// with its operands in range for a program of n instructions with ncap
+// captures.
+func validInst(inst *syntax.Inst, n uint32, ncap int) bool {
+	switch inst.Op {
+	case syntax.InstAlt, syntax.InstAltMatch:
+		return inst.Out < n && inst.Arg < n
+	case syntax.InstMatch, syntax.InstFail:
+		return true
+	case syntax.InstCapture:
+		return inst.Out < n && int(inst.Arg) < ncap
+	case syntax.InstEmptyWidth, syntax.InstNop, syntax.InstRuneAny, syntax.InstRuneAnyNotNL:
+		return inst.Out < n
+	case syntax.InstRune:
+		// An empty class compiles to an InstRune that matches nothing
+		return inst.Out < n && (len(inst.Rune) == 1 || len(inst.Rune)%2 == 0)
+	case syntax.InstRune1:
+		return inst.Out < n && len(inst.Rune) == 1
+	}
+	return false
+}
+
+// emptyLoops reports whether prog has a cycle of Nop, Capture and
+// EmptyWidth instructions, which prog.StartCond would follow forever.
+// Compiled programs only loop through Alt instructions.
+func emptyLoops(prog *syntax.Prog) bool {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]uint8, len(prog.Inst))
+	empty := func(pc uint32) bool {
+		switch prog.Inst[pc].Op {
+		case syntax.InstNop, syntax.InstCapture, syntax.InstEmptyWidth:
+			return true
+		}
+		return false
+	}
+	for start := range prog.Inst {
+		pc := uint32(start)
+		for state[pc] == unvisited && empty(pc) {
+			state[pc] = visiting
+			pc = prog.Inst[pc].Out
+		}
+		if state[pc] == visiting {
+			return true
+		}
+		for pc = uint32(start); state[pc] == visiting; pc = prog.Inst[pc].Out {
+			state[pc] = done
+		}
+	}
+	return false
+}
+
+// onePassLoops reports whether the onepass program can reach the same pc
+// twice without consuming a rune, which would make the onepass matcher
+// loop forever.
+func onePassLoops(op *onePassProg) bool {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]uint8, len(op.Inst))
+	var loops func(pc uint32) bool
+	loops = func(pc uint32) bool {
+		switch state[pc] {
+		case visiting:
+			return true
+		case done:
+			return false
+		}
+		state[pc] = visiting
+		inst := &op.Inst[pc]
+		switch inst.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			for _, next := range inst.Next {
+				if loops(next) {
+					return true
+				}
+			}
+			if inst.Op == syntax.InstAltMatch && loops(inst.Out) {
+				return true
+			}
+		case syntax.InstNop, syntax.InstEmptyWidth, syntax.InstCapture:
+			if loops(inst.Out) {
+				return true
+			}
+		}
+		state[pc] = done
+		return false
+	}
+	for pc := range op.Inst {
+		if loops(uint32(pc)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package regex
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	patterns := append([]string{`^abc(\w+)@(\w+)\.com$`, `(?P<first>a|ab)(?P<second>c|bcd)`, `[^\x00-\x{10FFFF}]`, `(?m)^[^\n]*d$`}, engineTestPatterns...)
+	r := rand.New(rand.NewSource(1))
+	in := randomText(r, 5000)
+	for _, pattern := range patterns {
+		for _, bytemode := range []bool{false, true} {
+			re := MustCompile(pattern)
+			re.Longest()
+			if bytemode {
+				re.ByteMode()
+			}
+			data, err := re.MarshalBinary()
+			require.NoError(t, err, pattern)
+
+			loaded := new(Regexp)
+			require.NoError(t, loaded.UnmarshalBinary(data), pattern)
+			assert.Equal(t, re.String(), loaded.String())
+			assert.Equal(t, re.SubexpNames(), loaded.SubexpNames())
+			assert.Equal(t, re.Stats(), loaded.Stats())
+			assert.Equal(t, re.FindAllStringSubmatchIndex(in, -1), loaded.FindAllStringSubmatchIndex(in, -1), pattern)
+			assert.Equal(t, re.FindLastSubmatchIndex([]byte(in)), loaded.FindLastSubmatchIndex([]byte(in)), pattern)
+		}
+	}
+
+	_, err := MustCompileExtended(`(a)\k<1>`).MarshalBinary()
+	assert.Error(t, err)
+	assert.Error(t, new(Regexp).UnmarshalBinary([]byte("garbage")))
+
+	data, err := MustCompile(`(a+)b`).MarshalBinary()
+	require.NoError(t, err)
+	for n := 0; n < len(data); n++ {
+		assert.Error(t, new(Regexp).UnmarshalBinary(data[:n]))
+	}
+}
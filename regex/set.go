@@ -0,0 +1,422 @@
+package regex
+
+import (
+	"errors"
+	"regexp/syntax"
+	"strings"
+	"sync"
+)
+
+// Set is a collection of regular expressions that are matched against an
+// input together, in a single pass. The expressions are compiled into one
+// program in which each expression is an alternative wrapped in a capture
+// group, so the index of the capture group that matched identifies the
+// expression. A Set is safe for concurrent use by multiple goroutines.
+type Set struct {
+	re      *Regexp   // alternation of all members
+	members []*Regexp // members compiled on their own, for submatches
+
+	machines sync.Pool // cache of machines for running the set
+}
+
+// CompileSet parses a list of regular expressions and returns, if
+// successful, a Set that matches them all at once. Each expression uses the
+// same syntax and leftmost-first semantics as Compile.
+func CompileSet(exprs []string) (*Set, error) {
+	asts := make([]*syntax.Regexp, len(exprs))
+	for i, expr := range exprs {
+		ast, err := syntax.Parse(expr, syntax.Perl)
+		if err != nil {
+			return nil, err
+		}
+		asts[i] = ast
+	}
+	return compileSet(asts, exprs, false)
+}
+
+// CompileSetSyntax is like CompileSet but takes syntax trees as input.
+func CompileSetSyntax(asts []*syntax.Regexp) (*Set, error) {
+	exprs := make([]string, len(asts))
+	for i, ast := range asts {
+		exprs[i] = ast.String()
+	}
+	return compileSet(asts, exprs, false)
+}
+
+// MustCompileSet is like CompileSet but panics if any of the expressions
+// cannot be parsed.
+func MustCompileSet(exprs []string) *Set {
+	set, err := CompileSet(exprs)
+	if err != nil {
+		panic(`regexp: CompileSet(` + quote(strings.Join(exprs, "|")) + `): ` + err.Error())
+	}
+	return set
+}
+
+func compileSet(asts []*syntax.Regexp, exprs []string, longest bool) (*Set, error) {
+	set := &Set{}
+	alt := &syntax.Regexp{Op: syntax.OpAlternate}
+	for i, ast := range asts {
+		member, err := compileSyntax(ast, exprs[i], longest)
+		if err != nil {
+			return nil, err
+		}
+		if member.ext != nil {
+			return nil, errors.New("regexp: a set cannot contain backreferences or lookaround: " + exprs[i])
+		}
+		set.members = append(set.members, member)
+		alt.Sub = append(alt.Sub, &syntax.Regexp{
+			Op:  syntax.OpCapture,
+			Cap: i + 1,
+			Sub: []*syntax.Regexp{stripCaptures(member.simplified())},
+		})
+	}
+	if len(alt.Sub) == 0 {
+		alt.Op = syntax.OpNoMatch
+	}
+	re, err := compileSyntax(alt, strings.Join(exprs, "|"), longest)
+	if err != nil {
+		return nil, err
+	}
+	set.re = re
+	return set, nil
+}
+
+// Longest makes future searches prefer the leftmost-longest match, both
+// within each expression and between expressions that match at the same
+// position. It should be called before the Set is used.
+func (set *Set) Longest() {
+	set.re.Longest()
+	for _, member := range set.members {
+		member.Longest()
+	}
+}
+
+// ByteMode makes future searches treat each byte of the input as a single
+// rune, as described at Regexp.ByteMode. It should be called before the Set
+// is used.
+func (set *Set) ByteMode() {
+	set.re.ByteMode()
+	for _, member := range set.members {
+		member.ByteMode()
+	}
+}
+
+// UnicodeWordBoundaries makes \b and \B in future searches treat any Unicode
+// letter, digit, mark, or connector punctuation as a word character, as
+// described at Regexp.UnicodeWordBoundaries. It should be called before the
+// Set is used.
+func (set *Set) UnicodeWordBoundaries() {
+	set.re.UnicodeWordBoundaries()
+	for _, member := range set.members {
+		member.UnicodeWordBoundaries()
+	}
+}
+
+// CRLFLineEndings makes ^ and $ in multi-line mode treat \r\n as a single
+// line ending, as described at Regexp.CRLFLineEndings. It should be called
+// before the Set is used.
+func (set *Set) CRLFLineEndings() {
+	set.re.CRLFLineEndings()
+	for _, member := range set.members {
+		member.CRLFLineEndings()
+	}
+}
+
+// SetMaxSteps limits the work done by each future search, as described at
+// Regexp.SetMaxSteps. Matches also stops and reports no match if it runs out
+// of steps. It should be called before the Set is used.
+func (set *Set) SetMaxSteps(n int) {
+	set.re.SetMaxSteps(n)
+	for _, member := range set.members {
+		member.SetMaxSteps(n)
+	}
+}
+
+// SetStrategies restricts future searches to the strategies in s, as
+// described at Regexp.SetStrategies. It returns an error, and leaves the Set
+// unchanged, if s contains no strategy that can find submatches in the set
+// or in one of its expressions. It should be called before the Set is used.
+func (set *Set) SetStrategies(s Strategy) error {
+	all := append([]*Regexp{set.re}, set.members...)
+	prev := make([]Strategy, len(all))
+	for i, re := range all {
+		prev[i] = re.strategies
+		if err := re.SetStrategies(s); err != nil {
+			for j := 0; j < i; j++ {
+				all[j].strategies = prev[j]
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMaxBacktrackVector sets the size of the largest set of visited states
+// that the backtracker may use, as described at
+// Regexp.SetMaxBacktrackVector. It should be called before the Set is used.
+func (set *Set) SetMaxBacktrackVector(bits int) {
+	set.re.SetMaxBacktrackVector(bits)
+	for _, member := range set.members {
+		member.SetMaxBacktrackVector(bits)
+	}
+}
+
+// stripCaptures returns a copy of the syntax tree re with its capture groups
+// removed, so that the only captures in a set are those identifying members.
+func stripCaptures(re *syntax.Regexp) *syntax.Regexp {
+	if re.Op == syntax.OpCapture {
+		return stripCaptures(re.Sub[0])
+	}
+	out := *re
+	out.Sub = nil
+	out.Sub0 = [1]*syntax.Regexp{}
+	for _, sub := range re.Sub {
+		out.Sub = append(out.Sub, stripCaptures(sub))
+	}
+	return &out
+}
+
+// Len returns the number of expressions in the set.
+func (set *Set) Len() int {
+	return len(set.members)
+}
+
+// Regexp returns the i-th expression in the set, compiled on its own.
+func (set *Set) Regexp(i int) *Regexp {
+	return set.members[i]
+}
+
+// FindSubmatchIndex finds the leftmost match in b of any expression in the
+// set and returns the index of that expression together with the index
+// pairs of its match and submatches, as returned by FindSubmatchIndex on
+// that expression alone. If several expressions match at the leftmost
+// position then the earliest in the set wins, unless the set uses
+// leftmost-longest semantics, in which case the longest match wins. A
+// return value of -1, nil indicates no match.
+func (set *Set) FindSubmatchIndex(b []byte) (int, []int) {
+	if b == nil {
+		b = []byte{}
+	}
+	return set.find(b, "")
+}
+
+// FindStringSubmatchIndex is like FindSubmatchIndex but for strings.
+func (set *Set) FindStringSubmatchIndex(s string) (int, []int) {
+	return set.find(nil, s)
+}
+
+func (set *Set) find(b []byte, s string) (int, []int) {
+	a := set.re.doExecute(nil, b, s, 0, set.re.prog.NumCap, nil)
+	if a == nil {
+		return -1, nil
+	}
+	for k := range set.members {
+		if 2*k+2 < len(a) && a[2*k+2] >= 0 {
+			// The member's own leftmost match begins at the same place,
+			// and running it from there yields its submatches.
+			member := set.members[k]
+			return k, member.pad(member.doExecute(nil, b, s, a[0], member.prog.NumCap, nil))
+		}
+	}
+	return -1, nil // cannot happen
+}
+
+// FindPrefixSubmatchIndexAt is like FindSubmatchIndex but only finds a match
+// that begins exactly at pos, as described at Regexp.FindPrefixSubmatchIndexAt,
+// which makes it suitable for splitting an input into tokens.
+func (set *Set) FindPrefixSubmatchIndexAt(b []byte, pos int) (int, []int) {
+	if pos < 0 || pos > len(b) {
+		return -1, nil
+	}
+	a := set.re.executeAt(set.re.newBudget(nil), nil, b, "", pos, pos+1, set.re.prog.NumCap, nil)
+	if a == nil {
+		return -1, nil
+	}
+	for k := range set.members {
+		if 2*k+2 < len(a) && a[2*k+2] >= 0 {
+			return k, set.members[k].FindPrefixSubmatchIndexAt(b, pos)
+		}
+	}
+	return -1, nil // cannot happen
+}
+
+// Matches returns the indices, in increasing order, of the expressions in
+// the set that match somewhere in b. The input is scanned once no matter
+// how many expressions are in the set, stopping early once every expression
+// has matched.
+func (set *Set) Matches(b []byte) []int {
+	if b == nil {
+		b = []byte{}
+	}
+	m := set.get()
+	defer set.put(m)
+	m.budget = set.re.newBudget(nil)
+	return m.run(m.newInputBytes(b))
+}
+
+// MatchesString is like Matches but for strings.
+func (set *Set) MatchesString(s string) []int {
+	m := set.get()
+	defer set.put(m)
+	m.budget = set.re.newBudget(nil)
+	return m.run(m.newInputString(s))
+}
+
+// get returns a machine to use for matching the set.
+func (set *Set) get() *setMachine {
+	if m, ok := set.machines.Get().(*setMachine); ok {
+		return m
+	}
+	n := len(set.re.prog.Inst)
+	return &setMachine{
+		re:      set.re,
+		q0:      newSparseSet(n),
+		q1:      newSparseSet(n),
+		matched: make([]bool, len(set.members)),
+	}
+}
+
+// put returns a machine to the set's machine cache.
+func (set *Set) put(m *setMachine) {
+	m.budget = nil
+	m.inputBytes.str = nil
+	m.inputString.str = ""
+	set.machines.Put(m)
+}
+
+// A setMachine runs an NFA simulation over the program for a set without
+// tracking submatches, recording each member that reaches the end of its
+// capture group.
+type setMachine struct {
+	re      *Regexp
+	q0, q1  sparseSet
+	stack   []uint32
+	matched []bool  // matched[k] is set once member k has matched
+	pending int     // number of members not yet matched
+	budget  *budget // limits the work done by the current call, or nil
+
+	// cached inputs, to avoid allocation
+	inputBytes  inputBytes
+	inputString inputString
+}
+
+func (m *setMachine) newInputBytes(b []byte) input {
+	m.inputBytes.str = b
+	m.inputBytes.latin1 = m.re.latin1
+	m.inputBytes.empty = m.re.empty
+	return &m.inputBytes
+}
+
+func (m *setMachine) newInputString(s string) input {
+	m.inputString.str = s
+	m.inputString.latin1 = m.re.latin1
+	m.inputString.empty = m.re.empty
+	return &m.inputString
+}
+
+// run scans the input and returns the indices of the members that matched.
+func (m *setMachine) run(i input) []int {
+	for k := range m.matched {
+		m.matched[k] = false
+	}
+	m.pending = len(m.matched)
+
+	anchored := m.re.cond&syntax.EmptyBeginText != 0
+	runq, nextq := &m.q0, &m.q1
+	runq.clear()
+	nextq.clear()
+	pos := 0
+	r, width := i.step(pos)
+	r1, width1 := endOfText, 0
+	if r != endOfText {
+		r1, width1 = i.step(pos + width)
+	}
+	flag := m.re.empty.context(endOfText, r)
+	for m.pending > 0 {
+		if !m.budget.spend(len(runq.dense) + 1) {
+			return nil
+		}
+		if len(runq.dense) == 0 && anchored && pos != 0 {
+			break
+		}
+		if !anchored || pos == 0 {
+			m.add(runq, uint32(m.re.prog.Start), flag)
+		}
+		flag = m.re.empty.context(r, r1)
+		m.step(runq, nextq, r, flag)
+		if width == 0 {
+			break
+		}
+		pos += width
+		r, width = r1, width1
+		if r != endOfText {
+			r1, width1 = i.step(pos + width)
+		}
+		runq, nextq = nextq, runq
+	}
+
+	var ids []int
+	for k, matched := range m.matched {
+		if matched {
+			ids = append(ids, k)
+		}
+	}
+	return ids
+}
+
+// step advances each thread on runq over the rune c, adding the threads
+// that survive to nextq along with everything reachable from them under
+// the empty-width conditions in nextCond.
+func (m *setMachine) step(runq, nextq *sparseSet, c rune, nextCond syntax.EmptyOp) {
+	for _, pc := range runq.dense {
+		i := &m.re.prog.Inst[pc]
+		add := false
+		switch i.Op {
+		case syntax.InstRune:
+			add = i.MatchRune(c)
+		case syntax.InstRune1:
+			add = c == i.Rune[0]
+		case syntax.InstRuneAny:
+			add = c != endOfText
+		case syntax.InstRuneAnyNotNL:
+			add = c != endOfText && c != '\n'
+		}
+		if add {
+			m.add(nextq, i.Out, nextCond)
+		}
+	}
+	runq.clear()
+}
+
+// add adds pc to q along with every instruction reachable from it by
+// following empty-width conditions satisfied by cond. Reaching the end of
+// the capture group for a member means that member has matched.
+func (m *setMachine) add(q *sparseSet, pc uint32, cond syntax.EmptyOp) {
+	m.stack = append(m.stack[:0], pc)
+	for len(m.stack) > 0 {
+		pc := m.stack[len(m.stack)-1]
+		m.stack = m.stack[:len(m.stack)-1]
+		if pc == 0 || q.contains(pc) {
+			continue
+		}
+		q.insert(pc)
+		i := &m.re.prog.Inst[pc]
+		switch i.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			m.stack = append(m.stack, i.Arg, i.Out)
+		case syntax.InstEmptyWidth:
+			if syntax.EmptyOp(i.Arg)&^cond == 0 {
+				m.stack = append(m.stack, i.Out)
+			}
+		case syntax.InstNop:
+			m.stack = append(m.stack, i.Out)
+		case syntax.InstCapture:
+			if k := int(i.Arg)/2 - 1; i.Arg%2 == 1 && k >= 0 && !m.matched[k] {
+				m.matched[k] = true
+				m.pending--
+			}
+			m.stack = append(m.stack, i.Out)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package regex
+
+import (
+	"math/rand"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetMatchesIndividualPatterns(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	set := MustCompileSet(engineTestPatterns)
+	var stdlib []*regexp.Regexp
+	for _, pattern := range engineTestPatterns {
+		stdlib = append(stdlib, regexp.MustCompile(pattern))
+	}
+	for i := 0; i < 50; i++ {
+		s := randomText(r, 1+r.Intn(200))
+		var expected []int
+		first, firstLoc := -1, []int(nil)
+		for k, re := range stdlib {
+			loc := re.FindStringSubmatchIndex(s)
+			if loc == nil {
+				continue
+			}
+			expected = append(expected, k)
+			if firstLoc == nil || loc[0] < firstLoc[0] {
+				first, firstLoc = k, loc
+			}
+		}
+		assert.Equal(t, expected, set.MatchesString(s), s)
+		k, loc := set.FindStringSubmatchIndex(s)
+		assert.Equal(t, first, k, s)
+		assert.Equal(t, firstLoc, loc, s)
+	}
+}
+
+func TestSetAnchored(t *testing.T) {
+	set := MustCompileSet([]string{`^a`, `^b`, `c$`})
+	assert.Equal(t, []int{0, 2}, set.MatchesString("abc"))
+	assert.Equal(t, []int{1}, set.MatchesString("bab"))
+	assert.Nil(t, set.MatchesString("cab"))
+	k, loc := set.FindStringSubmatchIndex("xbc")
+	assert.Equal(t, 2, k)
+	assert.Equal(t, []int{2, 3}, loc)
+}
+
+func TestSetDotAtEnd(t *testing.T) {
+	set := MustCompileSet([]string{`$`, `$`, `.`})
+	assert.Equal(t, []int{0, 1}, set.MatchesString(""))
+	assert.Equal(t, []int{0, 1, 2}, set.MatchesString("a"))
+
+	set = MustCompileSet([]string{`ab.`, `b(?s:.)`, `b$`})
+	assert.Equal(t, []int{2}, set.MatchesString("ab"))
+	assert.Equal(t, []int{1}, set.MatchesString("b\n"))
+}
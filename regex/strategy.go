@@ -0,0 +1,146 @@
+package regex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Strategy is one of the ways in which a search can be carried out.
+// Strategies are bit flags, so a set of them can be formed with |.
+type Strategy uint8
+
+const (
+	// OnePass follows the single path through an expression that is
+	// anchored at both ends and in which the next character always decides
+	// which way to go. It is the fastest way to find submatches, and is
+	// used whenever the expression allows it.
+	OnePass Strategy = 1 << iota
+
+	// Backtrack finds submatches by backtracking, remembering which states
+	// it has visited so that it takes time linear in the input. It is used
+	// for inputs short enough that the visited set fits within the limit
+	// set by SetMaxBacktrackVector, and for programs of at most 500
+	// instructions.
+	Backtrack
+
+	// NFA finds submatches by simulating every possible path through the
+	// expression at once. It can be used for any input.
+	NFA
+
+	// DFA locates matches in long inputs using a lazily built automaton,
+	// after which one of the other strategies finds the submatches within
+	// the match. It is used whenever the backtracker is not.
+	DFA
+
+	// AllStrategies is the set of all strategies, which is the default.
+	AllStrategies = OnePass | Backtrack | NFA | DFA
+)
+
+var strategyNames = []string{"onepass", "backtrack", "nfa", "dfa"}
+
+// String returns the names of the strategies in s separated by "|", such
+// as "backtrack|nfa".
+func (s Strategy) String() string {
+	var names []string
+	for i, name := range strategyNames {
+		if s&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// SetStrategies restricts future searches to the strategies in s. For
+// example, SetStrategies(NFA) makes every search use the NFA, and
+// SetStrategies(AllStrategies &^ OnePass) prevents the onepass strategy from
+// being used. It returns an error if s contains no strategy that can find
+// submatches in re: NFA always can, Backtrack can unless the program is too
+// long, and OnePass can only if Stats reports that re is onepass. Searches
+// of a RuneReader use the onepass strategy if allowed and possible and the
+// NFA otherwise. Expressions that use the extended syntax, or that allow
+// approximate matches, have engines of their own and are not affected. It
+// should be called before the Regexp is used.
+func (re *Regexp) SetStrategies(s Strategy) error {
+	if s&NFA == 0 &&
+		(s&Backtrack == 0 || !shouldBacktrack(re.prog)) &&
+		(s&OnePass == 0 || re.onepass == notOnePass) {
+		if s&OnePass != 0 && re.notOnePass != "" {
+			return fmt.Errorf("onepass strategy cannot be used: %s", re.notOnePass)
+		}
+		return fmt.Errorf("%v cannot find submatches in this expression", s)
+	}
+	re.strategies = s
+	return nil
+}
+
+// SetMaxBacktrackVector sets the size, in bits, of the largest set of
+// visited states that the backtracker may use, which is the length of the
+// input times the number of instructions in the program. Inputs too long
+// for it are searched with one of the other strategies, unless they are
+// not allowed. The default is 256K bits, and zero leaves the backtracker
+// unused unless it is the only strategy allowed. It should be called before
+// the Regexp is used.
+func (re *Regexp) SetMaxBacktrackVector(bits int) {
+	re.maxBacktrack = bits
+}
+
+// Stats describes the compiled form of a Regexp, and so which strategies
+// its searches can use.
+type Stats struct {
+	NumInst         int      // instructions in the compiled program
+	NumCap          int      // parenthesized subexpressions, as returned by NumSubexp
+	OnePass         bool     // whether the onepass strategy can be used
+	NotOnePass      string   // why the onepass strategy cannot be used, or ""
+	LiteralPrefix   string   // literal text that every match begins with
+	PrefixComplete  bool     // whether LiteralPrefix is the entire expression
+	Strategies      Strategy // strategies that searches may use
+	MaxBacktrackLen int      // length of the longest input searched by backtracking
+	Extended        bool     // matched by the engine for extended syntax
+	Approximate     bool     // matched by the engine for approximate matching
+}
+
+// Stats returns a description of the compiled form of re.
+func (re *Regexp) Stats() Stats {
+	stats := Stats{
+		NumInst:         len(re.prog.Inst),
+		NumCap:          re.numSubexp,
+		OnePass:         re.onepass != notOnePass,
+		NotOnePass:      re.notOnePass,
+		LiteralPrefix:   re.prefix,
+		PrefixComplete:  re.prefixComplete,
+		Strategies:      re.strategies,
+		MaxBacktrackLen: re.maxBitStateLen(),
+		Extended:        re.ext != nil,
+		Approximate:     re.fuzzy != nil,
+	}
+	if stats.Extended || stats.Approximate {
+		stats.Strategies = 0
+	}
+	return stats
+}
+
+// String formats the stats as one "name: value" line for each.
+func (s Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "instructions: %d\n", s.NumInst)
+	fmt.Fprintf(&b, "captures: %d\n", s.NumCap)
+	if s.OnePass {
+		fmt.Fprintf(&b, "onepass: yes\n")
+	} else {
+		fmt.Fprintf(&b, "onepass: no (%s)\n", s.NotOnePass)
+	}
+	fmt.Fprintf(&b, "literal prefix: %q\n", s.LiteralPrefix)
+	switch {
+	case s.Extended:
+		fmt.Fprintf(&b, "engine: extended syntax\n")
+	case s.Approximate:
+		fmt.Fprintf(&b, "engine: approximate matching\n")
+	default:
+		fmt.Fprintf(&b, "strategies: %v\n", s.Strategies)
+		fmt.Fprintf(&b, "backtrack limit: %d bytes\n", s.MaxBacktrackLen)
+	}
+	return b.String()
+}
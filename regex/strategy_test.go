@@ -0,0 +1,85 @@
+package regex
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrategiesMatchStdlib(t *testing.T) {
+	patterns := []string{
+		`^(\w+)@(\w+)\.com$`,
+		`^[a-c]*d?$`,
+		`^(a+)(b|c)*$`,
+		`^x(y|z)*(?:@|\.)?$`,
+		`^(?i)(ab)+é?$`,
+		`(a|ab)(c|bcd)(d*)`,
+		`\bfoo\b`,
+		`(?m)^x\w+$`,
+	}
+	strategies := []Strategy{
+		AllStrategies,
+		OnePass,
+		Backtrack,
+		NFA,
+		DFA | NFA,
+		DFA | Backtrack,
+	}
+	alphabet := []string{"a", "b", "c", "d", "x", "y", "z", "@", ".com", "é", "É", "foo", " ", "\n"}
+	r := rand.New(rand.NewSource(1))
+	var inputs []string
+	for i := 0; i < 500; i++ {
+		var sb strings.Builder
+		for n := r.Intn(8); n > 0; n-- {
+			sb.WriteString(alphabet[r.Intn(len(alphabet))])
+		}
+		inputs = append(inputs, sb.String())
+	}
+	inputs = append(inputs, "abc@def.com", "aaab", "xyzy@", "abABé", randomText(r, 50000))
+
+	for _, pattern := range patterns {
+		theirs := regexp.MustCompile(pattern)
+		for _, s := range strategies {
+			ours := MustCompile(pattern)
+			if err := ours.SetStrategies(s); err != nil {
+				assert.Equal(t, OnePass, s, pattern)
+				continue
+			}
+			for _, in := range inputs {
+				if !assert.Equal(t, theirs.FindStringSubmatchIndex(in), ours.FindStringSubmatchIndex(in), "%s with %v on %q", pattern, s, in) {
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	stats := MustCompile(`^abc(\w+)@(\w+)\.com$`).Stats()
+	assert.True(t, stats.OnePass)
+	assert.Equal(t, "", stats.NotOnePass)
+	assert.Equal(t, 2, stats.NumCap)
+	assert.Equal(t, "abc", stats.LiteralPrefix)
+	assert.Equal(t, AllStrategies, stats.Strategies)
+	assert.True(t, stats.NumInst > 0)
+	assert.Equal(t, 256*1024/stats.NumInst, stats.MaxBacktrackLen)
+
+	assert.Contains(t, MustCompile(`(\w+)@`).Stats().NotOnePass, "beginning")
+	assert.Contains(t, MustCompile(`^(\w+)@`).Stats().NotOnePass, "end")
+	assert.Contains(t, MustCompile(`^(a*)a$`).Stats().NotOnePass, "next character")
+
+	re := MustCompile(`(\w+)@`)
+	assert.Error(t, re.SetStrategies(OnePass))
+	assert.Error(t, re.SetStrategies(DFA))
+	assert.NoError(t, re.SetStrategies(NFA|DFA))
+	assert.Equal(t, "nfa|dfa", re.Stats().Strategies.String())
+
+	re.SetMaxBacktrackVector(0)
+	assert.Equal(t, 0, re.Stats().MaxBacktrackLen)
+	assert.Equal(t, []int{0, 4, 0, 3}, re.FindStringSubmatchIndex("abc@"))
+
+	assert.True(t, MustCompileExtended(`(a)\k<1>`).Stats().Extended)
+}
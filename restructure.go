@@ -1,9 +1,15 @@
 package restructure
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"regexp/syntax"
+	"runtime"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/alexflint/go-restructure/regex"
 )
@@ -17,12 +23,130 @@ const (
 	CustomStyle
 )
 
+// Anchor selects which ends of the input a match must touch
+type Anchor int
+
+const (
+	AnchorNone  Anchor = iota // matches may begin and end anywhere
+	AnchorStart               // matches must begin at the beginning of the input, as if the struct began with \A
+	AnchorBoth                // matches must span the whole input, as if the struct began with \A and ended with \z
+)
+
 // Options represents optional parameters for compilation
 type Options struct {
 	Style       Style // Style can be set to Perl, POSIX, or CustomStyle
 	SyntaxFlags syntax.Flags
+	MaxSteps    int // MaxSteps limits the work done by each call to Find, FindAll, etc, or 0 for no limit
+
+	// Anchor makes every match begin at the beginning of the input, or
+	// span the whole input, without the struct needing fields such as
+	// _ struct{} `^` for the purpose. Lint reports structs that contain
+	// anchors of their own.
+	Anchor Anchor
+
+	// Longest selects leftmost-longest semantics, in which the longest of
+	// the matches starting at the leftmost position wins. By default the
+	// semantics are leftmost-first, as in Perl and the standard library, so
+	// the match that a backtracking search would find first wins, and the
+	// repetitions in each field are greedy unless marked lazy with *?, +?,
+	// or ?? or with a tag such as `regexp:".*" repeat:"lazy"`. Setting
+	// Style to POSIX implies Longest.
+	Longest bool
+
+	// ExtendedSyntax allows backreferences to earlier fields, written
+	// \k<Field> or \k<Parent.Field>, together with lookahead, lookbehind,
+	// and atomic groups. Patterns that use them are matched by backtracking,
+	// which can be slow, so unless MaxSteps is set each search is limited
+	// to regex.DefaultExtendedMaxSteps steps. Such patterns cannot be used
+	// with FindPartial, Complete, or CompileSet.
+	ExtendedSyntax bool
+
+	// MaxEdits allows matches that differ from the pattern by up to this
+	// many inserted, deleted, or substituted characters, which is useful for
+	// input with typos. Individual fields can be allowed edits instead with
+	// a tag such as `regexp:"\\w+" fuzzy:"1"`. The number of edits made
+	// within each field is recorded in Submatch.Edits. The leftmost match
+	// wins, and among those that begin there the one with the fewest edits.
+	// Approximate matching cannot be combined with ExtendedSyntax, and
+	// cannot be used with FindPartial, Complete, or CompileSet.
+	MaxEdits int
+
+	// Bytes treats each byte of the input as one character, rather than
+	// decoding it as UTF-8, so that . matches any byte and \xNN matches the
+	// byte NN. This allows binary data to be matched, including with fields
+	// of type uint16 and uint32 tagged `endian:"big"` or `endian:"little"`,
+	// which match 2 or 4 bytes holding an integer in that byte order.
+	// Untagged uint16 and uint32 fields are ignored.
+	Bytes bool
+
+	// UnicodeWordBoundaries makes \b and \B treat any Unicode letter,
+	// digit, mark, or connector punctuation as a word character, rather
+	// than only [0-9A-Za-z_]. The classes \w and \W are unchanged.
+	UnicodeWordBoundaries bool
+
+	// CRLF makes ^ and $ in multi-line mode treat \r\n as a single line
+	// ending, so that a field matching (?m:.*$) does not end with the \r.
+	// A lone \r also ends a line.
+	CRLF bool
+
+	// Strategies restricts searches to the given set of strategies, such as
+	// regex.OnePass|regex.NFA, or allows all of them if zero. Compilation
+	// fails if none of them can find submatches for the struct, such as when
+	// only regex.OnePass is allowed and the struct is not onepass, for which
+	// Describe gives the reason. It cannot be combined with ExtendedSyntax or
+	// approximate matching, which have engines of their own.
+	Strategies regex.Strategy
+
+	// ForbidStrategies prevents searches from using the given strategies.
+	ForbidStrategies regex.Strategy
+
+	// MaxBacktrackVector sets the size, in bits, of the largest set of
+	// visited states the backtracker may use, or 0 for the default of 256K.
+	// Inputs longer than this divided by the number of instructions are
+	// searched with the NFA or DFA instead.
+	MaxBacktrackVector int
+
+	// LinePositions makes Submatch, Span, and Match fields keep a reference
+	// to an index of the lines of the input, from which their BeginLinePos
+	// and EndLinePos methods compute line and column numbers on demand.
+	// Fields of type LinePos do not need it.
+	LinePositions bool
+
+	// ChunkSize is the approximate length of the chunks into which
+	// FindAllParallel splits its input, or 0 to choose a size from the
+	// length of the input and the number of workers.
+	ChunkSize int
+
+	// ChunkSeparator, if nonzero, is an ASCII character such as '\n' just
+	// after which every chunk searched by FindAllParallel must begin. If no
+	// field can match it, the chunks are searched without reading past
+	// their ends, which is the fastest way to search a large log file.
+	ChunkSeparator byte
+
+	// Engine compiles and runs the regular expressions, or is nil for
+	// ForkEngine. Setting it to StdlibEngine uses the standard library's
+	// regexp package instead, which supports fewer options.
+	Engine Engine
+}
+
+// longest reports whether the options select leftmost-longest semantics
+func (opts Options) longest() bool {
+	return opts.Longest || opts.Style == POSIX
+}
+
+// strategies returns the strategies that the options allow searches to use
+func (opts Options) strategies() regex.Strategy {
+	strategies := opts.Strategies
+	if strategies == 0 {
+		strategies = regex.AllStrategies
+	}
+	return strategies &^ opts.ForbidStrategies
 }
 
+// ErrBudgetExceeded is returned by FindContext and FindAllContext when a
+// search takes more than Options.MaxSteps steps
+var ErrBudgetExceeded = regex.ErrBudgetExceeded
+
 type subcapture struct {
 	begin, end int
 }
@@ -34,16 +158,42 @@ func (r subcapture) wasMatched() bool {
 type match struct {
 	input    []byte
 	captures []subcapture
+	edits    []int      // edits made within each capture, or nil
+	partial  bool       // match is still in progress, so scalars may not parse yet
+	lines    *LineIndex // index of the lines of input, created on first use
 }
 
 func matchFromIndices(indices []int, input []byte) *match {
-	match := &match{
-		input: input,
+	match := &match{}
+	match.reset(indices, input)
+	return match
+}
+
+// reset overwrites the match with new indices, reusing the capture slice,
+// and the line index if the input is the same
+func (m *match) reset(indices []int, input []byte) {
+	if len(input) != len(m.input) || len(input) > 0 && &input[0] != &m.input[0] {
+		m.lines = nil
 	}
+	m.input = input
+	m.captures = m.captures[:0]
 	for i := 0; i < len(indices); i += 2 {
-		match.captures = append(match.captures, subcapture{indices[i], indices[i+1]})
+		c := subcapture{indices[i], indices[i+1]}
+		if c.begin > c.end {
+			// Only possible for a pattern restored from corrupt data
+			c = subcapture{-1, -1}
+		}
+		m.captures = append(m.captures, c)
 	}
-	return match
+}
+
+// lineIndex returns the index of the lines of the input, creating it if
+// necessary
+func (m *match) lineIndex() *LineIndex {
+	if m.lines == nil {
+		m.lines = NewLineIndex(m.input)
+	}
+	return m.lines
 }
 
 // Pos represents a position within a matched region. If a matched struct contains
@@ -60,6 +210,9 @@ type Submatch struct {
 	Begin Pos
 	End   Pos
 	Bytes []byte
+	Edits int // number of characters inserted, deleted, or substituted to match, if approximate matching is enabled
+
+	lines *LineIndex // index of the lines of the input, if Options.LinePositions is set
 }
 
 // String gets the matched substring
@@ -67,35 +220,129 @@ func (r *Submatch) String() string {
 	return string(r.Bytes)
 }
 
+// BeginLinePos gets the line, column, and character offset of Begin, or the
+// zero LinePos unless Options.LinePositions was set. The lines of the input
+// are indexed on first use, once for all of the submatches found in it.
+func (r *Submatch) BeginLinePos() LinePos {
+	if r.lines == nil {
+		return LinePos{}
+	}
+	return r.lines.LinePos(r.Begin)
+}
+
+// EndLinePos is like BeginLinePos but for End
+func (r *Submatch) EndLinePos() LinePos {
+	if r.lines == nil {
+		return LinePos{}
+	}
+	return r.lines.LinePos(r.End)
+}
+
+// Span records where a struct matched. Embedding a Span in a struct, or
+// adding a field of type Span, makes the struct record the begin and end
+// position and the bytes of its whole match, which is useful for pointing
+// error messages at a nested struct such as `Host *HostName`. A Span in the
+// top-level struct records the whole match.
+type Span struct {
+	Begin Pos
+	End   Pos
+	Bytes []byte
+
+	lines *LineIndex // index of the lines of the input, if Options.LinePositions is set
+}
+
+// String gets the matched substring
+func (s *Span) String() string {
+	return string(s.Bytes)
+}
+
+// BeginLinePos gets the line, column, and character offset of Begin, as
+// Submatch.BeginLinePos does
+func (s *Span) BeginLinePos() LinePos {
+	if s.lines == nil {
+		return LinePos{}
+	}
+	return s.lines.LinePos(s.Begin)
+}
+
+// EndLinePos is like BeginLinePos but for End
+func (s *Span) EndLinePos() LinePos {
+	if s.lines == nil {
+		return LinePos{}
+	}
+	return s.lines.LinePos(s.End)
+}
+
+// Match records the whole match, as a Span in the top-level struct would,
+// together with the text of the input before and after it. A field of type
+// Match can appear anywhere in the struct. After holds only the text that
+// was read beyond the match by FindReader.
+type Match struct {
+	Span
+	Before []byte
+	After  []byte
+}
+
+// EndPos represents the position at which the whole match ends. A field of
+// type EndPos can appear anywhere in the struct, unlike a Pos field, which
+// must come last to record the end of the match.
+type EndPos int
+
 // Regexp is a regular expression that captures submatches into struct fields.
 type Regexp struct {
-	st   *Struct
-	re   *regex.Regexp
-	t    reflect.Type
-	opts Options
+	st    *Struct
+	m     Matcher       // compiled by Options.Engine
+	re    *regex.Regexp // compiled by ForkEngine, or nil if another engine was used
+	t     reflect.Type
+	opts  Options
+	edits map[int]int // edits allowed within fields with fuzzy tags, by capture index
+	fuzzy bool        // approximate matching is enabled
+
+	fullOnce sync.Once
+	full     *Regexp // the same pattern anchored at both ends, for MatchFull
 }
 
 // Find attempts to match the regular expression against the input string. It
 // returns true if there was a match, and also populates the fields of the provided
 // struct with the contents of each submatch.
 func (r *Regexp) Find(dest interface{}, s string) bool {
-	v := reflect.ValueOf(dest)
+	v := r.checkDest(dest)
 	input := []byte(s)
 
-	// Check the type
-	expected := reflect.PtrTo(r.t)
-	if v.Type() != expected {
-		panic(fmt.Errorf("expected destination to be *%s but got %T", r.t.String(), dest))
+	// Execute the regular expression
+	indices := r.m.FindSubmatchIndex(input)
+	if indices == nil {
+		return false
+	}
+
+	// Inflate matches into original struct
+	match := r.newMatch(indices, input)
+
+	err := inflateStruct(v, match, r.st)
+	if err != nil {
+		panic(err)
 	}
+	return true
+}
+
+// FindLast is like Find but finds the last match in s rather than the
+// first. The match that begins furthest to the right is located by scanning
+// backwards from the end of s, and is then extended to the left as far as
+// possible, so that a pattern such as [0-9]+ finds "345" in "12 345" rather
+// than just "5". Patterns that end with a literal suffix or are anchored at
+// the end with $ are located without scanning the rest of s.
+func (r *Regexp) FindLast(dest interface{}, s string) bool {
+	v := r.checkDest(dest)
+	input := []byte(s)
 
 	// Execute the regular expression
-	indices := r.re.FindSubmatchIndex(input)
+	indices := r.fork("FindLast").FindLastSubmatchIndex(input)
 	if indices == nil {
 		return false
 	}
 
 	// Inflate matches into original struct
-	match := matchFromIndices(indices, input)
+	match := r.newMatch(indices, input)
 
 	err := inflateStruct(v, match, r.st)
 	if err != nil {
@@ -104,55 +351,486 @@ func (r *Regexp) Find(dest interface{}, s string) bool {
 	return true
 }
 
-// FindAll attempts to match the regular expression against the input string. It returns true
-// if there was at least one match.
-func (r *Regexp) FindAll(dest interface{}, s string, limit int) {
-	// Check the type
+// FindAt is like Find but only finds a match that begins at or after offset
+// bytes into s. Unlike calling Find on s[offset:], the text before offset is
+// still examined by ^, \b and other assertions, so a pattern beginning with
+// \b does not match in the middle of a word. Positions recorded in dest are
+// relative to the beginning of s. FindAt is only supported by ForkEngine.
+func (r *Regexp) FindAt(dest interface{}, s string, offset int) bool {
+	v := r.checkDest(dest)
+	input := []byte(s)
+
+	// Execute the regular expression
+	indices := r.fork("FindAt").FindSubmatchIndexAt(input, offset)
+	if indices == nil {
+		return false
+	}
+
+	// Inflate matches into original struct
+	match := r.newMatch(indices, input)
+
+	err := inflateStruct(v, match, r.st)
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// Consume matches the regular expression against the beginning of s, as if
+// it began with \A, and returns the rest of s after the match, so that
+// input made of a sequence of structs can be parsed by calling Consume
+// repeatedly. It returns false and leaves dest unchanged if there is no
+// match at the beginning of s. ForkEngine only runs the match from the
+// beginning of s, while other engines search all of s and discard a match
+// elsewhere.
+func (r *Regexp) Consume(dest interface{}, s string) (rest string, ok bool) {
+	v := r.checkDest(dest)
+	input := []byte(s)
+
+	// Execute the regular expression
+	var indices []int
+	if r.re != nil {
+		indices = r.re.FindPrefixSubmatchIndexAt(input, 0)
+	} else {
+		indices = r.m.FindSubmatchIndex(input)
+	}
+	if indices == nil || indices[0] != 0 {
+		return s, false
+	}
+
+	// Inflate matches into original struct
+	match := r.newMatch(indices, input)
+
+	err := inflateStruct(v, match, r.st)
+	if err != nil {
+		panic(err)
+	}
+	return s[indices[1]:], true
+}
+
+// MatchFull is like Find but only matches if the whole of s matches the
+// struct, as if Options.Anchor were AnchorBoth. Unless it was, the first
+// call compiles the anchored pattern, which is kept for later calls.
+func (r *Regexp) MatchFull(dest interface{}, s string) bool {
+	if r.opts.Anchor == AnchorBoth {
+		return r.Find(dest, s)
+	}
+	r.fullOnce.Do(func() {
+		opts := r.opts
+		opts.Anchor = AnchorBoth
+		r.full = MustCompileType(r.t, opts)
+	})
+	return r.full.Find(dest, s)
+}
+
+// newMatch creates a match from the indices of a match of this regular
+// expression in input
+func (r *Regexp) newMatch(indices []int, input []byte) *match {
+	match := &match{}
+	r.resetMatch(match, indices, input)
+	return match
+}
+
+// resetMatch overwrites match with the indices of a match of this regular
+// expression in input. If approximate matching is enabled then the indices
+// are followed by the edits made within each capture, which are recorded
+// too.
+func (r *Regexp) resetMatch(match *match, indices []int, input []byte) {
+	match.edits = nil
+	if r.fuzzy {
+		match.edits = r.re.SubmatchEdits(indices)
+		indices = indices[:len(indices)-len(match.edits)]
+	}
+	match.reset(indices, input)
+}
+
+// checkDest checks that dest is a pointer to the struct type for this
+// regular expression and returns it as a reflect.Value.
+func (r *Regexp) checkDest(dest interface{}) reflect.Value {
+	v := reflect.ValueOf(dest)
+	expected := reflect.PtrTo(r.t)
+	if v.Type() != expected {
+		panic(fmt.Errorf("expected destination to be *%s but got %T", r.t.String(), dest))
+	}
+	return v
+}
+
+// checkSliceDest checks that dest is a pointer to a slice of T or *T, where
+// T is the struct type for this regular expression. It returns the slice
+// value and the type of its elements.
+func (r *Regexp) checkSliceDest(dest interface{}, method string) (reflect.Value, reflect.Type) {
 	v := reflect.ValueOf(dest)
 	t := v.Type()
 	if t.Kind() != reflect.Ptr {
-		panic(fmt.Errorf("parameter to FindAll should be a pointer to a slice but got %T", dest))
+		panic(fmt.Errorf("parameter to %s should be a pointer to a slice but got %T", method, dest))
 	}
 
 	sliceType := t.Elem()
 	if sliceType.Kind() != reflect.Slice {
-		panic(fmt.Errorf("parameter to FindAll should be a pointer to a slice but got %T", dest))
+		panic(fmt.Errorf("parameter to %s should be a pointer to a slice but got %T", method, dest))
 	}
 
 	itemType := sliceType.Elem()
 	if itemType != r.t && itemType != reflect.PtrTo(r.t) {
 		panic(fmt.Errorf("expected the slice element to be %s or *%s but it was %s", r.t, r.t, t))
 	}
+	return v.Elem(), itemType
+}
+
+// FindAll attempts to match the regular expression against the input string. It returns true
+// if there was at least one match.
+func (r *Regexp) FindAll(dest interface{}, s string, limit int) {
+	// Check the type
+	slice, itemType := r.checkSliceDest(dest, "FindAll")
+
+	// Execute the regular expression
+	input := []byte(s)
+	matches := r.m.FindAllSubmatchIndex(input, limit)
+	r.inflateAll(slice, itemType, matches, input)
+}
+
+// FindAllParallel is like FindAll but splits s into chunks that are searched
+// concurrently by up to workers goroutines, or runtime.GOMAXPROCS(0) if
+// workers is zero, which is useful for inputs of many megabytes. The matches
+// are the same, and in the same order, as those found by FindAll. The chunks
+// are chosen by Options.ChunkSize and Options.ChunkSeparator. If a match
+// straddles the boundary between two chunks then the search of the first
+// continues past its end to find it, and the search of the second is
+// repeated from the end of the match where necessary, so no match is lost
+// or found twice. Other engines than ForkEngine, and searches limited by
+// MaxSteps, search the whole of s in one goroutine.
+func (r *Regexp) FindAllParallel(dest interface{}, s string, workers int) {
+	// Check the type
+	slice, itemType := r.checkSliceDest(dest, "FindAllParallel")
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
 
 	// Execute the regular expression
 	input := []byte(s)
-	matches := r.re.FindAllSubmatchIndex(input, limit)
+	var matches [][]int
+	if r.re != nil {
+		matches = r.re.FindAllSubmatchIndexParallel(input, -1, regex.ParallelOptions{
+			Workers:   workers,
+			ChunkSize: r.opts.ChunkSize,
+			Separator: r.opts.ChunkSeparator,
+		})
+	} else {
+		matches = r.m.FindAllSubmatchIndex(input, -1)
+	}
 
+	// Inflate the matches in parallel too, passing any panic on to the
+	// caller as FindAll would
+	slice.Set(reflect.MakeSlice(slice.Type(), len(matches), len(matches)))
+	per := (len(matches) + workers - 1) / workers
+	panics := make(chan interface{}, workers)
+	var wg sync.WaitGroup
+	for lo := 0; lo < len(matches); lo += per {
+		hi := lo + per
+		if hi > len(matches) {
+			hi = len(matches)
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			defer func() {
+				if p := recover(); p != nil {
+					panics <- p
+				}
+			}()
+			r.inflateRange(slice, itemType, matches, input, lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+	close(panics)
+	if p, ok := <-panics; ok {
+		panic(p)
+	}
+}
+
+// inflateAll sets slice to a new slice holding one element per match,
+// populated from the corresponding indices.
+func (r *Regexp) inflateAll(slice reflect.Value, itemType reflect.Type, matches [][]int, input []byte) {
 	// Allocate a slice with the desired length
-	v.Elem().Set(reflect.MakeSlice(sliceType, len(matches), len(matches)))
+	slice.Set(reflect.MakeSlice(slice.Type(), len(matches), len(matches)))
+	r.inflateRange(slice, itemType, matches, input, 0, len(matches))
+}
+
+// inflateRange populates the elements of slice from lo to hi from the
+// corresponding matches.
+func (r *Regexp) inflateRange(slice reflect.Value, itemType reflect.Type, matches [][]int, input []byte, lo, hi int) {
+	var match match
+	for i := lo; i < hi; i++ {
+		indices := matches[i]
 
-	// Inflate the matches into the slice elements
-	for i, indices := range matches {
 		// Get the i-th element of the slice
-		destItem := v.Elem().Index(i)
+		destItem := slice.Index(i)
 		if itemType.Kind() != reflect.Ptr {
 			destItem = destItem.Addr()
 		}
 
-		// Create the match object
-		match := matchFromIndices(indices, input)
+		// Reset the match object, which shares one line index for the
+		// whole input
+		r.resetMatch(&match, indices, input)
 
 		// Inflate the match into the dest item
-		err := inflateStruct(destItem, match, r.st)
+		err := inflateStruct(destItem, &match, r.st)
 		if err != nil {
 			panic(err)
 		}
 	}
 }
 
+// AppendAll is like FindAll but appends the matches to the slice pointed to by
+// dest rather than replacing it. Existing capacity in the slice is reused, and
+// for slices of pointers, any structs already pointed to by the spare capacity
+// are zeroed and reused rather than reallocated. It returns the number of
+// matches that were appended.
+func (r *Regexp) AppendAll(dest interface{}, s string, limit int) int {
+	// Check the type
+	slice, itemType := r.checkSliceDest(dest, "AppendAll")
+
+	// Execute the regular expression, reusing one index slice and one match
+	input := []byte(s)
+	var match match
+	var count int
+	r.each(input, limit, func(indices []int) bool {
+		// Grow the slice by one, within the existing capacity if possible
+		n := slice.Len()
+		if n < slice.Cap() {
+			slice.SetLen(n + 1)
+		} else {
+			slice.Set(reflect.Append(slice, reflect.Zero(itemType)))
+		}
+
+		// Get the new element, clearing anything left over in it
+		destItem := r.clearItem(slice, itemType, n)
+
+		// Inflate the match into the dest item
+		r.resetMatch(&match, indices, input)
+		if err := inflateStruct(destItem, &match, r.st); err != nil {
+			panic(err)
+		}
+		count++
+		return true
+	})
+	return count
+}
+
+// clearItem zeroes the i-th element of slice, or for a slice of pointers the
+// struct that it points to if any, so that the struct can be reused. It
+// returns a pointer to the element for inflateStruct.
+func (r *Regexp) clearItem(slice reflect.Value, itemType reflect.Type, i int) reflect.Value {
+	destItem := slice.Index(i)
+	if itemType.Kind() == reflect.Ptr {
+		if !destItem.IsNil() {
+			destItem.Elem().Set(reflect.Zero(r.t))
+		}
+		return destItem
+	}
+	destItem.Set(reflect.Zero(r.t))
+	return destItem.Addr()
+}
+
+// FindEach finds successive matches of the regular expression in the input
+// string. For each match it zeroes the struct pointed to by dest, populates
+// it with the contents of the match, and then calls fn with dest. The same
+// struct is reused for every match, so fn must copy anything it wants to
+// keep. The search stops early if fn returns false.
+func (r *Regexp) FindEach(dest interface{}, s string, fn func(dest interface{}) bool) {
+	v := reflect.ValueOf(dest)
+
+	// Check the type
+	expected := reflect.PtrTo(r.t)
+	if v.Type() != expected {
+		panic(fmt.Errorf("expected destination to be *%s but got %T", r.t.String(), dest))
+	}
+
+	// Execute the regular expression, reusing one index slice and one match
+	input := []byte(s)
+	var match match
+	r.each(input, -1, func(indices []int) bool {
+		v.Elem().Set(reflect.Zero(r.t))
+		r.resetMatch(&match, indices, input)
+		if err := inflateStruct(v, &match, r.st); err != nil {
+			panic(err)
+		}
+		return fn(dest)
+	})
+}
+
+// each calls fn with the indices of successive matches in input, like
+// regex.Regexp.EachSubmatchIndex, using any engine
+func (r *Regexp) each(input []byte, limit int, fn func(indices []int) bool) {
+	if r.re != nil {
+		r.re.EachSubmatchIndex(input, limit, fn)
+		return
+	}
+	for _, indices := range r.m.FindAllSubmatchIndex(input, limit) {
+		if !fn(indices) {
+			return
+		}
+	}
+}
+
+// fork returns the regular expression compiled by ForkEngine, and panics if
+// another engine was used, since method is only supported by ForkEngine
+func (r *Regexp) fork(method string) *regex.Regexp {
+	if r.re == nil {
+		panic(fmt.Errorf("%s is only supported by ForkEngine", method))
+	}
+	return r.re
+}
+
+// FindReader is like Find but reads the input from rr, which it reads no
+// further than needed to find the first match. The text of the match is
+// kept so that it can be inflated into dest. Bytes that are not valid UTF-8
+// are kept as they were only if rr is also an io.RuneScanner and an
+// io.ByteReader, as strings.Reader, bytes.Reader and bufio.Reader are, and
+// are otherwise kept as 0xff.
+func (r *Regexp) FindReader(dest interface{}, rr io.RuneReader) bool {
+	v := r.checkDest(dest)
+	rec := recordingReader{r: rr}
+
+	// Execute the regular expression
+	indices := r.m.FindReaderSubmatchIndex(&rec)
+	if indices == nil {
+		return false
+	}
+
+	// Inflate matches into original struct
+	match := r.newMatch(indices, rec.buf)
+
+	err := inflateStruct(v, match, r.st)
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// recordingReader keeps a copy of the text read from a RuneReader
+type recordingReader struct {
+	r   io.RuneReader
+	buf []byte
+}
+
+func (rec *recordingReader) ReadRune() (rune, int, error) {
+	ch, size, err := rec.r.ReadRune()
+	if size > 0 {
+		if utf8.RuneLen(ch) == size {
+			rec.buf = append(rec.buf, string(ch)...)
+		} else {
+			// Invalid UTF-8, which is read one byte at a time
+			rec.buf = append(rec.buf, rec.invalidByte())
+		}
+	}
+	return ch, size, err
+}
+
+// invalidByte returns the byte that the last call to ReadRune decoded as
+// utf8.RuneError, by reading it again, or 0xff if the reader cannot do so
+func (rec *recordingReader) invalidByte() byte {
+	rs, ok := rec.r.(io.RuneScanner)
+	if !ok {
+		return 0xff
+	}
+	br, ok := rec.r.(io.ByteReader)
+	if !ok || rs.UnreadRune() != nil {
+		return 0xff
+	}
+	c, err := br.ReadByte()
+	if err != nil {
+		// Cannot happen, since the byte was just unread
+		return 0xff
+	}
+	return c
+}
+
+// FindContext is like Find but stops early if ctx is done or the search
+// takes more than Options.MaxSteps steps, in which case it returns the error
+// from ctx or ErrBudgetExceeded and leaves dest unchanged.
+func (r *Regexp) FindContext(ctx context.Context, dest interface{}, s string) (bool, error) {
+	v := r.checkDest(dest)
+	input := []byte(s)
+
+	// Execute the regular expression
+	var indices []int
+	var err error
+	if r.re != nil {
+		indices, err = r.re.FindSubmatchIndexContext(ctx, input)
+	} else if err = ctx.Err(); err == nil {
+		indices = r.m.FindSubmatchIndex(input)
+	}
+	if err != nil {
+		return false, err
+	}
+	if indices == nil {
+		return false, nil
+	}
+
+	// Inflate matches into original struct
+	match := r.newMatch(indices, input)
+
+	err = inflateStruct(v, match, r.st)
+	if err != nil {
+		panic(err)
+	}
+	return true, nil
+}
+
+// FindAllContext is like FindAll but stops early if ctx is done or the
+// search takes more than Options.MaxSteps steps, in which case it returns the
+// error from ctx or ErrBudgetExceeded. The matches found before the search
+// stopped are still placed in dest.
+func (r *Regexp) FindAllContext(ctx context.Context, dest interface{}, s string, limit int) error {
+	// Check the type
+	slice, itemType := r.checkSliceDest(dest, "FindAllContext")
+
+	// Execute the regular expression, copying each match since the index
+	// slice is reused
+	input := []byte(s)
+	var matches [][]int
+	collect := func(indices []int) bool {
+		matches = append(matches, append([]int(nil), indices...))
+		return true
+	}
+	var err error
+	if r.re != nil {
+		err = r.re.EachSubmatchIndexContext(ctx, input, limit, collect)
+	} else if err = ctx.Err(); err == nil {
+		r.each(input, limit, collect)
+	}
+	r.inflateAll(slice, itemType, matches, input)
+	return err
+}
+
 // String returns a string representation of the regular expression
 func (r *Regexp) String() string {
-	return r.re.String()
+	return r.m.String()
+}
+
+// Describe returns a description of how the regular expression compiled
+// for the struct is matched: its size, whether it can use the fast onepass
+// strategy and if not why, its literal prefix, and the strategies that
+// searches may use. It is intended to be read by people, and its format may
+// change.
+func (r *Regexp) Describe() string {
+	if r.re == nil {
+		return fmt.Sprintf("pattern: %s\nengine: %T\n", r.m, r.opts.Engine)
+	}
+	return "pattern: " + r.re.String() + "\n" + r.re.Stats().String()
+}
+
+// Lint returns warnings about parts of the struct that are likely to be
+// mistakes, such as fields that anchor the struct with ^ or $ at the top
+// level, which Options.Anchor does more reliably. It returns nil if there
+// are none.
+func (r *Regexp) Lint() []string {
+	_, expr, err := newBuilder(r.opts).structure(r.t)
+	if err != nil {
+		return nil
+	}
+	return lint(r.t, expr, r.opts.Anchor)
 }
 
 // Compile constructs a regular expression from the struct fields on the
@@ -163,6 +841,68 @@ func Compile(proto interface{}, opts Options) (*Regexp, error) {
 
 // CompileType is like Compile but takes a reflect.Type instead.
 func CompileType(t reflect.Type, opts Options) (*Regexp, error) {
+	r, expr, err := build(t, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compile regular expression
+	if err := checkEngine(opts, opts.MaxEdits > 0 || len(r.edits) > 0); err != nil {
+		return nil, err
+	}
+	engine := opts.Engine
+	if engine == nil {
+		engine = ForkEngine
+	}
+	r.m, err = engine.Compile(expr, opts.longest())
+	if err != nil {
+		return nil, err
+	}
+	var ok bool
+	if r.re, ok = r.m.(*regex.Regexp); !ok {
+		return r, nil
+	}
+	r.re.SetMaxSteps(opts.MaxSteps)
+	if opts.Bytes {
+		r.re.ByteMode()
+	}
+	if opts.UnicodeWordBoundaries {
+		r.re.UnicodeWordBoundaries()
+	}
+	if opts.CRLF {
+		r.re.CRLFLineEndings()
+	}
+
+	// Allow edits in approximate matches
+	if opts.MaxEdits > 0 || len(r.edits) > 0 {
+		if opts.ExtendedSyntax {
+			return nil, errors.New("approximate matching cannot be combined with ExtendedSyntax")
+		}
+		r.re.SetMaxEdits(opts.MaxEdits)
+		for k, n := range r.edits {
+			r.re.SetGroupMaxEdits(k, n)
+		}
+		r.fuzzy = true
+	}
+
+	// Restrict the strategies used for searching
+	if opts.Strategies != 0 || opts.ForbidStrategies != 0 || opts.MaxBacktrackVector != 0 {
+		if opts.ExtendedSyntax || r.fuzzy {
+			return nil, errors.New("strategies cannot be selected with ExtendedSyntax or approximate matching")
+		}
+		if err := r.re.SetStrategies(opts.strategies()); err != nil {
+			return nil, err
+		}
+		if opts.MaxBacktrackVector != 0 {
+			r.re.SetMaxBacktrackVector(opts.MaxBacktrackVector)
+		}
+	}
+	return r, nil
+}
+
+// build traverses the struct type t and returns a Regexp for it, without
+// the compiled regular expression, together with the syntax tree to compile.
+func build(t reflect.Type, opts Options) (*Regexp, *syntax.Regexp, error) {
 	// We do this so that the zero value for Options gives us Perl mode,
 	// which is also the default used by the standard library regexp package
 	switch opts.Style {
@@ -180,22 +920,16 @@ func CompileType(t reflect.Type, opts Options) (*Regexp, error) {
 	b := newBuilder(opts)
 	st, expr, err := b.structure(t)
 	if err != nil {
-		return nil, err
-	}
-
-	// Compile regular expression
-	re, err := regex.CompileSyntax(expr)
-	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	expr = anchor(expr, opts.Anchor)
 
-	// Return
 	return &Regexp{
-		st:   st,
-		re:   re,
-		t:    t,
-		opts: opts,
-	}, nil
+		st:    st,
+		t:     t,
+		opts:  opts,
+		edits: b.edits,
+	}, expr, nil
 }
 
 // MustCompile is like Compile but panics if there is a compilation error
@@ -1,7 +1,11 @@
 package restructure
 
 import (
+	"context"
 	"encoding/json"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -324,3 +328,177 @@ func TestMatchWithInt(t *testing.T) {
 	assert.Equal(t, 4, v.Number)
 	assert.Equal(t, "wombats", v.Animal)
 }
+
+func TestAppendAllWords(t *testing.T) {
+	pattern := MustCompile(Word{}, Options{})
+	words := []Word{{S: "first"}}
+	n := pattern.AppendAll(&words, "ham is spam", -1)
+	assert.Equal(t, 3, n)
+	require.Len(t, words, 4)
+	assert.EqualValues(t, "first", words[0].S)
+	assert.EqualValues(t, "ham", words[1].S)
+	assert.EqualValues(t, "is", words[2].S)
+	assert.EqualValues(t, "spam", words[3].S)
+}
+
+func TestAppendAllWords_ReusesCapacity(t *testing.T) {
+	pattern := MustCompile(Word{}, Options{})
+	words := make([]*Word, 0, 8)
+	pattern.AppendAll(&words, "ham is spam", -1)
+	require.Len(t, words, 3)
+	first := words[0]
+
+	words = words[:0]
+	pattern.AppendAll(&words, "eggs", -1)
+	require.Len(t, words, 1)
+	assert.True(t, first == words[0])
+	assert.EqualValues(t, "eggs", words[0].S)
+}
+
+func TestAppendAllWords_Limit(t *testing.T) {
+	pattern := MustCompile(Word{}, Options{})
+	var words []Word
+	n := pattern.AppendAll(&words, "ham is spam", 2)
+	assert.Equal(t, 2, n)
+	require.Len(t, words, 2)
+	assert.EqualValues(t, "is", words[1].S)
+}
+
+func TestAppendAll_ClearsReusedStructs(t *testing.T) {
+	pattern := MustCompile(DotExpr{}, Options{})
+	exprs := []DotExpr{{Head: "stale", Tail: &DotName{Name: "stale"}}}
+	exprs = exprs[:0]
+	pattern.AppendAll(&exprs, "foo", -1)
+	require.Len(t, exprs, 1)
+	assert.Equal(t, "foo", exprs[0].Head)
+	assert.Nil(t, exprs[0].Tail)
+}
+
+func TestFindEachWords(t *testing.T) {
+	pattern := MustCompile(WordSubmatch{}, Options{})
+	var w WordSubmatch
+	var got []string
+	var begins []Pos
+	pattern.FindEach(&w, "ham is spam", func(dest interface{}) bool {
+		match := dest.(*WordSubmatch)
+		assert.True(t, match == &w)
+		got = append(got, match.S.String())
+		begins = append(begins, match.S.Begin)
+		return true
+	})
+	assert.Equal(t, []string{"ham", "is", "spam"}, got)
+	assert.Equal(t, []Pos{0, 4, 7}, begins)
+}
+
+func TestFindEachWords_Stop(t *testing.T) {
+	pattern := MustCompile(Word{}, Options{})
+	var w Word
+	var got []string
+	pattern.FindEach(&w, "ham is spam", func(dest interface{}) bool {
+		got = append(got, dest.(*Word).S)
+		return len(got) < 2
+	})
+	assert.Equal(t, []string{"ham", "is"}, got)
+}
+
+func TestFindLastWord(t *testing.T) {
+	pattern := MustCompile(WordSubmatch{}, Options{})
+	var w WordSubmatch
+	require.True(t, pattern.FindLast(&w, "ham is spam!"))
+	assertRegion(t, "spam", 7, 11, w.S)
+}
+
+func TestFindLastNumber(t *testing.T) {
+	pattern := MustCompile(ExprWithInt{}, Options{})
+	var v ExprWithInt
+	require.True(t, pattern.FindLast(&v, "12 wombats"))
+	assert.Equal(t, 12, v.Number)
+	assert.Equal(t, "wombats", v.Animal)
+	assert.False(t, pattern.FindLast(&v, "wombats"))
+}
+
+func TestFindContext(t *testing.T) {
+	pattern := MustCompile(Word{}, Options{})
+	var w Word
+	ok, err := pattern.FindContext(context.Background(), &w, "ham is spam")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "ham", w.S)
+
+	ok, err = pattern.FindContext(context.Background(), &w, "!!")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestFindContext_Canceled(t *testing.T) {
+	pattern := MustCompile(Word{}, Options{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var w Word
+	_, err := pattern.FindContext(ctx, &w, "ham is spam")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestFindContext_MaxSteps(t *testing.T) {
+	pattern := MustCompile(Word{}, Options{MaxSteps: 100})
+	var w Word
+
+	// short inputs are searched by the backtracker
+	_, err := pattern.FindContext(context.Background(), &w, strings.Repeat(" ", 200)+"ham")
+	assert.Equal(t, ErrBudgetExceeded, err)
+
+	// long inputs are searched by the DFA and then the NFA
+	_, err = pattern.FindContext(context.Background(), &w, strings.Repeat(" ", 20000)+"ham")
+	assert.Equal(t, ErrBudgetExceeded, err)
+
+	// plain Find reports no match when the budget runs out
+	assert.False(t, pattern.Find(&w, strings.Repeat(" ", 200)+"ham"))
+	assert.True(t, pattern.Find(&w, "ham"))
+}
+
+func TestFindAllContext_MaxSteps(t *testing.T) {
+	pattern := MustCompile(Word{}, Options{MaxSteps: 1000})
+	var words []Word
+	err := pattern.FindAllContext(context.Background(), &words, strings.Repeat("ham ", 1000), -1)
+	assert.Equal(t, ErrBudgetExceeded, err)
+	assert.NotEmpty(t, words)
+	assert.True(t, len(words) < 1000)
+	for _, w := range words {
+		assert.Equal(t, "ham", w.S)
+	}
+
+	err = pattern.FindAllContext(context.Background(), &words, "ham is spam", -1)
+	require.NoError(t, err)
+	assert.Len(t, words, 3)
+}
+
+func TestFind_Concurrent(t *testing.T) {
+	pattern := MustCompile(DotExpr{}, Options{})
+	inputs := []string{"foo.bar", "foo", strings.Repeat("x", 100000) + ".y", "foo.bar.baz"}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				// collect garbage now and then so that machines are
+				// released from the pool and reallocated
+				if j%10 == 0 {
+					runtime.GC()
+				}
+
+				var v DotExpr
+				input := inputs[(i+j)%len(inputs)]
+				found := pattern.Find(&v, input)
+				if input == "foo.bar.baz" {
+					assert.False(t, found)
+				} else if assert.True(t, found) && v.Tail != nil {
+					assert.Equal(t, input, v.Head+v.Tail.Dot+v.Tail.Name)
+				} else {
+					assert.Equal(t, input, v.Head)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
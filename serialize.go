@@ -0,0 +1,371 @@
+package restructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp/syntax"
+	"strconv"
+
+	"github.com/alexflint/go-restructure/regex"
+)
+
+// serialMagic begins the data written by MarshalBinary. Its last byte is
+// the version of the format.
+const serialMagic = "rst\x03"
+
+var errSerialFormat = errors.New("data was not encoded by this version of MarshalBinary")
+
+// An encoder appends values to a buffer as varints and length-prefixed
+// byte strings
+type encoder struct {
+	buf []byte
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) int(v int) {
+	n := binary.PutVarint(e.tmp[:], int64(v))
+	e.buf = append(e.buf, e.tmp[:n]...)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.int(1)
+	} else {
+		e.int(0)
+	}
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int(len(b))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) options(opts Options) {
+	e.int(int(opts.Style))
+	e.int(int(opts.SyntaxFlags))
+	e.int(opts.MaxSteps)
+	e.int(int(opts.Anchor))
+	e.bool(opts.Longest)
+	e.bool(opts.ExtendedSyntax)
+	e.int(opts.MaxEdits)
+	e.bool(opts.Bytes)
+	e.bool(opts.UnicodeWordBoundaries)
+	e.bool(opts.CRLF)
+	e.int(int(opts.Strategies))
+	e.int(int(opts.ForbidStrategies))
+	e.int(opts.MaxBacktrackVector)
+	e.bool(opts.LinePositions)
+	e.int(opts.ChunkSize)
+	e.int(int(opts.ChunkSeparator))
+}
+
+func (e *encoder) structure(st *Struct) {
+	e.int(st.capture)
+	e.int(len(st.fields))
+	for _, field := range st.fields {
+		e.int(field.capture)
+		e.int(len(field.index))
+		for _, i := range field.index {
+			e.int(i)
+		}
+		e.int(int(field.role))
+		e.bool(field.order == binary.BigEndian)
+		e.bool(field.lines)
+		e.bool(field.child != nil)
+		if field.child != nil {
+			e.structure(field.child)
+		}
+	}
+}
+
+// A decoder reads the values appended by an encoder. After the first error
+// every method returns a zero value.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) int() int {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.buf, d.err = nil, errSerialFormat
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return int(v)
+}
+
+// len reads the length of a list, each element of which takes at least one
+// byte, so that corrupt data cannot cause a huge allocation
+func (d *decoder) len() int {
+	n := d.int()
+	if n < 0 || n > len(d.buf) {
+		d.buf, d.err = nil, errSerialFormat
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bool() bool {
+	return d.int() != 0
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.len()
+	b := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) options() Options {
+	return Options{
+		Style:                 Style(d.int()),
+		SyntaxFlags:           syntax.Flags(d.int()),
+		MaxSteps:              d.int(),
+		Anchor:                Anchor(d.int()),
+		Longest:               d.bool(),
+		ExtendedSyntax:        d.bool(),
+		MaxEdits:              d.int(),
+		Bytes:                 d.bool(),
+		UnicodeWordBoundaries: d.bool(),
+		CRLF:                  d.bool(),
+		Strategies:            regex.Strategy(d.int()),
+		ForbidStrategies:      regex.Strategy(d.int()),
+		MaxBacktrackVector:    d.int(),
+		LinePositions:         d.bool(),
+		ChunkSize:             d.int(),
+		ChunkSeparator:        byte(d.int()),
+	}
+}
+
+func (d *decoder) structure() *Struct {
+	st := &Struct{capture: d.int()}
+	n := d.len()
+	for i := 0; i < n && d.err == nil; i++ {
+		field := &Field{capture: d.int()}
+		field.index = make([]int, d.len())
+		for j := range field.index {
+			field.index[j] = d.int()
+		}
+		field.role = Role(d.int())
+		switch {
+		case d.bool():
+			field.order = binary.BigEndian
+		case field.role == Uint16Role || field.role == Uint32Role:
+			field.order = binary.LittleEndian
+		}
+		field.lines = d.bool()
+		if d.bool() {
+			field.child = d.structure()
+		}
+		st.fields = append(st.fields, field)
+	}
+	return st
+}
+
+// typeHash returns a hash of the names, types, and tags of the fields of
+// the struct type t, and of the struct types it contains, which changes
+// whenever a change to t could change the pattern compiled for it
+func typeHash(t reflect.Type) uint64 {
+	h := typeHasher{sum: fnvOffset, seen: make(map[reflect.Type]bool)}
+	h.add(t)
+	return h.sum
+}
+
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+// typeHasher computes the 64-bit FNV-1a hash of a description of a type
+type typeHasher struct {
+	sum  uint64
+	seen map[reflect.Type]bool
+}
+
+// string adds s, followed by a separator, to the hash
+func (h *typeHasher) string(s string) {
+	for i := 0; i < len(s); i++ {
+		h.sum = (h.sum ^ uint64(s[i])) * fnvPrime
+	}
+	h.sum = (h.sum ^ 0xff) * fnvPrime
+}
+
+func (h *typeHasher) add(t reflect.Type) {
+	h.string(t.PkgPath())
+	h.string(t.Name())
+	h.string(t.Kind().String())
+	if h.seen[t] {
+		return
+	}
+	h.seen[t] = true
+	switch t.Kind() {
+	case reflect.Array:
+		h.string(strconv.Itoa(t.Len()))
+		h.add(t.Elem())
+	case reflect.Ptr, reflect.Slice:
+		h.add(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			h.string(f.Name)
+			h.string(string(f.Tag))
+			h.add(f.Type)
+		}
+		h.string("}")
+	}
+}
+
+// MarshalBinary encodes the compiled pattern, including the mapping from its
+// captures to the fields of the struct, so that LoadType can restore it
+// without walking the struct or compiling the pattern again. A program that
+// compiles many patterns at startup can instead generate the data ahead of
+// time, embed it with go:embed, and load it. Patterns compiled by engines
+// other than ForkEngine, and patterns that use ExtendedSyntax or approximate
+// matching, cannot be encoded.
+func (r *Regexp) MarshalBinary() ([]byte, error) {
+	if r.re == nil {
+		return nil, errors.New("only patterns compiled by ForkEngine can be marshaled")
+	}
+	re, err := r.re.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	e := &encoder{buf: []byte(serialMagic)}
+	e.bytes([]byte(r.t.String()))
+	e.int(int(typeHash(r.t)))
+	e.options(r.opts)
+	e.structure(r.st)
+	e.bytes(re)
+	return e.buf, nil
+}
+
+// Load restores a pattern encoded by MarshalBinary for the struct type of
+// proto. It returns an error if the struct type has changed since the
+// pattern was encoded, in which case the data must be generated again, or
+// if the data does not describe a pattern for the struct type. Data that has
+// been tampered with can still load and then match different text, so it
+// should come from a trusted source, such as a file embedded in the program.
+func Load(proto interface{}, data []byte) (*Regexp, error) {
+	return LoadType(reflect.TypeOf(proto), data)
+}
+
+// LoadType is like Load but takes a reflect.Type instead.
+func LoadType(t reflect.Type, data []byte) (*Regexp, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if !bytes.HasPrefix(data, []byte(serialMagic)) {
+		return nil, errSerialFormat
+	}
+	d := &decoder{buf: data[len(serialMagic):]}
+	name := string(d.bytes())
+	hash := uint64(d.int())
+	if d.err != nil {
+		return nil, d.err
+	}
+	if name != t.String() {
+		return nil, fmt.Errorf("pattern was compiled for %s, not %s", name, t)
+	}
+	if hash != typeHash(t) {
+		return nil, fmt.Errorf("%s has changed since the pattern was compiled", t)
+	}
+
+	r := &Regexp{
+		t:    t,
+		opts: d.options(),
+		st:   d.structure(),
+	}
+	data = d.bytes()
+	if d.err != nil || len(d.buf) != 0 {
+		return nil, errSerialFormat
+	}
+	r.re = new(regex.Regexp)
+	if err := r.re.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	if !validStruct(t, r.st, r.re.NumSubexp()+1) {
+		return nil, errSerialFormat
+	}
+	r.m = r.re
+	return r, nil
+}
+
+// roleTypes gives the type of the fields that can have each role, other than
+// SubstructRole, ignoring pointers to scalars
+var roleTypes = map[Role]reflect.Type{
+	EmptyRole:           emptyType,
+	PosRole:             posType,
+	StringScalarRole:    stringType,
+	IntScalarRole:       intType,
+	ByteSliceScalarRole: byteSliceType,
+	SubmatchScalarRole:  submatchType,
+	Uint16Role:          uint16Type,
+	Uint32Role:          uint32Type,
+	SpanRole:            spanType,
+	LinePosRole:         linePosType,
+	MatchRole:           matchType,
+	EndPosRole:          endPosType,
+}
+
+// validStruct reports whether the decoded struct st fits the struct type t
+// and a pattern with ncap captures, so that inflating a match into t cannot
+// panic: each field exists and has a type matching its role, and each
+// capture that is read is in range.
+func validStruct(t reflect.Type, st *Struct, ncap int) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || st.capture < 0 || st.capture >= ncap {
+		return false
+	}
+	for _, field := range st.fields {
+		if len(field.index) != 1 || field.index[0] < 0 || field.index[0] >= t.NumField() {
+			return false
+		}
+		f := t.Field(field.index[0])
+		if field.capture < -1 || field.capture >= ncap {
+			return false
+		}
+		switch field.role {
+		case SpanRole, MatchRole, EndPosRole, SubstructRole:
+			// These are inflated whether or not they have a capture
+			if field.capture == -1 {
+				return false
+			}
+		}
+		if field.capture != -1 && field.role != EmptyRole && !isExported(f) {
+			return false
+		}
+		if field.role == SubstructRole {
+			if field.child == nil || !validStruct(f.Type, field.child, ncap) {
+				return false
+			}
+			continue
+		}
+		want, ok := roleTypes[field.role]
+		if !ok || field.child != nil {
+			return false
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr && isScalar(ft) {
+			ft = ft.Elem()
+		}
+		if ft != want {
+			return false
+		}
+	}
+	return true
+}
+
+// MustLoad is like Load but panics if the pattern cannot be restored
+func MustLoad(proto interface{}, data []byte) *Regexp {
+	re, err := Load(proto, data)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
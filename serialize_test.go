@@ -0,0 +1,151 @@
+package restructure
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// findWithPattern runs several of the find methods of pattern and returns
+// the results
+func findWithPattern(pattern *Regexp, proto interface{}, input string) []interface{} {
+	typ := reflect.TypeOf(proto)
+
+	first := reflect.New(typ)
+	found := pattern.Find(first.Interface(), input)
+
+	last := reflect.New(typ)
+	foundLast := pattern.FindLast(last.Interface(), input)
+
+	all := reflect.New(reflect.SliceOf(typ))
+	pattern.FindAll(all.Interface(), input, -1)
+
+	return []interface{}{found, first.Interface(), foundLast, last.Interface(), all.Interface()}
+}
+
+func TestSerialize_RoundTrip(t *testing.T) {
+	for _, longest := range []bool{false, true} {
+		for _, test := range engineTestCases {
+			pattern := MustCompile(test.proto, Options{Longest: longest})
+			data, err := pattern.MarshalBinary()
+			require.NoError(t, err)
+
+			loaded, err := Load(test.proto, data)
+			require.NoError(t, err, "%T", test.proto)
+			assert.Equal(t, pattern.String(), loaded.String())
+			assert.Equal(t, pattern.Describe(), loaded.Describe())
+
+			for _, input := range test.inputs {
+				expected := findWithPattern(pattern, test.proto, input)
+				actual := findWithPattern(loaded, test.proto, input)
+				assert.Equal(t, expected, actual, "%T on %q with Longest=%v", test.proto, input, longest)
+			}
+		}
+	}
+}
+
+func TestSerialize_Options(t *testing.T) {
+	compiled := MustCompile(PacketHeader{}, Options{Bytes: true, MaxSteps: 1000, Anchor: AnchorStart})
+	data, err := compiled.MarshalBinary()
+	require.NoError(t, err)
+	pattern := MustLoad(&PacketHeader{}, data)
+	assert.Equal(t, compiled.opts, pattern.opts)
+
+	var h PacketHeader
+	require.True(t, pattern.Find(&h, "\x7fPK\x00\x02\x10\x01\x00\x00\xc3\n\xff\x00"))
+	assert.Equal(t, uint16(2), h.Version)
+	assert.Equal(t, uint32(0x110), h.Length)
+	assert.Equal(t, "\xc3", h.Kind)
+	assert.Equal(t, []byte("\n\xff\x00"), h.Payload)
+}
+
+func TestSerialize_TypeChanged(t *testing.T) {
+	data := func() []byte {
+		type Version struct {
+			Major string `[0-9]+`
+			_     string `\.`
+			Minor string `[0-9]+`
+		}
+		data, err := MustCompile(Version{}, Options{}).MarshalBinary()
+		require.NoError(t, err)
+		return data
+	}()
+
+	type Version struct {
+		Major string `[0-9]+`
+		_     string `\.`
+		Minor string `[0-9]*`
+	}
+	_, err := Load(Version{}, data)
+	assert.EqualError(t, err, "restructure.Version has changed since the pattern was compiled")
+
+	_, err = Load(Float{}, data)
+	assert.EqualError(t, err, "pattern was compiled for restructure.Version, not restructure.Float")
+
+	_, err = Load(Float{}, []byte("garbage"))
+	assert.Error(t, err)
+	assert.Panics(t, func() { MustLoad(Float{}, nil) })
+}
+
+func TestSerialize_Unsupported(t *testing.T) {
+	_, err := MustCompile(Float{}, Options{Engine: StdlibEngine}).MarshalBinary()
+	assert.EqualError(t, err, "only patterns compiled by ForkEngine can be marshaled")
+
+	_, err = MustCompile(QuotedString{}, Options{ExtendedSyntax: true}).MarshalBinary()
+	assert.Error(t, err)
+
+	_, err = MustCompile(Invoice{}, Options{}).MarshalBinary()
+	assert.Error(t, err)
+}
+
+// findCorrupt runs the find methods of a pattern restored from corrupt
+// data, and returns the value of any panic other than the error Find raises
+// when text cannot be stored in a field, which a changed pattern can match
+func findCorrupt(pattern *Regexp, proto interface{}, input string) (bad interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if _, isRuntime := r.(runtime.Error); !ok || isRuntime || !strings.HasPrefix(err.Error(), "unable to capture") {
+				bad = r
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := pattern.FindContext(ctx, reflect.New(reflect.TypeOf(proto)).Interface(), input)
+	if err == context.DeadlineExceeded {
+		return err
+	}
+	findWithPattern(pattern, proto, input)
+	return nil
+}
+
+func TestSerialize_Corrupt(t *testing.T) {
+	// Data that loads after any single byte is changed must not make the
+	// find methods panic or loop forever
+	for _, test := range engineTestCases {
+		data, err := MustCompile(test.proto, Options{}).MarshalBinary()
+		require.NoError(t, err)
+		corrupt := make([]byte, len(data))
+		for i := range data {
+			for _, b := range []byte{0, 0xff, data[i] + 1} {
+				copy(corrupt, data)
+				corrupt[i] = b
+				pattern, err := Load(test.proto, corrupt)
+				if err != nil {
+					continue
+				}
+				for _, input := range test.inputs {
+					bad := findCorrupt(pattern, test.proto, input)
+					require.Nil(t, bad, "%T with byte %d set to %#x on %q", test.proto, i, b, input)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package restructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp/syntax"
+
+	"github.com/alexflint/go-restructure/regex"
+)
+
+// Set matches strings against many struct types at once. All of the struct
+// types are compiled into a single program, so finding which of them match
+// takes a single pass over the input rather than one pass per type.
+type Set struct {
+	set     *regex.Set
+	regexps []*Regexp
+}
+
+// CompileSet constructs a set from the struct fields on each of the provided
+// structs. When several types match at the same position, types that appear
+// earlier in protos take priority over those that appear later.
+func CompileSet(protos []interface{}, opts Options) (*Set, error) {
+	if _, ok := opts.Engine.(forkEngine); !ok && opts.Engine != nil {
+		return nil, errors.New("CompileSet is only supported by ForkEngine")
+	}
+	var regexps []*Regexp
+	var exprs []*syntax.Regexp
+	for _, proto := range protos {
+		r, expr, err := build(reflect.TypeOf(proto), opts)
+		if err != nil {
+			return nil, err
+		}
+		if opts.MaxEdits > 0 || len(r.edits) > 0 {
+			return nil, errors.New("approximate matching is not supported in a Set")
+		}
+		regexps = append(regexps, r)
+		exprs = append(exprs, expr)
+	}
+
+	set, err := regex.CompileSetSyntax(exprs)
+	if err != nil {
+		return nil, err
+	}
+	if opts.longest() {
+		set.Longest()
+	}
+	if opts.Bytes {
+		set.ByteMode()
+	}
+	if opts.UnicodeWordBoundaries {
+		set.UnicodeWordBoundaries()
+	}
+	if opts.CRLF {
+		set.CRLFLineEndings()
+	}
+	set.SetMaxSteps(opts.MaxSteps)
+	if opts.Strategies != 0 || opts.ForbidStrategies != 0 || opts.MaxBacktrackVector != 0 {
+		if err := set.SetStrategies(opts.strategies()); err != nil {
+			return nil, err
+		}
+		if opts.MaxBacktrackVector != 0 {
+			set.SetMaxBacktrackVector(opts.MaxBacktrackVector)
+		}
+	}
+	for i, r := range regexps {
+		r.re = set.Regexp(i)
+		r.m = r.re
+	}
+	return &Set{
+		set:     set,
+		regexps: regexps,
+	}, nil
+}
+
+// MustCompileSet is like CompileSet but panics if there is a compilation error
+func MustCompileSet(protos []interface{}, opts Options) *Set {
+	set, err := CompileSet(protos, opts)
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// Len returns the number of struct types in the set
+func (s *Set) Len() int {
+	return len(s.regexps)
+}
+
+// Regexp returns the regular expression for the i-th struct type in the set
+func (s *Set) Regexp(i int) *Regexp {
+	return s.regexps[i]
+}
+
+// Find finds the leftmost match in str of any struct type in the set. It
+// returns a pointer to a new struct of the type that matched, with its fields
+// populated from the match, or nil if none of the types match. If several
+// types match at the leftmost position then the type listed first wins,
+// unless Options.Longest is set, in which case the longest match wins and
+// among matches of the same length the type listed first wins.
+func (s *Set) Find(str string) interface{} {
+	input := []byte(str)
+	i, indices := s.set.FindSubmatchIndex(input)
+	if indices == nil {
+		return nil
+	}
+	return s.regexps[i].inflateNew(indices, input)
+}
+
+// FindMatching returns a pointer to a new struct for each type in the set
+// that matches somewhere in str, populated from the first match of that
+// type, in the order the types were listed. The input is scanned once to
+// determine which types match, and then once more for each type that did.
+// If Options.MaxSteps is set then a type whose search runs out of steps is
+// left out, as are all of them if the first scan does.
+func (s *Set) FindMatching(str string) []interface{} {
+	input := []byte(str)
+	var out []interface{}
+	for _, i := range s.set.Matches(input) {
+		r := s.regexps[i]
+		indices, err := r.re.FindSubmatchIndexContext(context.Background(), input)
+		if err != nil {
+			continue
+		}
+		if indices == nil {
+			panic(fmt.Errorf("%s matched as part of a set but not on its own", r.t.String()))
+		}
+		out = append(out, r.inflateNew(indices, input))
+	}
+	return out
+}
+
+// inflateNew allocates a new struct of the type for this regular expression
+// and populates it from the given match.
+func (r *Regexp) inflateNew(indices []int, input []byte) interface{} {
+	v := reflect.New(r.t)
+	err := inflateStruct(v, matchFromIndices(indices, input), r.st)
+	if err != nil {
+		panic(err)
+	}
+	return v.Interface()
+}
@@ -0,0 +1,105 @@
+package restructure
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alexflint/go-restructure/regex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type LoginEvent struct {
+	_    struct{} `^login\s+`
+	User string   `\w+`
+}
+
+type LogoutEvent struct {
+	_    struct{} `^logout\s+`
+	User string   `\w+`
+}
+
+type TransferEvent struct {
+	_      struct{} `^transfer\s+`
+	Amount int      `\d+`
+	_      struct{} `\s+to\s+`
+	User   string   `\w+`
+}
+
+var eventTypes = []interface{}{LoginEvent{}, LogoutEvent{}, TransferEvent{}}
+
+func TestSetFind(t *testing.T) {
+	set := MustCompileSet(eventTypes, Options{})
+	require.Equal(t, 3, set.Len())
+
+	assert.Equal(t, &LoginEvent{User: "alice"}, set.Find("login alice"))
+	assert.Equal(t, &LogoutEvent{User: "bob"}, set.Find("logout bob"))
+	assert.Equal(t, &TransferEvent{Amount: 12, User: "carol"}, set.Find("transfer 12 to carol"))
+	assert.Nil(t, set.Find("reboot"))
+}
+
+func TestSetFind_Priority(t *testing.T) {
+	set := MustCompileSet([]interface{}{Word{}, ExprWithInt{}}, Options{})
+	// both match at position zero and Word is listed first
+	assert.Equal(t, &Word{S: "4"}, set.Find("4 wombats"))
+	assert.Equal(t, &Word{S: "wombats"}, set.Find("wombats"))
+}
+
+func TestSetFind_Longest(t *testing.T) {
+	set := MustCompileSet([]interface{}{Word{}, ExprWithInt{}}, Options{Longest: true})
+	// both match at position zero but ExprWithInt is longer
+	assert.Equal(t, &ExprWithInt{Number: 4, Animal: "wombats"}, set.Find("4 wombats"))
+	assert.Equal(t, &Word{S: "wombats"}, set.Find("wombats"))
+}
+
+func TestSetFind_Tie(t *testing.T) {
+	set := MustCompileSet([]interface{}{WordSubmatch{}, Word{}}, Options{})
+	// both match the same text, so the type listed first wins
+	w, ok := set.Find("ham").(*WordSubmatch)
+	require.True(t, ok)
+	assertRegion(t, "ham", 0, 3, w.S)
+}
+
+func TestSetFindMatching(t *testing.T) {
+	set := MustCompileSet([]interface{}{Word{}, LoginEvent{}, LogoutEvent{}}, Options{})
+	matches := set.FindMatching("login alice")
+	require.Len(t, matches, 2)
+	assert.Equal(t, &Word{S: "login"}, matches[0])
+	assert.Equal(t, &LoginEvent{User: "alice"}, matches[1])
+	assert.Empty(t, set.FindMatching("!!"))
+}
+
+func TestSetFindMatching_DotAtEnd(t *testing.T) {
+	type Command struct {
+		Name string `go.`
+	}
+	set := MustCompileSet([]interface{}{Word{}, Command{}}, Options{})
+	matches := set.FindMatching("12 go")
+	require.Len(t, matches, 1)
+	assert.Equal(t, &Word{S: "12"}, matches[0])
+}
+
+func TestSetCompileError(t *testing.T) {
+	_, err := CompileSet([]interface{}{Word{}, Malformed{}}, Options{})
+	assert.Error(t, err)
+}
+
+func TestSetMaxSteps(t *testing.T) {
+	input := strings.Repeat("!", 10000) + "wombats"
+	set := MustCompileSet([]interface{}{Word{}, LoginEvent{}}, Options{})
+	assert.Equal(t, &Word{S: "wombats"}, set.Find(input))
+
+	set = MustCompileSet([]interface{}{Word{}, LoginEvent{}}, Options{MaxSteps: 100})
+	assert.Nil(t, set.Find(input))
+	assert.Empty(t, set.FindMatching(input))
+	assert.Equal(t, &Word{S: "wombats"}, set.Find("wombats"))
+}
+
+func TestSetStrategies(t *testing.T) {
+	_, err := CompileSet([]interface{}{Word{}}, Options{Strategies: regex.OnePass})
+	assert.Error(t, err)
+
+	set := MustCompileSet(eventTypes, Options{Strategies: regex.NFA})
+	assert.Equal(t, regex.NFA, set.set.Regexp(0).Stats().Strategies)
+	assert.Equal(t, &LogoutEvent{User: "bob"}, set.Find("logout bob"))
+}
@@ -0,0 +1,73 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type SpannedHost struct {
+	Span
+	Domain string   `\w+`
+	_      struct{} `\.`
+	TLD    string   `\w+`
+}
+
+type SpannedEmail struct {
+	Span
+	User string   `[a-z]+`
+	_    struct{} `@`
+	Host *SpannedHost
+}
+
+func TestSpan_Embedded(t *testing.T) {
+	pattern := MustCompile(SpannedEmail{}, Options{})
+	var email SpannedEmail
+	require.True(t, pattern.Find(&email, "contact joe@example.com today"))
+	assert.Equal(t, Span{Begin: 8, End: 23, Bytes: []byte("joe@example.com")}, email.Span)
+	assert.Equal(t, "joe", email.User)
+	require.NotNil(t, email.Host)
+	assert.Equal(t, Pos(12), email.Host.Begin)
+	assert.Equal(t, Pos(23), email.Host.End)
+	assert.Equal(t, "example.com", email.Host.String())
+	assert.Equal(t, "example", email.Host.Domain)
+}
+
+func TestSpan_Field(t *testing.T) {
+	type Assignment struct {
+		Where Span
+		Key   string   `\w+`
+		_     struct{} `=`
+		Value *struct {
+			Where Span
+			Text  string `\w*`
+		}
+		where Span
+	}
+	pattern := MustCompile(Assignment{}, Options{})
+	var a Assignment
+	require.True(t, pattern.Find(&a, "  x=yz"))
+	assert.Equal(t, Span{Begin: 2, End: 6, Bytes: []byte("x=yz")}, a.Where)
+	assert.Equal(t, Span{Begin: 4, End: 6, Bytes: []byte("yz")}, a.Value.Where)
+	assert.Equal(t, Span{}, a.where)
+	assert.NotContains(t, pattern.String(), "Where")
+}
+
+func TestSpan_FindAll(t *testing.T) {
+	pattern := MustCompile(SpannedHost{}, Options{})
+	var hosts []SpannedHost
+	pattern.FindAll(&hosts, "a.com, bb.org", -1)
+	require.Len(t, hosts, 2)
+	assert.Equal(t, Span{Begin: 0, End: 5, Bytes: []byte("a.com")}, hosts[0].Span)
+	assert.Equal(t, Span{Begin: 7, End: 13, Bytes: []byte("bb.org")}, hosts[1].Span)
+}
+
+func TestSpan_Load(t *testing.T) {
+	data, err := MustCompile(SpannedEmail{}, Options{}).MarshalBinary()
+	require.NoError(t, err)
+	var email SpannedEmail
+	require.True(t, MustLoad(SpannedEmail{}, data).Find(&email, "joe@example.com"))
+	assert.Equal(t, "joe@example.com", email.String())
+	assert.Equal(t, "example.com", email.Host.String())
+}
@@ -0,0 +1,79 @@
+package restructure
+
+import (
+	"testing"
+
+	"github.com/alexflint/go-restructure/regex"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type AnchoredEmail struct {
+	_      struct{} `^`
+	User   string   `[a-z]+`
+	_      struct{} `@`
+	Domain string   `[a-z]+`
+	_      struct{} `\.com$`
+}
+
+type UnanchoredEmail struct {
+	User   string   `[a-z]+`
+	_      struct{} `@`
+	Domain string   `[a-z]+`
+}
+
+func TestDescribe(t *testing.T) {
+	desc := MustCompile(AnchoredEmail{}, Options{}).Describe()
+	assert.Contains(t, desc, "onepass: yes\n")
+	assert.Contains(t, desc, "captures: 2\n")
+	assert.Contains(t, desc, "strategies: onepass|backtrack|nfa|dfa\n")
+
+	desc = MustCompile(UnanchoredEmail{}, Options{}).Describe()
+	assert.Contains(t, desc, "onepass: no (")
+	assert.Contains(t, desc, `literal prefix: ""`)
+}
+
+func TestStrategies_Force(t *testing.T) {
+	for _, s := range []regex.Strategy{regex.OnePass, regex.Backtrack, regex.NFA, regex.DFA | regex.NFA} {
+		re, err := Compile(AnchoredEmail{}, Options{Strategies: s})
+		require.NoError(t, err, "%v", s)
+		assert.Contains(t, re.Describe(), "strategies: "+s.String()+"\n")
+
+		var e AnchoredEmail
+		require.True(t, re.Find(&e, "joe@example.com"), "%v", s)
+		assert.Equal(t, "joe", e.User)
+		assert.Equal(t, "example", e.Domain)
+		assert.False(t, re.Find(&e, "joe@example.com!"), "%v", s)
+	}
+}
+
+func TestStrategies_Forbid(t *testing.T) {
+	re, err := Compile(AnchoredEmail{}, Options{ForbidStrategies: regex.OnePass})
+	require.NoError(t, err)
+	assert.Contains(t, re.Describe(), "strategies: backtrack|nfa|dfa\n")
+
+	var e AnchoredEmail
+	require.True(t, re.Find(&e, "joe@example.com"))
+	assert.Equal(t, "example", e.Domain)
+}
+
+func TestStrategies_MaxBacktrackVector(t *testing.T) {
+	re, err := Compile(UnanchoredEmail{}, Options{MaxBacktrackVector: 1})
+	require.NoError(t, err)
+	assert.Contains(t, re.Describe(), "backtrack limit: 0 bytes\n")
+
+	var e UnanchoredEmail
+	require.True(t, re.Find(&e, "mail joe@example now"))
+	assert.Equal(t, UnanchoredEmail{User: "joe", Domain: "example"}, e)
+}
+
+func TestStrategies_Errors(t *testing.T) {
+	_, err := Compile(UnanchoredEmail{}, Options{Strategies: regex.OnePass})
+	assert.EqualError(t, err, "onepass strategy cannot be used: the expression is not anchored at the beginning of the text")
+
+	_, err = Compile(UnanchoredEmail{}, Options{ForbidStrategies: regex.AllStrategies})
+	assert.Error(t, err)
+
+	_, err = Compile(UnanchoredEmail{}, Options{Strategies: regex.NFA, MaxEdits: 1})
+	assert.Error(t, err)
+}